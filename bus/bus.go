@@ -0,0 +1,61 @@
+// Package bus provides implementations of [gache.Bus], which carries
+// invalidation messages between caches configured with
+// [gache.WithInvalidationBus]: [Hub] connects caches in the same process,
+// for example in tests, and [UDP] connects processes over UDP unicast or
+// multicast.
+package bus
+
+import (
+	"sync"
+
+	"github.com/kpango/gache/v2"
+)
+
+// Hub is an in-process [gache.Bus]. Every message published on a hub is
+// delivered synchronously to all of its subscribers.
+//
+// Example:
+//
+//	hub := bus.NewHub()
+//	a := gache.New[string](gache.WithInvalidationBus[string](hub))
+//	b := gache.New[string](gache.WithInvalidationBus[string](hub))
+//	b.Set("k", "old")
+//	a.Set("k", "new") // drops "k" from b
+type Hub struct {
+	mu   sync.RWMutex
+	subs map[uint64]func(gache.Invalidation)
+	next uint64
+}
+
+// NewHub returns a Hub without subscribers.
+func NewHub() *Hub {
+	return &Hub{subs: make(map[uint64]func(gache.Invalidation))}
+}
+
+// Publish implements [gache.Bus].
+func (h *Hub) Publish(msg gache.Invalidation) error {
+	h.mu.RLock()
+	subs := make([]func(gache.Invalidation), 0, len(h.subs))
+	for _, f := range h.subs {
+		subs = append(subs, f)
+	}
+	h.mu.RUnlock()
+	for _, f := range subs {
+		f(msg)
+	}
+	return nil
+}
+
+// Subscribe implements [gache.Bus].
+func (h *Hub) Subscribe(f func(gache.Invalidation)) (cancel func()) {
+	h.mu.Lock()
+	id := h.next
+	h.next++
+	h.subs[id] = f
+	h.mu.Unlock()
+	return func() {
+		h.mu.Lock()
+		delete(h.subs, id)
+		h.mu.Unlock()
+	}
+}
@@ -0,0 +1,139 @@
+package bus
+
+import (
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kpango/gache/v2"
+)
+
+func eventually(t *testing.T, cond func() bool, msg string) {
+	t.Helper()
+	for deadline := time.Now().Add(2 * time.Second); !cond(); {
+		if time.Now().After(deadline) {
+			t.Fatal(msg)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// testInvalidation verifies that a write on a drops the key from b.
+func testInvalidation(t *testing.T, ba, bb gache.Bus) {
+	t.Helper()
+	a := gache.New(gache.WithInvalidationBus[string](ba, gache.WithNodeID("a")))
+	b := gache.New(gache.WithInvalidationBus[string](bb, gache.WithNodeID("b")))
+	defer a.Close()
+	defer b.Close()
+
+	b.SetWithExpire("k", "stale", gache.NoTTL)
+	time.Sleep(50 * time.Millisecond)
+	a.Set("k", "fresh")
+	eventually(t, func() bool { _, ok := b.Get("k"); return !ok }, "expected the write on a to drop k from b")
+	if v, ok := a.Get("k"); !ok || v != "fresh" {
+		t.Errorf("expected a to keep its write, got %q, %v", v, ok)
+	}
+}
+
+// TestHub verifies invalidation between caches sharing a Hub.
+func TestHub(t *testing.T) {
+	t.Helper()
+	hub := NewHub()
+	testInvalidation(t, hub, hub)
+
+	var got []gache.Invalidation
+	cancel := hub.Subscribe(func(msg gache.Invalidation) { got = append(got, msg) })
+	hub.Publish(gache.Invalidation{Origin: "x", Seq: 1})
+	cancel()
+	hub.Publish(gache.Invalidation{Origin: "x", Seq: 2})
+	if len(got) != 1 {
+		t.Errorf("expected 1 message before cancel, got %d", len(got))
+	}
+}
+
+// TestUDP verifies invalidation between caches over UDP unicast on loopback.
+func TestUDP(t *testing.T) {
+	t.Helper()
+	a, err := ListenUDP("127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer a.Close()
+	b, err := ListenUDP("127.0.0.1:0", a.Addr().String())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer b.Close()
+	a.peers = append(a.peers, b.conn.LocalAddr().(*net.UDPAddr))
+	testInvalidation(t, a, b)
+}
+
+// TestMulticastUDP verifies invalidation over UDP multicast, when the
+// environment supports it.
+func TestMulticastUDP(t *testing.T) {
+	t.Helper()
+	a, err := ListenMulticastUDP("239.255.77.77:47946", nil)
+	if err != nil {
+		t.Skipf("multicast unavailable: %v", err)
+	}
+	defer a.Close()
+	b, err := ListenMulticastUDP("239.255.77.77:47946", nil)
+	if err != nil {
+		t.Skipf("multicast unavailable: %v", err)
+	}
+	defer b.Close()
+	received := make(chan struct{}, 1)
+	cancel := b.Subscribe(func(gache.Invalidation) {
+		select {
+		case received <- struct{}{}:
+		default:
+		}
+	})
+	defer cancel()
+	if err := a.Publish(gache.Invalidation{Origin: "probe", Seq: 1, Keys: []string{"k"}}); err != nil {
+		t.Skipf("multicast unavailable: %v", err)
+	}
+	select {
+	case <-received:
+	case <-time.After(time.Second):
+		t.Skip("multicast traffic is not delivered in this environment")
+	}
+	testInvalidation(t, a, b)
+}
+
+// TestCodec verifies the datagram encoding.
+func TestCodec(t *testing.T) {
+	t.Helper()
+	msg := gache.Invalidation{Origin: "node#1", Seq: 42, Keys: []string{"a", "", "user:1"}}
+	b, err := encode(msg)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got, ok := decode(b)
+	if !ok || !reflect.DeepEqual(got, msg) {
+		t.Fatalf("expected %+v, got %+v, %v", msg, got, ok)
+	}
+	for i := range b {
+		if _, ok := decode(b[:i]); ok {
+			t.Fatalf("expected a truncated datagram of %d bytes to be rejected", i)
+		}
+	}
+	clr := gache.Invalidation{Origin: "node#1", Seq: 43, Keys: []string{}, Clear: true}
+	if b, err = encode(clr); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got, ok := decode(b); !ok || !reflect.DeepEqual(got, clr) {
+		t.Fatalf("expected %+v, got %+v, %v", clr, got, ok)
+	}
+	if _, ok := decode(append(b, 1)); ok {
+		t.Error("expected trailing bytes to be rejected")
+	}
+	if _, ok := decode([]byte("GET / HTTP/1.1")); ok {
+		t.Error("expected foreign traffic to be rejected")
+	}
+	if _, err := encode(gache.Invalidation{Keys: []string{strings.Repeat("k", maxDatagram)}}); err != ErrMessageTooLarge {
+		t.Errorf("expected ErrMessageTooLarge, got %v", err)
+	}
+}
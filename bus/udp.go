@@ -0,0 +1,205 @@
+package bus
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"sync"
+
+	"github.com/kpango/gache/v2"
+)
+
+// UDP is a [gache.Bus] that sends every message as one datagram, either to
+// a fixed list of peers or to a multicast group. UDP does not guarantee
+// delivery; lost messages are reported by [gache.WithInvalidationGapHandler].
+type UDP struct {
+	conn  *net.UDPConn
+	peers []*net.UDPAddr
+	subs  *Hub
+	done  chan struct{}
+	once  sync.Once
+}
+
+// maxDatagram is the largest UDP payload over IPv4.
+const maxDatagram = 65507
+
+// magic starts every datagram so that unrelated traffic is ignored.
+var magic = [4]byte{'g', 'I', 'v', '1'}
+
+// ErrMessageTooLarge is returned by [UDP.Publish] for a message that does
+// not fit into a single datagram.
+var ErrMessageTooLarge = errors.New("bus: message too large for a datagram")
+
+// ListenUDP returns a UDP bus that receives on the local address addr, such
+// as ":7946", and publishes to each of peers. peers may include the
+// listener's own address.
+//
+// Example:
+//
+//	b, err := bus.ListenUDP(":7946", "10.0.0.2:7946", "10.0.0.3:7946")
+//	if err != nil {
+//	    return err
+//	}
+//	defer b.Close()
+func ListenUDP(addr string, peers ...string) (*UDP, error) {
+	laddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	addrs := make([]*net.UDPAddr, 0, len(peers))
+	for _, p := range peers {
+		a, err := net.ResolveUDPAddr("udp", p)
+		if err != nil {
+			return nil, err
+		}
+		addrs = append(addrs, a)
+	}
+	conn, err := net.ListenUDP("udp", laddr)
+	if err != nil {
+		return nil, err
+	}
+	return newUDP(conn, addrs), nil
+}
+
+// ListenMulticastUDP returns a UDP bus that joins the multicast group, such
+// as "239.0.0.1:7946", on the network interface ifi, or on the system's
+// default interface when ifi is nil, and publishes to the group.
+func ListenMulticastUDP(group string, ifi *net.Interface) (*UDP, error) {
+	gaddr, err := net.ResolveUDPAddr("udp", group)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.ListenMulticastUDP("udp", ifi, gaddr)
+	if err != nil {
+		return nil, err
+	}
+	return newUDP(conn, []*net.UDPAddr{gaddr}), nil
+}
+
+func newUDP(conn *net.UDPConn, peers []*net.UDPAddr) *UDP {
+	u := &UDP{
+		conn:  conn,
+		peers: peers,
+		subs:  NewHub(),
+		done:  make(chan struct{}),
+	}
+	go u.read()
+	return u
+}
+
+// Addr returns the local address the bus receives on.
+func (u *UDP) Addr() net.Addr {
+	return u.conn.LocalAddr()
+}
+
+// Publish implements [gache.Bus]. It returns the first error sending to a
+// peer, after trying all of them.
+func (u *UDP) Publish(msg gache.Invalidation) error {
+	b, err := encode(msg)
+	if err != nil {
+		return err
+	}
+	var first error
+	for _, p := range u.peers {
+		if _, err := u.conn.WriteToUDP(b, p); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// Subscribe implements [gache.Bus].
+func (u *UDP) Subscribe(f func(gache.Invalidation)) (cancel func()) {
+	return u.subs.Subscribe(f)
+}
+
+// Close stops receiving and closes the socket.
+func (u *UDP) Close() error {
+	var err error
+	u.once.Do(func() {
+		err = u.conn.Close()
+		<-u.done
+	})
+	return err
+}
+
+// read delivers the received messages to the subscribers until the socket
+// is closed. Malformed datagrams are dropped.
+func (u *UDP) read() {
+	defer close(u.done)
+	buf := make([]byte, maxDatagram)
+	for {
+		n, _, err := u.conn.ReadFromUDP(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+		if msg, ok := decode(buf[:n]); ok {
+			u.subs.Publish(msg)
+		}
+	}
+}
+
+// encode lays out msg as the magic, the origin, the sequence number and the
+// keys, where strings are prefixed with their length as a uint16 and
+// integers are big-endian. A Clear message ends with an extra byte 1.
+func encode(msg gache.Invalidation) ([]byte, error) {
+	size := len(magic) + 2 + len(msg.Origin) + 8 + 2 + 1
+	for _, key := range msg.Keys {
+		size += 2 + len(key)
+	}
+	if size > maxDatagram || len(msg.Origin) > 0xffff || len(msg.Keys) > 0xffff {
+		return nil, ErrMessageTooLarge
+	}
+	b := make([]byte, 0, size)
+	b = append(b, magic[:]...)
+	b = binary.BigEndian.AppendUint16(b, uint16(len(msg.Origin)))
+	b = append(b, msg.Origin...)
+	b = binary.BigEndian.AppendUint64(b, msg.Seq)
+	b = binary.BigEndian.AppendUint16(b, uint16(len(msg.Keys)))
+	for _, key := range msg.Keys {
+		b = binary.BigEndian.AppendUint16(b, uint16(len(key)))
+		b = append(b, key...)
+	}
+	if msg.Clear {
+		b = append(b, 1)
+	}
+	return b, nil
+}
+
+func decode(b []byte) (msg gache.Invalidation, ok bool) {
+	if len(b) < len(magic) || [4]byte(b[:4]) != magic {
+		return msg, false
+	}
+	b = b[len(magic):]
+	str := func() (string, bool) {
+		if len(b) < 2 {
+			return "", false
+		}
+		n := int(binary.BigEndian.Uint16(b))
+		if len(b) < 2+n {
+			return "", false
+		}
+		s := string(b[2 : 2+n])
+		b = b[2+n:]
+		return s, true
+	}
+	if msg.Origin, ok = str(); !ok || len(b) < 10 {
+		return msg, false
+	}
+	msg.Seq = binary.BigEndian.Uint64(b)
+	n := int(binary.BigEndian.Uint16(b[8:]))
+	b = b[10:]
+	msg.Keys = make([]string, n)
+	for i := range msg.Keys {
+		if msg.Keys[i], ok = str(); !ok {
+			return msg, false
+		}
+	}
+	if len(b) == 1 && b[0] == 1 {
+		msg.Clear, b = true, b[1:]
+	}
+	return msg, len(b) == 0
+}
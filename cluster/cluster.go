@@ -0,0 +1,326 @@
+// Package cluster distributes a cache over a set of peers in the spirit of
+// groupcache. Every key is owned by exactly one peer, chosen with a
+// consistent-hash ring over the peer addresses. [Cluster.Get] on the owner
+// serves the key from its local cache, loading it on a miss with the
+// [Loader] while collapsing concurrent loads into one; on any other peer it
+// forwards the request to the owner over HTTP. Remote keys that are read
+// often can be mirrored locally for a short time with [WithHotCache].
+//
+// Example:
+//
+//	self := "http://10.0.0.1:8080"
+//	c := cluster.New[User](self, []string{
+//	    "http://10.0.0.1:8080", "http://10.0.0.2:8080", "http://10.0.0.3:8080",
+//	}, func(ctx context.Context, key string) (User, error) {
+//	    return db.LoadUser(ctx, key)
+//	}, cluster.WithHotCache[User](time.Second, 10))
+//	defer c.Close()
+//	http.Handle(cluster.DefaultBasePath, c)
+//	go http.ListenAndServe(":8080", nil)
+//
+//	u, err := c.Get(ctx, "user:1")
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/kpango/gache/v2"
+	"golang.org/x/sync/singleflight"
+)
+
+type (
+	// Loader loads the value of a key owned by this peer, typically from a
+	// database. It returns [ErrNotFound] for keys that do not exist.
+	Loader[V any] func(ctx context.Context, key string) (V, error)
+
+	// Option configures a [Cluster].
+	Option[V any] func(*Cluster[V])
+
+	// Cluster is one peer of a distributed cache. It is an [http.Handler]
+	// that must be reachable by the other peers under its base path.
+	Cluster[V any] struct {
+		self     string
+		load     Loader[V]
+		cache    gache.Gache[V]
+		ring     atomic.Pointer[ring]
+		replicas int
+		// loads coalesces the loads of keys on this peer and fetches the
+		// requests to other peers. They are kept apart so that a peer
+		// serving a key never waits for its own fetch of that key, which
+		// could wait for the serving peer in turn while the rings disagree.
+		loads    singleflight.Group
+		fetches  singleflight.Group
+		client   *http.Client
+		basePath string
+
+		// hot mirrors remote keys that were fetched at least hotHits times
+		// within hotTTL; hits counts the fetches.
+		hot     gache.Gache[V]
+		hits    gache.Gache[int64]
+		hotTTL  time.Duration
+		hotHits int64
+	}
+
+	// RemoteError is returned by [Cluster.Get] when the owner of a key failed
+	// to load it.
+	RemoteError struct {
+		// Peer is the owner that reported the error.
+		Peer string
+		// Msg is the error message reported by the owner.
+		Msg string
+	}
+)
+
+// DefaultBasePath is the path under which peers serve each other.
+const DefaultBasePath = "/_gache/"
+
+// ErrNotFound reports a key that does not exist. A [Loader] returns it for
+// missing keys and [Cluster.Get] returns it whichever peer owns the key.
+var ErrNotFound = errors.New("cluster: key not found")
+
+// Error implements error.
+func (e *RemoteError) Error() string {
+	return "cluster: peer " + e.Peer + ": " + e.Msg
+}
+
+// WithReplicas sets the number of virtual nodes each peer has on the hash
+// ring. More replicas spread keys more evenly; the default is 64. Every peer
+// must use the same value.
+func WithReplicas[V any](n int) Option[V] {
+	return func(c *Cluster[V]) {
+		if n > 0 {
+			c.replicas = n
+		}
+	}
+}
+
+// WithCache sets the cache holding the keys owned by this peer. Loaded
+// values are stored with its default expiration. By default a new cache
+// created by [gache.New] is used.
+func WithCache[V any](gc gache.Gache[V]) Option[V] {
+	return func(c *Cluster[V]) {
+		if gc != nil {
+			c.cache = gc
+		}
+	}
+}
+
+// WithHotCache mirrors a remote key locally for ttl once it has been fetched
+// from its owner hits times within ttl, so that hot keys do not cost a
+// network round trip on every read. Mirrored values may be up to ttl stale.
+// A hits <= 1 mirrors every remote key.
+func WithHotCache[V any](ttl time.Duration, hits int) Option[V] {
+	return func(c *Cluster[V]) {
+		if ttl > 0 {
+			c.hotTTL = ttl
+			c.hotHits = int64(max(hits, 1))
+		}
+	}
+}
+
+// WithHTTPClient sets the client used to reach the other peers. The default
+// is an [http.Client] with a 10 second timeout.
+func WithHTTPClient[V any](client *http.Client) Option[V] {
+	return func(c *Cluster[V]) {
+		if client != nil {
+			c.client = client
+		}
+	}
+}
+
+// WithBasePath sets the path under which peers serve each other; the
+// default is [DefaultBasePath]. Every peer must use the same value.
+func WithBasePath[V any](path string) Option[V] {
+	return func(c *Cluster[V]) {
+		if path != "" {
+			c.basePath = "/" + strings.Trim(path, "/") + "/"
+		}
+	}
+}
+
+// New returns the peer self of a cluster made of peers, which load the keys
+// they own with load. Peers are identified by their base URL, such as
+// "http://10.0.0.1:8080", and self should be one of them. Values are
+// exchanged between peers as JSON.
+func New[V any](self string, peers []string, load Loader[V], opts ...Option[V]) *Cluster[V] {
+	c := &Cluster[V]{
+		self:     strings.TrimSuffix(self, "/"),
+		load:     load,
+		replicas: defaultReplicas,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		basePath: DefaultBasePath,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.cache == nil {
+		c.cache = gache.New[V]()
+	}
+	if c.hotTTL > 0 {
+		c.hot = gache.New(gache.WithDefaultExpiration[V](c.hotTTL)).
+			StartExpired(context.Background(), c.hotTTL)
+		c.hits = gache.New(gache.WithDefaultExpiration[int64](c.hotTTL)).
+			StartExpired(context.Background(), c.hotTTL)
+	}
+	c.SetPeers(peers...)
+	return c
+}
+
+// SetPeers replaces the set of peers. Keys whose owner changes are loaded
+// again by their new owner.
+func (c *Cluster[V]) SetPeers(peers ...string) {
+	trimmed := make([]string, len(peers))
+	for i, p := range peers {
+		trimmed[i] = strings.TrimSuffix(p, "/")
+	}
+	c.ring.Store(newRing(c.replicas, trimmed))
+}
+
+// Owner returns the peer that owns key.
+func (c *Cluster[V]) Owner(key string) string {
+	return c.ring.Load().owner(key)
+}
+
+// Get returns the value of key. It is served from the local cache when this
+// peer owns key or has mirrored it, and from the owner otherwise. If the
+// owner cannot be reached, the value is loaded locally without caching it.
+func (c *Cluster[V]) Get(ctx context.Context, key string) (v V, err error) {
+	owner := c.Owner(key)
+	if owner == "" || owner == c.self {
+		return c.getLocal(ctx, key)
+	}
+	if c.hot != nil {
+		if v, ok := c.hot.Get(key); ok {
+			return v, nil
+		}
+	}
+	res, err, _ := c.fetches.Do(key, func() (any, error) {
+		return c.fetch(ctx, owner, key)
+	})
+	var remote *RemoteError
+	switch {
+	case err == nil:
+		v = res.(V)
+		c.mirror(key, v)
+		return v, nil
+	case errors.Is(err, ErrNotFound), errors.As(err, &remote), ctx.Err() != nil:
+		return v, err
+	}
+	return c.loadOnce(ctx, key)
+}
+
+// getLocal serves a key owned by this peer.
+func (c *Cluster[V]) getLocal(ctx context.Context, key string) (v V, err error) {
+	if v, ok := c.cache.Get(key); ok {
+		return v, nil
+	}
+	res, err, _ := c.loads.Do(key, func() (any, error) {
+		if v, ok := c.cache.Get(key); ok {
+			return v, nil
+		}
+		v, err := c.load(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		c.cache.Set(key, v)
+		return v, nil
+	})
+	if err != nil {
+		return v, err
+	}
+	return res.(V), nil
+}
+
+// loadOnce loads key without caching it, for when its owner is unreachable.
+func (c *Cluster[V]) loadOnce(ctx context.Context, key string) (v V, err error) {
+	res, err, _ := c.loads.Do(key, func() (any, error) {
+		return c.load(ctx, key)
+	})
+	if err != nil {
+		return v, err
+	}
+	return res.(V), nil
+}
+
+// mirror caches a remote key in the hot cache once it is hot enough.
+func (c *Cluster[V]) mirror(key string, v V) {
+	if c.hot == nil {
+		return
+	}
+	if c.hotHits > 1 && gache.Incr(c.hits, key) < c.hotHits {
+		return
+	}
+	c.hot.Set(key, v)
+}
+
+// fetch asks owner for key.
+func (c *Cluster[V]) fetch(ctx context.Context, owner, key string) (v V, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, owner+c.basePath+url.PathEscape(key), nil)
+	if err != nil {
+		return v, err
+	}
+	res, err := c.client.Do(req)
+	if err != nil {
+		return v, err
+	}
+	defer res.Body.Close()
+	switch res.StatusCode {
+	case http.StatusOK:
+		if err := json.NewDecoder(res.Body).Decode(&v); err != nil {
+			return v, fmt.Errorf("cluster: decoding %q from %s: %w", key, owner, err)
+		}
+		return v, nil
+	case http.StatusNotFound:
+		return v, ErrNotFound
+	case http.StatusInternalServerError:
+		msg, _ := io.ReadAll(io.LimitReader(res.Body, 4<<10))
+		return v, &RemoteError{Peer: owner, Msg: strings.TrimSpace(string(msg))}
+	}
+	return v, fmt.Errorf("cluster: unexpected status %q from %s", res.Status, owner)
+}
+
+// ServeHTTP serves the keys owned by this peer to the other peers. Requests
+// are always answered locally, even for keys this peer does not own, so that
+// peers with different views of the ring cannot forward in a loop.
+func (c *Cluster[V]) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := r.URL.EscapedPath()
+	if r.Method != http.MethodGet || !strings.HasPrefix(path, c.basePath) {
+		http.NotFound(w, r)
+		return
+	}
+	key, err := url.PathUnescape(path[len(c.basePath):])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	v, err := c.getLocal(r.Context(), key)
+	switch {
+	case errors.Is(err, ErrNotFound):
+		http.NotFound(w, r)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// Close stops the expiration daemons of the hot cache. It does not close the
+// cache set by [WithCache].
+func (c *Cluster[V]) Close() error {
+	if c.hot != nil {
+		c.hot.Stop()
+		c.hits.Stop()
+	}
+	return nil
+}
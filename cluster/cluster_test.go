@@ -0,0 +1,242 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type peer struct {
+	c      *Cluster[string]
+	ts     *httptest.Server
+	loads  atomic.Int64
+	served atomic.Int64
+}
+
+// newTestCluster starts n peers on loopback. Keys starting with "missing"
+// do not exist and loading keys starting with "fail" fails.
+func newTestCluster(t *testing.T, n int, delay time.Duration, opts ...Option[string]) []*peer {
+	t.Helper()
+	peers := make([]*peer, n)
+	urls := make([]string, n)
+	for i := range peers {
+		p := new(peer)
+		p.ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p.served.Add(1)
+			p.c.ServeHTTP(w, r)
+		}))
+		t.Cleanup(p.ts.Close)
+		peers[i], urls[i] = p, p.ts.URL
+	}
+	for _, p := range peers {
+		p.c = New(p.ts.URL, urls, func(_ context.Context, key string) (string, error) {
+			p.loads.Add(1)
+			time.Sleep(delay)
+			switch {
+			case strings.HasPrefix(key, "missing"):
+				return "", ErrNotFound
+			case strings.HasPrefix(key, "fail"):
+				return "", errors.New("boom")
+			}
+			return "v:" + key, nil
+		}, opts...)
+		t.Cleanup(func() { p.c.Close() })
+	}
+	return peers
+}
+
+// keyOwnedBy returns a key owned by p that starts with prefix.
+func keyOwnedBy(t *testing.T, p *peer, prefix string) string {
+	t.Helper()
+	for i := range 10000 {
+		if key := prefix + strconv.Itoa(i); p.c.Owner(key) == p.ts.URL {
+			return key
+		}
+	}
+	t.Fatalf("no key owned by %s", p.ts.URL)
+	return ""
+}
+
+// TestRing verifies that keys spread over all peers and that adding a peer
+// moves only a fraction of them.
+func TestRing(t *testing.T) {
+	t.Helper()
+	peers := []string{"http://a", "http://b", "http://c"}
+	r := newRing(defaultReplicas, peers)
+	counts := make(map[string]int)
+	owners := make(map[string]string)
+	for i := range 3000 {
+		key := "key" + strconv.Itoa(i)
+		owners[key] = r.owner(key)
+		counts[owners[key]]++
+	}
+	for _, p := range peers {
+		if counts[p] < 500 {
+			t.Errorf("expected %s to own a fair share of keys, got %d", p, counts[p])
+		}
+	}
+
+	grown := newRing(defaultReplicas, append(peers, "http://d"))
+	var moved int
+	for key, owner := range owners {
+		if o := grown.owner(key); o != owner {
+			moved++
+			if o != "http://d" {
+				t.Fatalf("expected %q to move to the new peer, got %s", key, o)
+			}
+		}
+	}
+	if moved == 0 || moved > 1200 {
+		t.Errorf("expected about a quarter of the keys to move, got %d", moved)
+	}
+	if owner := newRing(defaultReplicas, nil).owner("key"); owner != "" {
+		t.Errorf("expected no owner on an empty ring, got %q", owner)
+	}
+}
+
+// TestCluster_Get verifies that every peer returns the same values and that
+// each key is loaded once, by its owner.
+func TestCluster_Get(t *testing.T) {
+	t.Helper()
+	peers := newTestCluster(t, 3, 0)
+	ctx := context.Background()
+
+	for i := range 100 {
+		key := "key/" + strconv.Itoa(i)
+		for _, p := range peers {
+			v, err := p.c.Get(ctx, key)
+			if err != nil || v != "v:"+key {
+				t.Fatalf("expected %q, got %q, %v", "v:"+key, v, err)
+			}
+		}
+	}
+	var total int64
+	for _, p := range peers {
+		if p.loads.Load() == 0 {
+			t.Errorf("expected %s to load the keys it owns", p.ts.URL)
+		}
+		total += p.loads.Load()
+	}
+	if total != 100 {
+		t.Errorf("expected 100 loads, got %d", total)
+	}
+}
+
+// TestCluster_Errors verifies that missing keys and load failures on the
+// owner are reported by other peers.
+func TestCluster_Errors(t *testing.T) {
+	t.Helper()
+	peers := newTestCluster(t, 2, 0)
+	ctx := context.Background()
+
+	missing := keyOwnedBy(t, peers[0], "missing")
+	for _, p := range peers {
+		if _, err := p.c.Get(ctx, missing); !errors.Is(err, ErrNotFound) {
+			t.Errorf("expected ErrNotFound, got %v", err)
+		}
+	}
+
+	fail := keyOwnedBy(t, peers[0], "fail")
+	var remote *RemoteError
+	if _, err := peers[1].c.Get(ctx, fail); !errors.As(err, &remote) || remote.Peer != peers[0].ts.URL {
+		t.Errorf("expected a RemoteError from the owner, got %v", err)
+	}
+	if n := peers[1].loads.Load(); n != 0 {
+		t.Errorf("expected the non-owner not to load, got %d loads", n)
+	}
+}
+
+// TestCluster_Singleflight verifies that concurrent reads of a key from all
+// peers cause a single load.
+func TestCluster_Singleflight(t *testing.T) {
+	t.Helper()
+	peers := newTestCluster(t, 3, 50*time.Millisecond)
+	ctx := context.Background()
+	key := keyOwnedBy(t, peers[0], "key")
+
+	var wg sync.WaitGroup
+	for i := range 30 {
+		wg.Go(func() {
+			if v, err := peers[i%3].c.Get(ctx, key); err != nil || v != "v:"+key {
+				t.Errorf("expected %q, got %q, %v", "v:"+key, v, err)
+			}
+		})
+	}
+	wg.Wait()
+	if n := peers[0].loads.Load(); n != 1 {
+		t.Errorf("expected 1 load, got %d", n)
+	}
+}
+
+// TestCluster_DisagreeingRings verifies that two peers that each believe the
+// other owns a key serve concurrent reads of it without waiting on each other.
+func TestCluster_DisagreeingRings(t *testing.T) {
+	t.Helper()
+	peers := newTestCluster(t, 2, 50*time.Millisecond,
+		WithHTTPClient[string](&http.Client{Timeout: 2 * time.Second}))
+	a, b := peers[0], peers[1]
+	a.c.SetPeers(b.ts.URL)
+	b.c.SetPeers(a.ts.URL)
+	ctx := context.Background()
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	for _, p := range []*peer{a, b, a, b} {
+		wg.Go(func() {
+			if v, err := p.c.Get(ctx, "key"); err != nil || v != "v:key" {
+				t.Errorf("expected %q, got %q, %v", "v:key", v, err)
+			}
+		})
+	}
+	wg.Wait()
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("expected the reads to finish promptly, took %v", d)
+	}
+}
+
+// TestCluster_HotCache verifies that a remote key is mirrored once it has
+// been fetched often enough and expires from the mirror after its TTL.
+func TestCluster_HotCache(t *testing.T) {
+	t.Helper()
+	peers := newTestCluster(t, 2, 0, WithHotCache[string](200*time.Millisecond, 2))
+	ctx := context.Background()
+	key := keyOwnedBy(t, peers[0], "key")
+
+	for range 5 {
+		if v, err := peers[1].c.Get(ctx, key); err != nil || v != "v:"+key {
+			t.Fatalf("expected %q, got %q, %v", "v:"+key, v, err)
+		}
+	}
+	if n := peers[0].served.Load(); n != 2 {
+		t.Errorf("expected the owner to serve 2 requests before mirroring, got %d", n)
+	}
+
+	time.Sleep(400 * time.Millisecond)
+	peers[1].c.Get(ctx, key)
+	if n := peers[0].served.Load(); n != 3 {
+		t.Errorf("expected the mirror to expire, got %d requests", n)
+	}
+}
+
+// TestCluster_OwnerDown verifies that keys of an unreachable owner are
+// loaded locally.
+func TestCluster_OwnerDown(t *testing.T) {
+	t.Helper()
+	peers := newTestCluster(t, 2, 0)
+	key := keyOwnedBy(t, peers[0], "key")
+	peers[0].ts.Close()
+
+	if v, err := peers[1].c.Get(context.Background(), key); err != nil || v != "v:"+key {
+		t.Fatalf("expected %q, got %q, %v", "v:"+key, v, err)
+	}
+	if n := peers[1].loads.Load(); n != 1 {
+		t.Errorf("expected a local load, got %d", n)
+	}
+}
@@ -0,0 +1,50 @@
+package cluster
+
+import (
+	"slices"
+	"strconv"
+
+	"github.com/zeebo/xxh3"
+)
+
+// defaultReplicas is the number of virtual nodes per peer on the ring.
+const defaultReplicas = 64
+
+// ring is a consistent-hash ring. Every peer is placed at replicas points so
+// that keys spread evenly and only about 1/n of them move when a peer joins
+// or leaves. A ring is immutable once built.
+type ring struct {
+	hashes []uint64
+	owners map[uint64]string
+}
+
+func newRing(replicas int, peers []string) *ring {
+	r := &ring{
+		hashes: make([]uint64, 0, replicas*len(peers)),
+		owners: make(map[uint64]string, replicas*len(peers)),
+	}
+	for _, peer := range peers {
+		for i := range replicas {
+			h := xxh3.HashString(strconv.Itoa(i) + "#" + peer)
+			if _, ok := r.owners[h]; ok {
+				continue
+			}
+			r.owners[h] = peer
+			r.hashes = append(r.hashes, h)
+		}
+	}
+	slices.Sort(r.hashes)
+	return r
+}
+
+// owner returns the peer owning key, or "" for an empty ring.
+func (r *ring) owner(key string) string {
+	if len(r.hashes) == 0 {
+		return ""
+	}
+	i, _ := slices.BinarySearch(r.hashes, xxh3.HashString(key))
+	if i == len(r.hashes) {
+		i = 0
+	}
+	return r.owners[r.hashes[i]]
+}
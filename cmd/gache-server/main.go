@@ -0,0 +1,119 @@
+// Command gache-server serves a gache cache of JSON values over HTTP. See
+// package github.com/kpango/gache/v2/server for the API.
+//
+// Usage:
+//
+//	gache-server [-addr :8080] [-ttl 30s] [-sweep 1m] [-snapshot path] [-max-snapshot bytes]
+//
+// With -snapshot, the cache is loaded from the file at startup if it exists
+// and written back to it on shutdown. -max-snapshot bounds the snapshots
+// uploaded with PUT /snapshot. The cache keeps an ordered index of its keys
+// so that GET /keys does not sort every key on each request.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/kpango/gache/v2"
+	"github.com/kpango/gache/v2/server"
+	"github.com/kpango/glg"
+)
+
+func main() {
+	addr := flag.String("addr", ":8080", "listen address")
+	ttl := flag.Duration("ttl", 30*time.Second, "default expiration of entries; negative disables expiration")
+	sweep := flag.Duration("sweep", time.Minute, "interval between sweeps of expired entries")
+	snapshot := flag.String("snapshot", "", "snapshot file loaded at startup and saved on shutdown")
+	maxSnapshot := flag.Int64("max-snapshot", server.DefaultMaxSnapshotSize, "largest snapshot in bytes accepted by PUT /snapshot")
+	flag.Parse()
+
+	if err := run(*addr, *ttl, *sweep, *snapshot, *maxSnapshot); err != nil {
+		glg.Fatal(err)
+	}
+}
+
+func run(addr string, ttl, sweep time.Duration, snapshot string, maxSnapshot int64) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	gc := gache.New[json.RawMessage](gache.WithOrderedKeys[json.RawMessage]()).SetDefaultExpire(ttl).StartExpired(ctx, sweep)
+	defer gc.Close()
+
+	if snapshot != "" {
+		if err := load(gc, snapshot); err != nil {
+			return err
+		}
+	}
+
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           server.New(gc, server.WithMaxSnapshotSize[json.RawMessage](maxSnapshot)),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	errCh := make(chan error, 1)
+	go func() {
+		glg.Infof("gache-server listening on %s", addr)
+		errCh <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+	}
+	glg.Info("shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		return err
+	}
+	if snapshot != "" {
+		return save(gc, snapshot)
+	}
+	return nil
+}
+
+func load(gc gache.Gache[json.RawMessage], path string) error {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := gc.Read(f); err != nil {
+		return err
+	}
+	glg.Infof("loaded %d entries from %s", gc.Len(), path)
+	return nil
+}
+
+// save writes the snapshot to a temporary file first so that a failed write
+// does not destroy the previous snapshot.
+func save(gc gache.Gache[json.RawMessage], path string) error {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if err := gc.Write(context.Background(), f); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	glg.Infof("saved %d entries to %s", gc.Len(), path)
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,786 @@
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/bits"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// This file reads and writes the encoding/gob stream of a map[string]V
+// written by Gache.Write without knowing V. The stream describes every
+// non-builtin type it uses, so values are decoded generically following those
+// descriptions and can be encoded back with the same types.
+
+type (
+	typeID int32
+
+	// wireType mirrors the type description of encoding/gob.
+	wireType struct {
+		kind   wireKind
+		name   string
+		id     typeID
+		elem   typeID
+		key    typeID
+		len    int
+		fields []field
+	}
+
+	wireKind int
+
+	field struct {
+		name string
+		id   typeID
+	}
+
+	// snapshot is the decoded content of a file written by Gache.Write.
+	snapshot struct {
+		types map[typeID]*wireType
+		mapID typeID
+		// entries are sorted by key.
+		entries []entry
+	}
+
+	entry struct {
+		key   string
+		value any
+	}
+
+	// structValue holds the fields of a struct that were transmitted; gob
+	// leaves out zero-valued fields.
+	structValue struct {
+		typ    *wireType
+		fields []fieldValue
+	}
+
+	fieldValue struct {
+		num   int
+		value any
+	}
+
+	// arrayValue, sliceValue and mapValue hold the elements of the gob
+	// composite types.
+	arrayValue []any
+	sliceValue []any
+	mapValue   []mapEntry
+
+	mapEntry struct {
+		key, value any
+	}
+
+	// ifaceValue is a non-nil interface value with the name its concrete type
+	// was registered under.
+	ifaceValue struct {
+		name  string
+		id    typeID
+		value any
+	}
+
+	// encodedValue is the data of a type implementing GobEncoder,
+	// BinaryMarshaler or TextMarshaler.
+	encodedValue struct {
+		typ  *wireType
+		data []byte
+	}
+
+	gobError struct {
+		err error
+	}
+
+	decoder struct {
+		r     *bufio.Reader
+		buf   []byte
+		types map[typeID]*wireType
+	}
+
+	encoder struct {
+		types map[typeID]*wireType
+		buf   []byte
+	}
+)
+
+// Predefined type ids of encoding/gob.
+const (
+	tBool typeID = iota + 1
+	tInt
+	tUint
+	tFloat
+	tBytes
+	tString
+	tComplex
+	tInterface
+
+	firstUserID typeID = 64
+)
+
+const (
+	kindArray wireKind = iota
+	kindSlice
+	kindStruct
+	kindMap
+	kindGobEncoder
+	kindBinaryMarshaler
+	kindTextMarshaler
+)
+
+// maxMessage bounds the messages accepted, as encoding/gob does.
+const maxMessage = 1 << 30
+
+var (
+	errCorrupt     = errors.New("corrupt gob data")
+	errNotSnapshot = errors.New("not a snapshot written by Gache.Write: the value is not a map with string keys")
+)
+
+var builtinNames = map[typeID]string{
+	tBool:      "bool",
+	tInt:       "int",
+	tUint:      "uint",
+	tFloat:     "float",
+	tBytes:     "[]byte",
+	tString:    "string",
+	tComplex:   "complex",
+	tInterface: "interface",
+}
+
+// typeName returns the name gob gives to the type id in types, or describes
+// the type when gob sent no name, as for the types registered by Gache.Write.
+func typeName(types map[typeID]*wireType, id typeID) string {
+	return describe(types, id, true)
+}
+
+// describe returns the name of a type, expanding the fields of unnamed
+// structs only when expand is set so that recursive types terminate.
+func describe(types map[typeID]*wireType, id typeID, expand bool) string {
+	if name, ok := builtinNames[id]; ok {
+		return name
+	}
+	wt, ok := types[id]
+	switch {
+	case !ok:
+		return fmt.Sprintf("type %d", id)
+	case wt.name != "":
+		return wt.name
+	}
+	switch wt.kind {
+	case kindArray:
+		return fmt.Sprintf("[%d]%s", wt.len, describe(types, wt.elem, expand))
+	case kindSlice:
+		return "[]" + describe(types, wt.elem, expand)
+	case kindMap:
+		return fmt.Sprintf("map[%s]%s", describe(types, wt.key, expand), describe(types, wt.elem, expand))
+	case kindStruct:
+		if !expand {
+			return "struct {...}"
+		}
+		fields := make([]string, len(wt.fields))
+		for i, f := range wt.fields {
+			fields[i] = f.name + " " + describe(types, f.id, false)
+		}
+		return "struct { " + strings.Join(fields, "; ") + " }"
+	}
+	return fmt.Sprintf("type %d", id)
+}
+
+// catch turns a gobError panic into *err.
+func catch(err *error) {
+	if r := recover(); r != nil {
+		e, ok := r.(gobError)
+		if !ok {
+			panic(r)
+		}
+		*err = e.err
+	}
+}
+
+func fail(format string, args ...any) {
+	panic(gobError{fmt.Errorf(format, args...)})
+}
+
+// readSnapshot decodes the snapshot in r.
+func readSnapshot(r io.Reader) (s *snapshot, err error) {
+	defer catch(&err)
+	d := &decoder{r: bufio.NewReader(r), types: make(map[typeID]*wireType)}
+	id := d.typeSequence(false)
+	if id < 0 {
+		return nil, io.ErrUnexpectedEOF
+	}
+	wt := d.types[id]
+	if wt == nil || wt.kind != kindMap || wt.key != tString {
+		return nil, errNotSnapshot
+	}
+	if d.uint() != 0 {
+		return nil, errCorrupt
+	}
+	s = &snapshot{types: d.types, mapID: id}
+	n := d.count()
+	s.entries = make([]entry, 0, n)
+	for range n {
+		key := d.string()
+		s.entries = append(s.entries, entry{key: key, value: d.value(wt.elem)})
+	}
+	if len(d.buf) != 0 {
+		return nil, errCorrupt
+	}
+	if _, err := d.r.ReadByte(); err != io.EOF {
+		return nil, errors.New("unexpected data after the snapshot")
+	}
+	s.sort()
+	return s, nil
+}
+
+// sort orders the entries by key and keeps the last of duplicated keys.
+func (s *snapshot) sort() {
+	slices.SortStableFunc(s.entries, func(a, b entry) int { return cmp.Compare(a.key, b.key) })
+	out := s.entries[:0]
+	for i, e := range s.entries {
+		if i+1 < len(s.entries) && s.entries[i+1].key == e.key {
+			continue
+		}
+		out = append(out, e)
+	}
+	s.entries = out
+}
+
+// lookup returns the value of key.
+func (s *snapshot) lookup(key string) (any, bool) {
+	i, ok := slices.BinarySearchFunc(s.entries, key, func(e entry, key string) int { return cmp.Compare(e.key, key) })
+	if !ok {
+		return nil, false
+	}
+	return s.entries[i].value, true
+}
+
+// valueType returns the name of the value type of the snapshot.
+func (s *snapshot) valueType() string {
+	return typeName(s.types, s.types[s.mapID].elem)
+}
+
+// merge adds the types of o to s. It fails if o defines a type id of s
+// differently or holds values of another type.
+func (s *snapshot) merge(o *snapshot) error {
+	if s.mapID != o.mapID || !reflect.DeepEqual(s.types[s.mapID], o.types[o.mapID]) {
+		return fmt.Errorf("values of type %s cannot be merged with values of type %s", o.valueType(), s.valueType())
+	}
+	for id, wt := range o.types {
+		if cur, ok := s.types[id]; ok && !reflect.DeepEqual(cur, wt) {
+			return fmt.Errorf("type %d is %s in one snapshot and %s in the other", id, typeName(s.types, id), typeName(o.types, id))
+		}
+	}
+	for id, wt := range o.types {
+		s.types[id] = wt
+	}
+	return nil
+}
+
+// recvMessage reads the next message of the stream into d.buf.
+func (d *decoder) recvMessage() bool {
+	n, err := readUint(d.r)
+	if err == io.EOF {
+		return false
+	}
+	if err != nil {
+		panic(gobError{err})
+	}
+	if n == 0 || n >= maxMessage {
+		fail("invalid message length %d", n)
+	}
+	d.buf = make([]byte, n)
+	if _, err := io.ReadFull(d.r, d.buf); err != nil {
+		panic(gobError{noEOF(err)})
+	}
+	return true
+}
+
+// typeSequence reads type definitions until the id of a value, as the
+// decodeTypeSequence method of encoding/gob does. It returns -1 at the end of
+// the stream.
+func (d *decoder) typeSequence(isInterface bool) typeID {
+	first := true
+	for {
+		if len(d.buf) == 0 && !d.recvMessage() {
+			if !first {
+				panic(gobError{io.ErrUnexpectedEOF})
+			}
+			return -1
+		}
+		id := typeID(d.int())
+		if id >= 0 {
+			return id
+		}
+		d.recvType(-id)
+		// When decoding an interface, the count of the value may follow.
+		if len(d.buf) > 0 {
+			if !isInterface {
+				panic(gobError{errCorrupt})
+			}
+			d.uint()
+		}
+		first = false
+	}
+}
+
+// recvType decodes the wireType struct defining id.
+func (d *decoder) recvType(id typeID) {
+	if id < firstUserID {
+		fail("invalid type id %d", id)
+	}
+	if _, ok := d.types[id]; ok {
+		fail("duplicate type %d", id)
+	}
+	var wt *wireType
+	d.fields(func(num int) {
+		if wt != nil || num > int(kindTextMarshaler) {
+			panic(gobError{errCorrupt})
+		}
+		wt = &wireType{kind: wireKind(num)}
+		d.fields(func(num int) {
+			switch {
+			case num == 0:
+				d.fields(func(num int) {
+					switch num {
+					case 0:
+						wt.name = d.string()
+					case 1:
+						wt.id = typeID(d.int())
+					default:
+						panic(gobError{errCorrupt})
+					}
+				})
+			case wt.kind == kindArray && num == 1, wt.kind == kindSlice && num == 1, wt.kind == kindMap && num == 2:
+				wt.elem = typeID(d.int())
+			case wt.kind == kindArray && num == 2:
+				wt.len = int(d.int())
+			case wt.kind == kindMap && num == 1:
+				wt.key = typeID(d.int())
+			case wt.kind == kindStruct && num == 1:
+				n := d.count()
+				wt.fields = make([]field, n)
+				for i := range wt.fields {
+					d.fields(func(num int) {
+						switch num {
+						case 0:
+							wt.fields[i].name = d.string()
+						case 1:
+							wt.fields[i].id = typeID(d.int())
+						default:
+							panic(gobError{errCorrupt})
+						}
+					})
+				}
+			default:
+				panic(gobError{errCorrupt})
+			}
+		})
+	})
+	if wt == nil {
+		panic(gobError{errCorrupt})
+	}
+	wt.id = id
+	d.types[id] = wt
+}
+
+// fields calls f with the number of each field of a struct in d.buf.
+func (d *decoder) fields(f func(num int)) {
+	num := -1
+	for {
+		delta := d.uint()
+		if delta == 0 {
+			return
+		}
+		if delta > math.MaxInt32 || num+int(delta) > math.MaxInt32 {
+			panic(gobError{errCorrupt})
+		}
+		num += int(delta)
+		f(num)
+	}
+}
+
+// value decodes a value of type id.
+func (d *decoder) value(id typeID) any {
+	switch id {
+	case tBool:
+		return d.uint() != 0
+	case tInt:
+		return d.int()
+	case tUint:
+		return d.uint()
+	case tFloat:
+		return d.float()
+	case tBytes:
+		return d.bytes()
+	case tString:
+		return d.string()
+	case tComplex:
+		return complex(d.float(), d.float())
+	case tInterface:
+		return d.iface()
+	}
+	wt, ok := d.types[id]
+	if !ok {
+		fail("undefined type %d", id)
+	}
+	switch wt.kind {
+	case kindArray:
+		if n := d.count(); n != wt.len {
+			fail("array of %s has %d elements", wt.name, n)
+		}
+		v := make(arrayValue, wt.len)
+		for i := range v {
+			v[i] = d.value(wt.elem)
+		}
+		return v
+	case kindSlice:
+		v := make(sliceValue, d.count())
+		for i := range v {
+			v[i] = d.value(wt.elem)
+		}
+		return v
+	case kindMap:
+		v := make(mapValue, d.count())
+		for i := range v {
+			v[i].key = d.value(wt.key)
+			v[i].value = d.value(wt.elem)
+		}
+		return v
+	case kindStruct:
+		v := structValue{typ: wt}
+		d.fields(func(num int) {
+			if num >= len(wt.fields) {
+				fail("field %d out of range for %s", num, wt.name)
+			}
+			v.fields = append(v.fields, fieldValue{num: num, value: d.value(wt.fields[num].id)})
+		})
+		return v
+	default:
+		return encodedValue{typ: wt, data: d.bytes()}
+	}
+}
+
+// iface decodes an interface value, which is nil or the name of the
+// concrete type followed by its id and the value as if it were sent alone.
+func (d *decoder) iface() any {
+	name := d.string()
+	if name == "" {
+		return nil
+	}
+	id := d.typeSequence(true)
+	if id < 0 {
+		panic(gobError{io.ErrUnexpectedEOF})
+	}
+	d.uint()
+	return ifaceValue{name: name, id: id, value: d.single(id)}
+}
+
+// single decodes a value sent alone: structs as they are and other types as
+// the field 0 of a struct.
+func (d *decoder) single(id typeID) any {
+	if wt, ok := d.types[id]; !ok || wt.kind != kindStruct {
+		if d.uint() != 0 {
+			panic(gobError{errCorrupt})
+		}
+	}
+	return d.value(id)
+}
+
+func (d *decoder) uint() uint64 {
+	if len(d.buf) == 0 {
+		panic(gobError{io.ErrUnexpectedEOF})
+	}
+	b := d.buf[0]
+	if b < 0x80 {
+		d.buf = d.buf[1:]
+		return uint64(b)
+	}
+	n := -int(int8(b))
+	if n > 8 || len(d.buf) < 1+n {
+		panic(gobError{errCorrupt})
+	}
+	var x uint64
+	for _, c := range d.buf[1 : 1+n] {
+		x = x<<8 | uint64(c)
+	}
+	d.buf = d.buf[1+n:]
+	return x
+}
+
+func (d *decoder) int() int64 {
+	x := d.uint()
+	if x&1 != 0 {
+		return ^int64(x >> 1)
+	}
+	return int64(x >> 1)
+}
+
+func (d *decoder) float() float64 {
+	return math.Float64frombits(bits.ReverseBytes64(d.uint()))
+}
+
+// count reads the length of a composite value, which cannot exceed the
+// bytes left in the message.
+func (d *decoder) count() int {
+	n := d.uint()
+	if n > uint64(len(d.buf)) {
+		panic(gobError{errCorrupt})
+	}
+	return int(n)
+}
+
+func (d *decoder) bytes() []byte {
+	n := d.count()
+	b := append([]byte{}, d.buf[:n]...)
+	d.buf = d.buf[n:]
+	return b
+}
+
+func (d *decoder) string() string {
+	n := d.count()
+	s := string(d.buf[:n])
+	d.buf = d.buf[n:]
+	return s
+}
+
+// readUint reads an unsigned integer of the gob encoding from r.
+func readUint(r io.ByteReader) (uint64, error) {
+	b, err := r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	if b < 0x80 {
+		return uint64(b), nil
+	}
+	n := -int(int8(b))
+	if n > 8 {
+		return 0, errCorrupt
+	}
+	var x uint64
+	for range n {
+		c, err := r.ReadByte()
+		if err != nil {
+			return 0, noEOF(err)
+		}
+		x = x<<8 | uint64(c)
+	}
+	return x, nil
+}
+
+func noEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// writeSnapshot encodes s in the format of Gache.Write. Every type is
+// defined before the map so that values need no type definitions inline.
+func writeSnapshot(w io.Writer, s *snapshot) (err error) {
+	defer catch(&err)
+	e := &encoder{types: s.types}
+	ids := make([]typeID, 0, len(s.types))
+	for id := range s.types {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	bw := bufio.NewWriter(w)
+	for _, id := range ids {
+		e.int(-int64(id))
+		e.wireType(s.types[id])
+		e.flush(bw)
+	}
+	wt := s.types[s.mapID]
+	e.int(int64(s.mapID))
+	e.uint(0)
+	e.uint(uint64(len(s.entries)))
+	for _, ent := range s.entries {
+		e.string(ent.key)
+		e.value(wt.elem, ent.value)
+	}
+	e.flush(bw)
+	return bw.Flush()
+}
+
+// flush writes the buffered message with its length.
+func (e *encoder) flush(w *bufio.Writer) {
+	msg := e.buf
+	e.buf = nil
+	e.uint(uint64(len(msg)))
+	e.buf = append(e.buf, msg...)
+	if _, err := w.Write(e.buf); err != nil {
+		panic(gobError{err})
+	}
+	e.buf = e.buf[:0]
+}
+
+// wireType encodes wt as encoding/gob does, leaving out zero fields.
+func (e *encoder) wireType(wt *wireType) {
+	e.uint(uint64(wt.kind) + 1)
+	last := -1
+	next := func(num int) {
+		e.uint(uint64(num - last))
+		last = num
+	}
+	next(0)
+	e.uint(1)
+	e.string(wt.name)
+	e.uint(1)
+	e.int(int64(wt.id))
+	e.uint(0)
+	switch wt.kind {
+	case kindArray:
+		next(1)
+		e.int(int64(wt.elem))
+		next(2)
+		e.int(int64(wt.len))
+	case kindSlice:
+		next(1)
+		e.int(int64(wt.elem))
+	case kindMap:
+		next(1)
+		e.int(int64(wt.key))
+		next(2)
+		e.int(int64(wt.elem))
+	case kindStruct:
+		next(1)
+		e.uint(uint64(len(wt.fields)))
+		for _, f := range wt.fields {
+			e.uint(1)
+			e.string(f.name)
+			e.uint(1)
+			e.int(int64(f.id))
+			e.uint(0)
+		}
+	}
+	e.uint(0)
+	e.uint(0)
+}
+
+// value encodes v, a value decoded or converted for type id.
+func (e *encoder) value(id typeID, v any) {
+	switch id {
+	case tBool:
+		if v.(bool) {
+			e.uint(1)
+		} else {
+			e.uint(0)
+		}
+		return
+	case tInt:
+		e.int(v.(int64))
+		return
+	case tUint:
+		e.uint(v.(uint64))
+		return
+	case tFloat:
+		e.float(v.(float64))
+		return
+	case tBytes:
+		e.bytes(v.([]byte))
+		return
+	case tString:
+		e.string(v.(string))
+		return
+	case tComplex:
+		c := v.(complex128)
+		e.float(real(c))
+		e.float(imag(c))
+		return
+	case tInterface:
+		e.iface(v)
+		return
+	}
+	wt, ok := e.types[id]
+	if !ok {
+		fail("undefined type %d", id)
+	}
+	switch wt.kind {
+	case kindArray:
+		v := v.(arrayValue)
+		e.uint(uint64(len(v)))
+		for _, elem := range v {
+			e.value(wt.elem, elem)
+		}
+	case kindSlice:
+		v := v.(sliceValue)
+		e.uint(uint64(len(v)))
+		for _, elem := range v {
+			e.value(wt.elem, elem)
+		}
+	case kindMap:
+		v := v.(mapValue)
+		e.uint(uint64(len(v)))
+		for _, me := range v {
+			e.value(wt.key, me.key)
+			e.value(wt.elem, me.value)
+		}
+	case kindStruct:
+		last := -1
+		for _, f := range v.(structValue).fields {
+			e.uint(uint64(f.num - last))
+			last = f.num
+			e.value(wt.fields[f.num].id, f.value)
+		}
+		e.uint(0)
+	default:
+		e.bytes(v.(encodedValue).data)
+	}
+}
+
+// iface encodes an interface value with its concrete value in a message of
+// its own.
+func (e *encoder) iface(v any) {
+	if v == nil {
+		e.uint(0)
+		return
+	}
+	iv := v.(ifaceValue)
+	e.string(iv.name)
+	e.int(int64(iv.id))
+	outer := e.buf
+	e.buf = nil
+	if wt, ok := e.types[iv.id]; !ok || wt.kind != kindStruct {
+		e.uint(0)
+	}
+	e.value(iv.id, iv.value)
+	inner := e.buf
+	e.buf = outer
+	e.bytes(inner)
+}
+
+func (e *encoder) uint(x uint64) {
+	if x < 0x80 {
+		e.buf = append(e.buf, byte(x))
+		return
+	}
+	n := 8 - bits.LeadingZeros64(x)/8
+	e.buf = append(e.buf, byte(-n))
+	for i := n - 1; i >= 0; i-- {
+		e.buf = append(e.buf, byte(x>>(8*i)))
+	}
+}
+
+func (e *encoder) int(x int64) {
+	if x < 0 {
+		e.uint(uint64(^x)<<1 | 1)
+	} else {
+		e.uint(uint64(x) << 1)
+	}
+}
+
+func (e *encoder) float(f float64) {
+	e.uint(bits.ReverseBytes64(math.Float64bits(f)))
+}
+
+func (e *encoder) bytes(b []byte) {
+	e.uint(uint64(len(b)))
+	e.buf = append(e.buf, b...)
+}
+
+func (e *encoder) string(s string) {
+	e.uint(uint64(len(s)))
+	e.buf = append(e.buf, s...)
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// object is a JSON object that keeps the order of its members.
+type object []member
+
+type member struct {
+	name  string
+	value any
+}
+
+// timeName is the name encoding/gob gives to time.Time, which implements
+// GobEncoder.
+const timeName = "Time"
+
+func (o object) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, m := range o {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		name, _ := json.Marshal(m.name)
+		b.Write(name)
+		b.WriteByte(':')
+		v, err := json.Marshal(m.value)
+		if err != nil {
+			return nil, err
+		}
+		b.Write(v)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
+
+// toJSON returns a value that encoding/json marshals as v. Interface values
+// are replaced by their concrete value and struct fields left out by gob are
+// left out. With rawJSON, a []byte holding valid JSON, such as the
+// json.RawMessage values of gache-server, is embedded as it is.
+func toJSON(v any, rawJSON bool) any {
+	switch v := v.(type) {
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return strconv.FormatFloat(v, 'g', -1, 64)
+		}
+		return v
+	case complex128:
+		return [2]any{toJSON(real(v), false), toJSON(imag(v), false)}
+	case []byte:
+		if rawJSON && json.Valid(v) {
+			return json.RawMessage(v)
+		}
+		return v
+	case arrayValue:
+		return toJSONSlice(v, rawJSON)
+	case sliceValue:
+		return toJSONSlice(v, rawJSON)
+	case mapValue:
+		o := make(object, len(v))
+		for i, e := range v {
+			o[i] = member{name: keyString(e.key), value: toJSON(e.value, rawJSON)}
+		}
+		slices.SortFunc(o, func(a, b member) int { return cmp.Compare(a.name, b.name) })
+		return o
+	case structValue:
+		o := make(object, len(v.fields))
+		for i, f := range v.fields {
+			o[i] = member{name: v.typ.fields[f.num].name, value: toJSON(f.value, rawJSON)}
+		}
+		return o
+	case ifaceValue:
+		return toJSON(v.value, rawJSON)
+	case encodedValue:
+		switch {
+		case v.typ.kind == kindTextMarshaler:
+			return string(v.data)
+		case v.typ.name == timeName:
+			var t time.Time
+			if t.GobDecode(v.data) == nil {
+				return t.Format(time.RFC3339Nano)
+			}
+		}
+		return v.data
+	default:
+		return v
+	}
+}
+
+func toJSONSlice(v []any, rawJSON bool) []any {
+	out := make([]any, len(v))
+	for i, elem := range v {
+		out[i] = toJSON(elem, rawJSON)
+	}
+	return out
+}
+
+// keyString returns the JSON object member name of a map key.
+func keyString(k any) string {
+	switch k := k.(type) {
+	case string:
+		return k
+	case int64, uint64, float64, bool:
+		return fmt.Sprint(k)
+	}
+	b, err := json.Marshal(toJSON(k, false))
+	if err != nil {
+		return fmt.Sprint(k)
+	}
+	return string(b)
+}
+
+// fromJSON converts raw to a value of type id of types, as the inverse of
+// toJSON. With rawJSON, a []byte is raw itself rather than a base64 string.
+func fromJSON(types map[typeID]*wireType, id typeID, raw json.RawMessage, rawJSON bool) (any, error) {
+	switch id {
+	case tBool:
+		return unmarshal[bool](raw)
+	case tInt:
+		return unmarshal[int64](raw)
+	case tUint:
+		return unmarshal[uint64](raw)
+	case tFloat:
+		var s string
+		if json.Unmarshal(raw, &s) == nil {
+			return strconv.ParseFloat(s, 64)
+		}
+		return unmarshal[float64](raw)
+	case tBytes:
+		if rawJSON {
+			var b bytes.Buffer
+			if err := json.Compact(&b, raw); err != nil {
+				return nil, err
+			}
+			return b.Bytes(), nil
+		}
+		return unmarshal[[]byte](raw)
+	case tString:
+		return unmarshal[string](raw)
+	case tComplex:
+		var v [2]float64
+		if err := json.Unmarshal(raw, &v); err != nil {
+			return nil, err
+		}
+		return complex(v[0], v[1]), nil
+	case tInterface:
+		if string(raw) == "null" {
+			return nil, nil
+		}
+		return nil, errors.New("cannot convert JSON to an interface value")
+	}
+	wt, ok := types[id]
+	if !ok {
+		return nil, fmt.Errorf("undefined type %d", id)
+	}
+	switch wt.kind {
+	case kindArray, kindSlice:
+		var elems []json.RawMessage
+		if err := json.Unmarshal(raw, &elems); err != nil {
+			return nil, err
+		}
+		if wt.kind == kindArray && len(elems) != wt.len {
+			return nil, fmt.Errorf("%s needs %d elements, got %d", wt.name, wt.len, len(elems))
+		}
+		v := make([]any, len(elems))
+		for i, elem := range elems {
+			var err error
+			if v[i], err = fromJSON(types, wt.elem, elem, false); err != nil {
+				return nil, err
+			}
+		}
+		if wt.kind == kindArray {
+			return arrayValue(v), nil
+		}
+		return sliceValue(v), nil
+	case kindMap:
+		var members map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &members); err != nil {
+			return nil, err
+		}
+		v := make(mapValue, 0, len(members))
+		for name, elem := range members {
+			key, err := parseKey(types, wt.key, name)
+			if err != nil {
+				return nil, err
+			}
+			val, err := fromJSON(types, wt.elem, elem, false)
+			if err != nil {
+				return nil, err
+			}
+			v = append(v, mapEntry{key: key, value: val})
+		}
+		return v, nil
+	case kindStruct:
+		var members map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &members); err != nil {
+			return nil, err
+		}
+		v := structValue{typ: wt}
+		for num, f := range wt.fields {
+			elem, ok := members[f.name]
+			if !ok {
+				continue
+			}
+			delete(members, f.name)
+			if string(elem) == "null" {
+				continue
+			}
+			val, err := fromJSON(types, f.id, elem, false)
+			if err != nil {
+				return nil, fmt.Errorf("%s.%s: %w", wt.name, f.name, err)
+			}
+			v.fields = append(v.fields, fieldValue{num: num, value: val})
+		}
+		for name := range members {
+			return nil, fmt.Errorf("%s has no field %s", wt.name, name)
+		}
+		return v, nil
+	default:
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return nil, err
+		}
+		switch {
+		case wt.kind == kindTextMarshaler:
+			return encodedValue{typ: wt, data: []byte(s)}, nil
+		case wt.name == timeName:
+			t, err := time.Parse(time.RFC3339Nano, s)
+			if err != nil {
+				return nil, err
+			}
+			data, err := t.GobEncode()
+			if err != nil {
+				return nil, err
+			}
+			return encodedValue{typ: wt, data: data}, nil
+		}
+		var data []byte
+		if err := json.Unmarshal(raw, &data); err != nil {
+			return nil, err
+		}
+		return encodedValue{typ: wt, data: data}, nil
+	}
+}
+
+func unmarshal[T any](raw json.RawMessage) (any, error) {
+	var v T
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// parseKey converts the JSON object member name of a map key, as written by
+// keyString, to a value of type id.
+func parseKey(types map[typeID]*wireType, id typeID, name string) (any, error) {
+	switch id {
+	case tString:
+		return name, nil
+	case tInt:
+		return strconv.ParseInt(name, 10, 64)
+	case tUint:
+		return strconv.ParseUint(name, 10, 64)
+	case tFloat:
+		return strconv.ParseFloat(name, 64)
+	case tBool:
+		return strconv.ParseBool(name)
+	}
+	return fromJSON(types, id, json.RawMessage(name), false)
+}
@@ -0,0 +1,507 @@
+// Command gache inspects and edits the snapshot files written by
+// Gache.Write, without a program that knows the type of their values.
+//
+// Usage:
+//
+//	gache stats FILE...
+//	gache dump [-rawjson] FILE
+//	gache get [-rawjson] FILE KEY
+//	gache grep [-values] [-rawjson] PATTERN FILE
+//	gache diff [-rawjson] FILE1 FILE2
+//	gache merge [-o OUT] FILE...
+//	gache convert [-from gob|jsonl] [-to gob|jsonl] [-type TYPE | -like FILE] [-rawjson] [-o OUT] FILE
+//
+// FILE and OUT may be "-" for the standard input and output.
+//
+// dump writes one JSON object with the key and the value of each entry per
+// line, sorted by key. Struct fields that gob leaves out because they are
+// zero are left out, []byte values are base64 strings and time.Time values
+// are RFC 3339 strings. With -rawjson, []byte values holding valid JSON, such
+// as those of gache-server, are written as JSON.
+//
+// get prints the value of KEY. grep prints the entries whose key, or with
+// -values whose value as JSON, matches the regular expression PATTERN. diff
+// prints the keys whose values differ with the value in each file, leaving
+// out the side where the key is missing.
+//
+// merge writes a snapshot of the entries of all files, where the files that
+// come later win; the files must hold values of the same type.
+//
+// convert rewrites a snapshot as JSON lines in the format of dump, or the
+// other way around. Converting JSON lines to gob needs the value type, either
+// from the snapshot -like FILE or as -type, one of string, int, uint, float,
+// bool, bytes, and json for the raw JSON values of gache-server.
+//
+// gache exits with status 1 when get finds no entry, grep matches no entry
+// or diff finds a difference, and with status 2 on errors.
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+)
+
+// exitStatus is returned by commands that succeed with a status other than
+// zero.
+type exitStatus int
+
+func (s exitStatus) Error() string {
+	return fmt.Sprintf("exit status %d", int(s))
+}
+
+const usage = `usage:
+	gache stats FILE...
+	gache dump [-rawjson] FILE
+	gache get [-rawjson] FILE KEY
+	gache grep [-values] [-rawjson] PATTERN FILE
+	gache diff [-rawjson] FILE1 FILE2
+	gache merge [-o OUT] FILE...
+	gache convert [-from gob|jsonl] [-to gob|jsonl] [-type TYPE | -like FILE] [-rawjson] [-o OUT] FILE
+`
+
+// builtinTypes are the value types of convert -type, with the gob type ids
+// of their values.
+var builtinTypes = map[string]struct {
+	name string
+	id   typeID
+}{
+	"string": {"string", tString},
+	"int":    {"int", tInt},
+	"uint":   {"uint", tUint},
+	"float":  {"float64", tFloat},
+	"bool":   {"bool", tBool},
+	"bytes":  {"[]uint8", tBytes},
+	"json":   {"json.RawMessage", tBytes},
+}
+
+func main() {
+	err := run(os.Args[1:], os.Stdin, os.Stdout)
+	var status exitStatus
+	switch {
+	case err == nil:
+	case errors.As(err, &status):
+		os.Exit(int(status))
+	default:
+		fmt.Fprintln(os.Stderr, "gache:", err)
+		os.Exit(2)
+	}
+}
+
+func run(args []string, stdin io.Reader, stdout io.Writer) error {
+	if len(args) == 0 {
+		return errors.New(usage)
+	}
+	cmd, args := args[0], args[1:]
+	fs := flag.NewFlagSet(cmd, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	rawJSON := fs.Bool("rawjson", false, "write []byte values holding valid JSON as JSON")
+	values := fs.Bool("values", false, "match values rather than keys")
+	out := fs.String("o", "-", "output file")
+	from := fs.String("from", "gob", "input format: gob or jsonl")
+	to := fs.String("to", "jsonl", "output format: gob or jsonl")
+	typ := fs.String("type", "", "value type of jsonl input")
+	like := fs.String("like", "", "snapshot with the value type of jsonl input")
+	if err := fs.Parse(args); err != nil {
+		return fmt.Errorf("%w\n%s", err, usage)
+	}
+	args = fs.Args()
+	open := func(name string) (*snapshot, error) {
+		s, err := readFile(name, stdin)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		return s, nil
+	}
+	nargs := func(n int) error {
+		if len(args) != n {
+			return errors.New(usage)
+		}
+		return nil
+	}
+
+	switch cmd {
+	case "stats":
+		if len(args) == 0 {
+			return errors.New(usage)
+		}
+		for _, name := range args {
+			if err := stats(stdout, name, stdin); err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+		}
+		return nil
+	case "dump":
+		if err := nargs(1); err != nil {
+			return err
+		}
+		s, err := open(args[0])
+		if err != nil {
+			return err
+		}
+		return writeJSONL(stdout, s, *rawJSON)
+	case "get":
+		if err := nargs(2); err != nil {
+			return err
+		}
+		s, err := open(args[0])
+		if err != nil {
+			return err
+		}
+		v, ok := s.lookup(args[1])
+		if !ok {
+			return exitStatus(1)
+		}
+		b, err := json.Marshal(toJSON(v, *rawJSON))
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(stdout, "%s\n", b)
+		return err
+	case "grep":
+		if err := nargs(2); err != nil {
+			return err
+		}
+		re, err := regexp.Compile(args[0])
+		if err != nil {
+			return err
+		}
+		s, err := open(args[1])
+		if err != nil {
+			return err
+		}
+		return grep(stdout, s, re, *values, *rawJSON)
+	case "diff":
+		if err := nargs(2); err != nil {
+			return err
+		}
+		a, err := open(args[0])
+		if err != nil {
+			return err
+		}
+		b, err := open(args[1])
+		if err != nil {
+			return err
+		}
+		return diff(stdout, a, b, *rawJSON)
+	case "merge":
+		if len(args) == 0 {
+			return errors.New(usage)
+		}
+		s, err := open(args[0])
+		if err != nil {
+			return err
+		}
+		for _, name := range args[1:] {
+			o, err := open(name)
+			if err != nil {
+				return err
+			}
+			if err := s.merge(o); err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			s.entries = append(s.entries, o.entries...)
+			s.sort()
+		}
+		return create(*out, stdout, func(w io.Writer) error { return writeSnapshot(w, s) })
+	case "convert":
+		if err := nargs(1); err != nil {
+			return err
+		}
+		var s *snapshot
+		switch *from {
+		case "gob":
+			var err error
+			if s, err = open(args[0]); err != nil {
+				return err
+			}
+		case "jsonl":
+			t, raw, err := valueType(*typ, *like, stdin)
+			if err != nil {
+				return err
+			}
+			if err := readJSONLFile(args[0], stdin, t, raw); err != nil {
+				return fmt.Errorf("%s: %w", args[0], err)
+			}
+			s = t
+			*rawJSON = *rawJSON || raw
+		default:
+			return fmt.Errorf("unknown input format %q", *from)
+		}
+		switch *to {
+		case "gob":
+			return create(*out, stdout, func(w io.Writer) error { return writeSnapshot(w, s) })
+		case "jsonl":
+			return create(*out, stdout, func(w io.Writer) error { return writeJSONL(w, s, *rawJSON) })
+		default:
+			return fmt.Errorf("unknown output format %q", *to)
+		}
+	default:
+		return fmt.Errorf("unknown command %q\n%s", cmd, usage)
+	}
+}
+
+// readFile reads the snapshot in the file name, or in stdin for "-".
+func readFile(name string, stdin io.Reader) (*snapshot, error) {
+	if name == "-" {
+		return readSnapshot(stdin)
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return readSnapshot(f)
+}
+
+// create calls write with the file name, created after the input has been
+// read so that it may replace the input, or with stdout for "-".
+func create(name string, stdout io.Writer, write func(io.Writer) error) error {
+	if name == "-" {
+		return write(stdout)
+	}
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func stats(w io.Writer, name string, stdin io.Reader) error {
+	var size int64
+	r := stdin
+	if name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		fi, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		size, r = fi.Size(), f
+	}
+	cr := &countingReader{r: r}
+	s, err := readSnapshot(cr)
+	if err != nil {
+		return err
+	}
+	if name == "-" {
+		size = cr.n
+	}
+	var keyBytes int
+	for _, e := range s.entries {
+		keyBytes += len(e.key)
+	}
+	_, err = fmt.Fprintf(w, "%s: %d entries, %d bytes, %d bytes of keys, values of type %s\n",
+		name, len(s.entries), size, keyBytes, s.valueType())
+	return err
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// line is an entry in the JSON lines format.
+type line struct {
+	Key   string `json:"key"`
+	Value any    `json:"value"`
+}
+
+func writeJSONL(w io.Writer, s *snapshot, rawJSON bool) error {
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	for _, e := range s.entries {
+		if err := enc.Encode(line{Key: e.key, Value: toJSON(e.value, rawJSON)}); err != nil {
+			return fmt.Errorf("%s: %w", e.key, err)
+		}
+	}
+	return bw.Flush()
+}
+
+func grep(w io.Writer, s *snapshot, re *regexp.Regexp, values, rawJSON bool) error {
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	matched := false
+	for _, e := range s.entries {
+		v := toJSON(e.value, rawJSON)
+		subject := e.key
+		if values {
+			b, err := json.Marshal(v)
+			if err != nil {
+				return fmt.Errorf("%s: %w", e.key, err)
+			}
+			subject = string(b)
+		}
+		if !re.MatchString(subject) {
+			continue
+		}
+		matched = true
+		if err := enc.Encode(line{Key: e.key, Value: v}); err != nil {
+			return err
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	if !matched {
+		return exitStatus(1)
+	}
+	return nil
+}
+
+// diff writes the key and both values of every key whose values differ,
+// comparing the JSON of values so that snapshots of different type ids can be
+// compared.
+func diff(w io.Writer, a, b *snapshot, rawJSON bool) error {
+	type change struct {
+		Key string `json:"key"`
+		A   any    `json:"a,omitempty"`
+		B   any    `json:"b,omitempty"`
+	}
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	differ := false
+	emit := func(key string, va, vb any, inA, inB bool) error {
+		c := change{Key: key}
+		if inA {
+			c.A = toJSON(va, rawJSON)
+		}
+		if inB {
+			c.B = toJSON(vb, rawJSON)
+		}
+		if inA && inB {
+			ja, err := json.Marshal(c.A)
+			if err != nil {
+				return err
+			}
+			jb, err := json.Marshal(c.B)
+			if err != nil {
+				return err
+			}
+			if string(ja) == string(jb) {
+				return nil
+			}
+		}
+		differ = true
+		return enc.Encode(c)
+	}
+	i, j := 0, 0
+	for i < len(a.entries) || j < len(b.entries) {
+		var err error
+		switch {
+		case j == len(b.entries) || i < len(a.entries) && a.entries[i].key < b.entries[j].key:
+			err = emit(a.entries[i].key, a.entries[i].value, nil, true, false)
+			i++
+		case i == len(a.entries) || b.entries[j].key < a.entries[i].key:
+			err = emit(b.entries[j].key, nil, b.entries[j].value, false, true)
+			j++
+		default:
+			err = emit(a.entries[i].key, a.entries[i].value, b.entries[j].value, true, true)
+			i++
+			j++
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	if differ {
+		return exitStatus(1)
+	}
+	return nil
+}
+
+// valueType returns the types of a snapshot without entries for the value
+// type given to convert by -type or -like, and whether its []byte values are
+// raw JSON.
+func valueType(typ, like string, stdin io.Reader) (*snapshot, bool, error) {
+	switch {
+	case typ != "" && like != "":
+		return nil, false, errors.New("-type and -like are exclusive")
+	case like != "":
+		s, err := readFile(like, stdin)
+		if err != nil {
+			return nil, false, fmt.Errorf("%s: %w", like, err)
+		}
+		s.entries = nil
+		return s, false, nil
+	case typ != "":
+		t, ok := builtinTypes[typ]
+		if !ok {
+			return nil, false, fmt.Errorf("unknown value type %q", typ)
+		}
+		// Gob matches types by structure, so any user type id will do.
+		id := firstUserID + 1
+		return &snapshot{
+			types: map[typeID]*wireType{id: {
+				kind: kindMap,
+				name: "map[string]" + t.name,
+				id:   id,
+				key:  tString,
+				elem: t.id,
+			}},
+			mapID: id,
+		}, typ == "json", nil
+	}
+	return nil, false, errors.New("converting JSON lines to gob needs -type or -like")
+}
+
+// readJSONLFile reads the JSON lines in the file name into s, converting
+// values to its value type.
+func readJSONLFile(name string, stdin io.Reader, s *snapshot, rawJSON bool) error {
+	r := stdin
+	if name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+	elem := s.types[s.mapID].elem
+	dec := json.NewDecoder(r)
+	for n := 1; ; n++ {
+		var l struct {
+			Key   *string         `json:"key"`
+			Value json.RawMessage `json:"value"`
+		}
+		if err := dec.Decode(&l); err == io.EOF {
+			break
+		} else if err != nil {
+			return fmt.Errorf("entry %d: %w", n, err)
+		}
+		if l.Key == nil {
+			return fmt.Errorf("entry %d: no key", n)
+		}
+		if l.Value == nil {
+			l.Value = json.RawMessage("null")
+		}
+		v, err := fromJSON(s.types, elem, l.Value, rawJSON)
+		if err != nil {
+			return fmt.Errorf("entry %d: %w", n, err)
+		}
+		s.entries = append(s.entries, entry{key: *l.Key, value: v})
+	}
+	s.sort()
+	return nil
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kpango/gache/v2"
+)
+
+type inner struct {
+	ID    uint
+	Ratio float64
+}
+
+type user struct {
+	Name    string
+	Age     int
+	Tags    []string
+	Scores  map[string]int
+	Pair    [2]complex128
+	Created time.Time
+	Extra   any
+	Next    *inner
+}
+
+func init() {
+	gob.Register(inner{})
+}
+
+func users() map[string]user {
+	created := time.Date(2024, 5, 6, 7, 8, 9, 10, time.UTC)
+	return map[string]user{
+		"user:1": {Name: "alice", Age: 30, Tags: []string{"a", "b"}, Scores: map[string]int{"x": -1}, Created: created, Extra: inner{ID: 7, Ratio: 0.5}},
+		"user:2": {Name: "bob", Pair: [2]complex128{1 + 2i, 3}, Extra: "text", Next: &inner{ID: 1}},
+		"user:3": {},
+		"user:4": {Name: "carol", Extra: []string{"x"}, Created: created.Add(time.Hour)},
+	}
+}
+
+// writeFile writes a snapshot of m with Gache.Write to a file in dir.
+func writeFile[V any](t *testing.T, dir, name string, m map[string]V) string {
+	t.Helper()
+	gc := gache.New[V]()
+	defer gc.Close()
+	for k, v := range m {
+		gc.SetWithExpire(k, v, gache.NoTTL)
+	}
+	path := filepath.Join(dir, name)
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer f.Close()
+	if err := gc.Write(context.Background(), f); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return path
+}
+
+func runCmd(t *testing.T, args ...string) (string, error) {
+	t.Helper()
+	var out bytes.Buffer
+	err := run(args, strings.NewReader(""), &out)
+	return out.String(), err
+}
+
+// TestSnapshotRoundTrip verifies that a snapshot decoded without its value
+// type encodes back to a stream that encoding/gob decodes to the same map.
+func TestSnapshotRoundTrip(t *testing.T) {
+	t.Helper()
+	path := writeFile(t, t.TempDir(), "users.gob", users())
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer f.Close()
+	s, err := readSnapshot(f)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(s.entries) != 4 || s.entries[0].key != "user:1" {
+		t.Fatalf("unexpected entries %+v", s.entries)
+	}
+	var buf bytes.Buffer
+	if err := writeSnapshot(&buf, s); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var got map[string]user
+	if err := gob.NewDecoder(&buf).Decode(&got); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := users(); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %+v, got %+v", want, got)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for i := range data {
+		if _, err := readSnapshot(bytes.NewReader(data[:i])); err == nil {
+			t.Fatalf("expected a snapshot truncated to %d bytes to be rejected", i)
+		}
+	}
+	if _, err := readSnapshot(strings.NewReader("not gob")); err == nil {
+		t.Error("expected an error for foreign data")
+	}
+	var other bytes.Buffer
+	gob.NewEncoder(&other).Encode([]string{"a"})
+	if _, err := readSnapshot(&other); !errors.Is(err, errNotSnapshot) {
+		t.Errorf("expected errNotSnapshot, got %v", err)
+	}
+}
+
+// TestInspect verifies the stats, dump, get, grep and diff commands.
+func TestInspect(t *testing.T) {
+	t.Helper()
+	dir := t.TempDir()
+	a := writeFile(t, dir, "a.gob", users())
+	changed := users()
+	delete(changed, "user:3")
+	changed["user:2"] = user{Name: "bobby"}
+	changed["user:5"] = user{Name: "dave"}
+	b := writeFile(t, dir, "b.gob", changed)
+
+	out, err := runCmd(t, "stats", a)
+	if err != nil || !strings.Contains(out, ": 4 entries, ") || !strings.HasSuffix(out, "values of type struct { Name string; Age int; Tags []string; Scores map[string]int; Pair [2]complex128; Created Time; Extra interface; Next inner }\n") {
+		t.Errorf("unexpected stats %q, %v", out, err)
+	}
+
+	out, err = runCmd(t, "dump", a)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	want := `{"key":"user:1","value":{"Name":"alice","Age":30,"Tags":["a","b"],"Scores":{"x":-1},"Pair":[[0,0],[0,0]],"Created":"2024-05-06T07:08:09.00000001Z","Extra":{"ID":7,"Ratio":0.5}}}`
+	if len(lines) != 4 || lines[0] != want || lines[2] != `{"key":"user:3","value":{"Pair":[[0,0],[0,0]]}}` {
+		t.Errorf("unexpected dump %s", out)
+	}
+
+	if out, err = runCmd(t, "get", a, "user:2"); err != nil || out != `{"Name":"bob","Pair":[[1,2],[3,0]],"Extra":"text","Next":{"ID":1}}`+"\n" {
+		t.Errorf("unexpected get %q, %v", out, err)
+	}
+	if _, err = runCmd(t, "get", a, "missing"); err != exitStatus(1) {
+		t.Errorf("expected exit status 1, got %v", err)
+	}
+
+	if out, err = runCmd(t, "grep", "-values", `"carol"`, a); err != nil || !strings.HasPrefix(out, `{"key":"user:4"`) || strings.Count(out, "\n") != 1 {
+		t.Errorf("unexpected grep %q, %v", out, err)
+	}
+	if out, err = runCmd(t, "grep", `^user:[12]$`, a); err != nil || strings.Count(out, "\n") != 2 {
+		t.Errorf("unexpected grep %q, %v", out, err)
+	}
+	if _, err = runCmd(t, "grep", "nothing", a); err != exitStatus(1) {
+		t.Errorf("expected exit status 1, got %v", err)
+	}
+
+	out, err = runCmd(t, "diff", a, b)
+	if err != exitStatus(1) {
+		t.Errorf("expected exit status 1, got %v", err)
+	}
+	want = `{"key":"user:2","a":{"Name":"bob","Pair":[[1,2],[3,0]],"Extra":"text","Next":{"ID":1}},"b":{"Name":"bobby","Pair":[[0,0],[0,0]]}}
+{"key":"user:3","a":{"Pair":[[0,0],[0,0]]}}
+{"key":"user:5","b":{"Name":"dave","Pair":[[0,0],[0,0]]}}
+`
+	if out != want {
+		t.Errorf("expected diff\n%s, got\n%s", want, out)
+	}
+	if _, err = runCmd(t, "diff", a, a); err != nil {
+		t.Errorf("expected no difference, got %v", err)
+	}
+}
+
+// TestEdit verifies the merge and convert commands.
+func TestEdit(t *testing.T) {
+	t.Helper()
+	dir := t.TempDir()
+	a := writeFile(t, dir, "a.gob", users())
+	b := writeFile(t, dir, "b.gob", map[string]user{"user:1": {Name: "alice2"}, "user:9": {Name: "zed"}})
+	merged := filepath.Join(dir, "merged.gob")
+	if _, err := runCmd(t, "merge", "-o", merged, a, b); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	gc := gache.New[user]()
+	defer gc.Close()
+	f, err := os.Open(merged)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer f.Close()
+	if err := gc.Read(f); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if v, _ := gc.Get("user:1"); gc.Len() != 5 || v.Name != "alice2" {
+		t.Errorf("expected 5 entries where b wins, got %d and %+v", gc.Len(), v)
+	}
+	ints := writeFile(t, dir, "ints.gob", map[string]int{"n": 1})
+	if _, err := runCmd(t, "merge", a, ints); err == nil {
+		t.Error("expected snapshots of different value types not to merge")
+	}
+
+	// A snapshot survives a conversion to JSON lines and back.
+	jsonl := filepath.Join(dir, "a.jsonl")
+	if _, err := runCmd(t, "convert", "-o", jsonl, a); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	back := filepath.Join(dir, "back.gob")
+	if _, err := runCmd(t, "convert", "-from", "jsonl", "-to", "gob", "-like", a, "-o", back, jsonl); err == nil {
+		t.Error("expected interface values not to convert from JSON")
+	}
+	plain := users()
+	for k, u := range plain {
+		u.Extra = nil
+		plain[k] = u
+	}
+	a = writeFile(t, dir, "plain.gob", plain)
+	if _, err := runCmd(t, "convert", "-o", jsonl, a); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := runCmd(t, "convert", "-from", "jsonl", "-to", "gob", "-like", a, "-o", back, jsonl); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := runCmd(t, "diff", a, back); err != nil {
+		t.Errorf("expected the conversion to round trip, got %v", err)
+	}
+
+	// The raw JSON values of gache-server.
+	raw := filepath.Join(dir, "raw.jsonl")
+	os.WriteFile(raw, []byte(`{"key":"k","value":{"a": [1, 2]}}`+"\n"), 0o644)
+	server := filepath.Join(dir, "server.gob")
+	if _, err := runCmd(t, "convert", "-from", "jsonl", "-to", "gob", "-type", "json", "-o", server, raw); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	f, err = os.Open(server)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer f.Close()
+	var m map[string]json.RawMessage
+	if err := gob.NewDecoder(f).Decode(&m); err != nil || string(m["k"]) != `{"a":[1,2]}` {
+		t.Errorf("unexpected raw JSON values %q, %v", m, err)
+	}
+	if out, err := runCmd(t, "get", "-rawjson", server, "k"); err != nil || out != `{"a":[1,2]}`+"\n" {
+		t.Errorf("unexpected get %q, %v", out, err)
+	}
+}
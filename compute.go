@@ -0,0 +1,184 @@
+package gache
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/kpango/fastime"
+)
+
+// Op tells [Gache.Compute] and its variants what to do with the value
+// returned by the compute function.
+type Op uint8
+
+const (
+	// OpKeep leaves the entry untouched and discards the returned value.
+	OpKeep Op = iota
+	// OpReplace stores the returned value. An existing entry keeps its
+	// expiration; a new entry uses the cache's default expiration.
+	OpReplace
+	// OpDelete removes the entry.
+	OpDelete
+)
+
+// Compute atomically transforms the entry for key. f receives the current
+// value and whether a non-expired entry exists, and returns the new value
+// together with an [Op] describing whether to keep, replace or delete the
+// entry. Compute returns the value stored for key afterwards and whether the
+// key is present.
+//
+// The update is applied with a compare-and-swap on the entry, so f may be
+// invoked more than once under contention and must not have side effects.
+//
+// Example:
+//
+//	gc := gache.New[[]string]()
+//	gc.Compute("tags", func(old []string, exists bool) ([]string, gache.Op) {
+//	    return append(slices.Clone(old), "new"), gache.OpReplace
+//	})
+func (g *gache[V]) Compute(key string, f func(old V, exists bool) (V, Op)) (actual V, ok bool) {
+	return g.compute(key, f, atomic.LoadInt64(&g.expire))
+}
+
+// ComputeWithExpire is like [Gache.Compute] but an entry created by
+// [OpReplace] expires after d instead of the cache's default expiration.
+// Existing entries keep their expiration.
+//
+// Example:
+//
+//	gc := gache.New[int]()
+//	// Start a new one-minute rate-limit window on first use.
+//	gc.ComputeWithExpire("rl:user1", func(old int, exists bool) (int, gache.Op) {
+//	    return old + 1, gache.OpReplace
+//	}, time.Minute)
+func (g *gache[V]) ComputeWithExpire(key string, f func(old V, exists bool) (V, Op), d time.Duration) (actual V, ok bool) {
+	return g.compute(key, f, int64(d))
+}
+
+// compute implements Compute; ttl is the relative expiration in nanoseconds
+// applied to newly created entries.
+func (g *gache[V]) compute(key string, f func(old V, exists bool) (V, Op), ttl int64) (actual V, ok bool) {
+	shard := g.shards[getShardID(key, g.maxKeyLength)]
+	faulted := false
+	for {
+		var (
+			old                        V
+			exists                     bool
+			expire, sliding, maxExpire int64
+			tags                       []string
+		)
+		cur, loaded := g.loadPointer(shard, key)
+		if loaded {
+			cur.mu.RLock()
+			if cur.key != key {
+				cur.mu.RUnlock()
+				continue
+			}
+			old = cur.val
+			expire = atomic.LoadInt64(&cur.expire)
+			sliding, maxExpire, tags = cur.sliding(), cur.maxExpire(), cur.tags()
+			cur.mu.RUnlock()
+			exists = expire <= 0 || fastime.UnixNanoNow() <= expire
+			if !exists {
+				var zero V
+				old = zero
+			}
+		}
+		if !exists && !faulted && (g.l2 != nil || g.backing != nil) {
+			// Start from the value a lower tier holds for key, as Get would.
+			faulted = true
+			if loaded {
+				g.expiration(key)
+			}
+			g.fault(shard, key)
+			continue
+		}
+
+		nv, op := f(old, exists)
+		switch op {
+		case OpReplace:
+			if !exists {
+				expire, sliding, maxExpire, tags = g.absExpire(ttl), 0, 0, nil
+			}
+			newVal := g.newValue(key, nv, expire, sliding, maxExpire, tags)
+			mu := g.lockKey(key)
+			if loaded {
+				if g.compareAndSwapPointer(shard, key, cur, newVal) {
+					g.storeSet(key, nv)
+					unlockKey(mu)
+					g.putValue(cur)
+					return nv, true
+				}
+				unlockKey(mu)
+				g.putValue(newVal)
+				continue
+			}
+			if _, loaded = g.loadOrStorePointer(shard, key, newVal); !loaded {
+				g.storeSet(key, nv)
+				unlockKey(mu)
+				return nv, true
+			}
+			unlockKey(mu)
+			g.putValue(newVal)
+		case OpDelete:
+			if !loaded {
+				g.dropSpilled(key)
+				return actual, false
+			}
+			mu := g.lockKey(key)
+			if g.compareAndDeletePointer(shard, key, cur) {
+				g.dropSpilled(key)
+				g.storeDelete(key)
+				g.replicateKey(key)
+				unlockKey(mu)
+				g.putValue(cur)
+				if exists {
+					g.removal(context.Background(), key, old)
+				}
+				return actual, false
+			}
+			unlockKey(mu)
+		default:
+			return old, exists
+		}
+	}
+}
+
+// ComputeIfPresent is like [Gache.Compute] but only calls f when a
+// non-expired entry exists for key.
+//
+// Example:
+//
+//	gc := gache.New[int]()
+//	gc.Set("hits", 1)
+//	gc.ComputeIfPresent("hits", func(old int) (int, gache.Op) {
+//	    return old + 1, gache.OpReplace
+//	})
+func (g *gache[V]) ComputeIfPresent(key string, f func(old V) (V, Op)) (actual V, ok bool) {
+	return g.Compute(key, func(old V, exists bool) (V, Op) {
+		if !exists {
+			return old, OpKeep
+		}
+		return f(old)
+	})
+}
+
+// ComputeIfAbsent is like [Gache.Compute] but only calls f when no
+// non-expired entry exists for key. It returns the existing value when the
+// key is present, which makes it suitable for lazily populating the cache.
+//
+// Example:
+//
+//	gc := gache.New[*Config]()
+//	cfg, _ := gc.ComputeIfAbsent("cfg", func() (*Config, gache.Op) {
+//	    return loadConfig(), gache.OpReplace
+//	})
+func (g *gache[V]) ComputeIfAbsent(key string, f func() (V, Op)) (actual V, ok bool) {
+	return g.Compute(key, func(old V, exists bool) (V, Op) {
+		if exists {
+			return old, OpKeep
+		}
+		return f()
+	})
+}
@@ -0,0 +1,130 @@
+package gache
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestGache_Compute verifies that Compute replaces, keeps and deletes entries according to the returned Op.
+func TestGache_Compute(t *testing.T) {
+	t.Helper()
+	gc := New[int]()
+
+	v, ok := gc.Compute("key", func(old int, exists bool) (int, Op) {
+		if exists {
+			t.Errorf("expected key to be absent, got %d", old)
+		}
+		return 1, OpReplace
+	})
+	if !ok || v != 1 {
+		t.Fatalf("expected 1 to be stored, got %d (ok: %t)", v, ok)
+	}
+
+	v, ok = gc.Compute("key", func(old int, exists bool) (int, Op) {
+		return old + 10, OpKeep
+	})
+	if !ok || v != 1 {
+		t.Errorf("expected OpKeep to leave 1, got %d (ok: %t)", v, ok)
+	}
+
+	gc.SetWithExpire("key", 5, time.Hour)
+	_, exp, _ := gc.GetWithExpire("key")
+	gc.Compute("key", func(old int, exists bool) (int, Op) {
+		return old * 2, OpReplace
+	})
+	if v, e, ok := gc.GetWithExpire("key"); !ok || v != 10 || e != exp {
+		t.Errorf("expected 10 with unchanged expire %d, got %d expire %d (ok: %t)", exp, v, e, ok)
+	}
+
+	v, ok = gc.Compute("key", func(old int, exists bool) (int, Op) {
+		return 0, OpDelete
+	})
+	if ok || v != 0 {
+		t.Errorf("expected OpDelete to report absence, got %d (ok: %t)", v, ok)
+	}
+	if _, ok := gc.Get("key"); ok {
+		t.Error("expected key to be deleted")
+	}
+	if l := gc.Len(); l != 0 {
+		t.Errorf("expected length 0 after OpDelete, got %d", l)
+	}
+}
+
+// TestGache_ComputeExpired verifies that an expired entry is presented to Compute as absent.
+func TestGache_ComputeExpired(t *testing.T) {
+	t.Helper()
+	gc := New[string]()
+	gc.SetWithExpire("key", "stale", 50*time.Millisecond)
+	time.Sleep(150 * time.Millisecond)
+
+	v, ok := gc.Compute("key", func(old string, exists bool) (string, Op) {
+		if exists || old != "" {
+			t.Errorf("expected expired entry to be absent, got %q (exists: %t)", old, exists)
+		}
+		return "fresh", OpReplace
+	})
+	if !ok || v != "fresh" {
+		t.Fatalf("expected 'fresh', got %q (ok: %t)", v, ok)
+	}
+	if v, ok := gc.Get("key"); !ok || v != "fresh" {
+		t.Errorf("expected 'fresh' to be readable, got %q (ok: %t)", v, ok)
+	}
+}
+
+// TestGache_ComputeIfPresentAndAbsent verifies that the conditional variants only invoke the function in their respective cases.
+func TestGache_ComputeIfPresentAndAbsent(t *testing.T) {
+	t.Helper()
+	gc := New[int]()
+
+	if _, ok := gc.ComputeIfPresent("key", func(old int) (int, Op) {
+		t.Error("ComputeIfPresent must not call f for an absent key")
+		return 0, OpReplace
+	}); ok {
+		t.Error("expected ComputeIfPresent to report absence")
+	}
+
+	if v, ok := gc.ComputeIfAbsent("key", func() (int, Op) {
+		return 7, OpReplace
+	}); !ok || v != 7 {
+		t.Errorf("expected ComputeIfAbsent to store 7, got %d (ok: %t)", v, ok)
+	}
+
+	if v, ok := gc.ComputeIfAbsent("key", func() (int, Op) {
+		t.Error("ComputeIfAbsent must not call f for a present key")
+		return 0, OpReplace
+	}); !ok || v != 7 {
+		t.Errorf("expected existing 7, got %d (ok: %t)", v, ok)
+	}
+
+	if v, ok := gc.ComputeIfPresent("key", func(old int) (int, Op) {
+		return old + 1, OpReplace
+	}); !ok || v != 8 {
+		t.Errorf("expected 8, got %d (ok: %t)", v, ok)
+	}
+}
+
+// TestGache_ComputeConcurrent verifies that concurrent read-modify-write operations through Compute never lose updates.
+func TestGache_ComputeConcurrent(t *testing.T) {
+	gc := New[int]()
+	const (
+		numGoroutines = 50
+		iterations    = 1000
+	)
+
+	var wg sync.WaitGroup
+	for range numGoroutines {
+		wg.Go(func() {
+			for range iterations {
+				gc.Compute("counter", func(old int, exists bool) (int, Op) {
+					return old + 1, OpReplace
+				})
+			}
+		})
+	}
+	wg.Wait()
+
+	if v, ok := gc.Get("counter"); !ok || v != numGoroutines*iterations {
+		t.Fatalf("expected %d, got %d (ok: %t)", numGoroutines*iterations, v, ok)
+	}
+}
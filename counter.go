@@ -0,0 +1,81 @@
+package gache
+
+import "time"
+
+// Number is the set of value types supported by the counter helpers [Incr],
+// [Decr], [IncrBy] and [DecrBy].
+type Number interface {
+	~int | ~int8 | ~int16 | ~int32 | ~int64 |
+		~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 | ~uintptr |
+		~float32 | ~float64
+}
+
+// Incr atomically increments the counter stored at key by one and returns the
+// new value. A missing or expired counter starts from zero and is created with
+// the cache's default expiration.
+//
+// Example:
+//
+//	gc := gache.New[int64]()
+//	gache.Incr(gc, "hits") // 1
+//	gache.Incr(gc, "hits") // 2
+func Incr[V Number](g Gache[V], key string) V {
+	return IncrBy(g, key, 1)
+}
+
+// Decr atomically decrements the counter stored at key by one and returns the
+// new value. A missing or expired counter starts from zero.
+func Decr[V Number](g Gache[V], key string) V {
+	return DecrBy(g, key, 1)
+}
+
+// IncrBy atomically adds delta to the counter stored at key and returns the
+// new value. A missing or expired counter starts from zero and is created with
+// the cache's default expiration; the expiration of an existing counter is
+// left unchanged.
+//
+// Example:
+//
+//	gc := gache.New[float64]()
+//	gache.IncrBy(gc, "bytes", 1.5)
+func IncrBy[V Number](g Gache[V], key string, delta V) V {
+	v, _ := g.Compute(key, func(old V, _ bool) (V, Op) {
+		return old + delta, OpReplace
+	})
+	return v
+}
+
+// DecrBy atomically subtracts delta from the counter stored at key and
+// returns the new value. It follows the same creation rules as [IncrBy].
+func DecrBy[V Number](g Gache[V], key string, delta V) V {
+	v, _ := g.Compute(key, func(old V, _ bool) (V, Op) {
+		return old - delta, OpReplace
+	})
+	return v
+}
+
+// IncrByWithExpire is like [IncrBy] but a newly created counter expires after
+// d. This is the building block for fixed-window rate limiters: the window
+// starts with the first increment and the counter resets once it expires.
+//
+// Example:
+//
+//	gc := gache.New[int]()
+//	if gache.IncrByWithExpire(gc, "rl:"+user, 1, time.Minute) > 100 {
+//	    return errTooManyRequests
+//	}
+func IncrByWithExpire[V Number](g Gache[V], key string, delta V, d time.Duration) V {
+	v, _ := g.ComputeWithExpire(key, func(old V, _ bool) (V, Op) {
+		return old + delta, OpReplace
+	}, d)
+	return v
+}
+
+// DecrByWithExpire is like [DecrBy] but a newly created counter expires after
+// d.
+func DecrByWithExpire[V Number](g Gache[V], key string, delta V, d time.Duration) V {
+	v, _ := g.ComputeWithExpire(key, func(old V, _ bool) (V, Op) {
+		return old - delta, OpReplace
+	}, d)
+	return v
+}
@@ -0,0 +1,75 @@
+package gache
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestCounter_IncrDecr verifies the basic arithmetic of the counter helpers for integer and float caches.
+func TestCounter_IncrDecr(t *testing.T) {
+	t.Helper()
+	gi := New[int64]()
+	if v := Incr(gi, "n"); v != 1 {
+		t.Errorf("expected 1, got %d", v)
+	}
+	if v := IncrBy(gi, "n", 10); v != 11 {
+		t.Errorf("expected 11, got %d", v)
+	}
+	if v := Decr(gi, "n"); v != 10 {
+		t.Errorf("expected 10, got %d", v)
+	}
+	if v := DecrBy(gi, "n", 15); v != -5 {
+		t.Errorf("expected -5, got %d", v)
+	}
+
+	gf := New[float64]()
+	IncrBy(gf, "f", 1.5)
+	if v := IncrBy(gf, "f", 2.25); v != 3.75 {
+		t.Errorf("expected 3.75, got %v", v)
+	}
+}
+
+// TestCounter_ExpireOnCreate verifies that the TTL is applied only when the counter is created and that an expired counter restarts from zero.
+func TestCounter_ExpireOnCreate(t *testing.T) {
+	t.Helper()
+	gc := New[int]()
+	IncrByWithExpire(gc, "window", 1, 100*time.Millisecond)
+	_, exp, _ := gc.GetWithExpire("window")
+	IncrByWithExpire(gc, "window", 1, time.Hour)
+	if v, e, ok := gc.GetWithExpire("window"); !ok || v != 2 || e != exp {
+		t.Errorf("expected 2 with unchanged expire %d, got %d expire %d (ok: %t)", exp, v, e, ok)
+	}
+
+	time.Sleep(200 * time.Millisecond)
+	if v := IncrByWithExpire(gc, "window", 1, time.Hour); v != 1 {
+		t.Errorf("expected expired counter to restart at 1, got %d", v)
+	}
+}
+
+// TestCounter_Concurrent verifies that concurrent increments and decrements are never lost.
+func TestCounter_Concurrent(t *testing.T) {
+	gc := New[uint64]()
+	const (
+		numGoroutines = 50
+		iterations    = 1000
+	)
+
+	var wg sync.WaitGroup
+	for i := range numGoroutines {
+		wg.Go(func() {
+			for range iterations {
+				IncrBy(gc, "counter", 2)
+				if i%2 == 0 {
+					Decr(gc, "counter")
+				}
+			}
+		})
+	}
+	wg.Wait()
+
+	want := uint64(numGoroutines*iterations*2 - numGoroutines/2*iterations)
+	if v, ok := gc.Get("counter"); !ok || v != want {
+		t.Fatalf("expected %d, got %d (ok: %t)", want, v, ok)
+	}
+}
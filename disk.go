@@ -0,0 +1,396 @@
+package gache
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/kpango/fastime"
+)
+
+type (
+	// DiskTierOption configures the disk tier enabled by [WithDiskTier].
+	DiskTierOption func(*diskStore)
+
+	// diskStore is a log-structured store of encoded values. Records are
+	// appended to a single file and located through an in-memory index;
+	// overwritten, removed and expired records become dead space that is
+	// reclaimed by compacting the file once it outweighs the live records.
+	diskStore struct {
+		mu    sync.Mutex
+		f     *os.File
+		path  string
+		index map[string]diskEntry
+		// queue holds the keys in write order for capacity eviction. Entries
+		// whose seq no longer matches the index are stale and skipped.
+		queue []diskSlot
+		seq   uint64
+		// end is the offset of the next record; dead counts the bytes of
+		// records no longer referenced by the index.
+		end  int64
+		dead int64
+		// n mirrors len(index) so writers can skip locking an empty store.
+		n atomic.Int64
+		// pending tracks the keys with spills reserved but not yet written,
+		// mirrored by reserved; ticket numbers the reservations and cleared
+		// is the last ticket issued before the latest clear.
+		pending    map[string]diskPending
+		reserved   atomic.Int64
+		ticket     uint64
+		cleared    uint64
+		maxEntries int
+		ttl        int64
+	}
+
+	// diskEntry locates a record. expire is when the disk TTL drops it, or 0
+	// without a TTL.
+	diskEntry struct {
+		off    int64
+		size   int64
+		expire int64
+		seq    uint64
+	}
+
+	// diskPending counts the reserved spills of a key; dropped is the last
+	// ticket issued before the key was last dropped, so the spills reserved
+	// up to it are stale.
+	diskPending struct {
+		n       int
+		dropped uint64
+	}
+
+	diskSlot struct {
+		key string
+		seq uint64
+	}
+)
+
+const (
+	// diskHeaderSize is the size of a record header: key length and value
+	// length as uint32 followed by the absolute expiration as int64.
+	diskHeaderSize = 16
+	// diskCompactMin is the amount of dead space below which the log is
+	// never compacted.
+	diskCompactMin = 4 << 20
+)
+
+var errDiskClosed = errors.New("gache: disk tier is closed")
+
+// ErrInvalidDiskCapacity is returned by [WithDiskTier] for a negative
+// [WithDiskCapacity].
+var ErrInvalidDiskCapacity = errors.New("gache: disk capacity must not be negative")
+
+// WithDiskCapacity limits the disk tier to n entries; the oldest spilled
+// entries are dropped first. An n of 0 means no limit, which is the default;
+// a negative n is reported by [NewWithError].
+func WithDiskCapacity(n int) DiskTierOption {
+	return func(d *diskStore) {
+		d.maxEntries = n
+	}
+}
+
+// WithDiskTTL sets how long entries stay in the disk tier after being
+// spilled, regardless of the expiration they had in memory. A non-positive d,
+// the default, keeps them until they are evicted by capacity, promoted or
+// deleted.
+func WithDiskTTL(d time.Duration) DiskTierOption {
+	return func(s *diskStore) {
+		s.ttl = int64(d)
+	}
+}
+
+func openDiskStore(path string, opts ...DiskTierOption) (*diskStore, error) {
+	d := &diskStore{
+		path:    path,
+		index:   make(map[string]diskEntry),
+		pending: make(map[string]diskPending),
+	}
+	for _, opt := range opts {
+		opt(d)
+	}
+	if d.maxEntries < 0 {
+		return nil, ErrInvalidDiskCapacity
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	d.f = f
+	return d, nil
+}
+
+// reserve registers a spill of key that will be written later and returns
+// the ticket to pass to put. Dropping key or clearing the store before the
+// spill is written cancels it.
+func (d *diskStore) reserve(key string) uint64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.ticket++
+	p := d.pending[key]
+	p.n++
+	d.pending[key] = p
+	d.reserved.Store(int64(len(d.pending)))
+	return d.ticket
+}
+
+// settle consumes the reservation ticket of key and reports whether the
+// spill is still current. The caller must hold d.mu.
+func (d *diskStore) settle(key string, ticket uint64) bool {
+	p, ok := d.pending[key]
+	if !ok {
+		return false
+	}
+	if p.n--; p.n == 0 {
+		delete(d.pending, key)
+		d.reserved.Store(int64(len(d.pending)))
+	} else {
+		d.pending[key] = p
+	}
+	return ticket > p.dropped && ticket > d.cleared
+}
+
+// unreserve withdraws a reservation of key that will not be written.
+func (d *diskStore) unreserve(key string, ticket uint64) {
+	d.mu.Lock()
+	d.settle(key, ticket)
+	d.mu.Unlock()
+}
+
+// put appends a record for key, written under the ticket returned by
+// reserve, and makes it the current one unless the spill was cancelled.
+func (d *diskStore) put(key string, val []byte, ticket uint64) error {
+	var expire int64
+	if d.ttl > 0 {
+		expire = fastime.UnixNanoNow() + d.ttl
+	}
+	rec := make([]byte, diskHeaderSize+len(key)+len(val))
+	binary.LittleEndian.PutUint32(rec[0:], uint32(len(key)))
+	binary.LittleEndian.PutUint32(rec[4:], uint32(len(val)))
+	binary.LittleEndian.PutUint64(rec[8:], uint64(expire))
+	copy(rec[diskHeaderSize:], key)
+	copy(rec[diskHeaderSize+len(key):], val)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.settle(key, ticket) {
+		return nil
+	}
+	if d.f == nil {
+		return errDiskClosed
+	}
+	if _, err := d.f.WriteAt(rec, d.end); err != nil {
+		return err
+	}
+	d.remove(key)
+	d.seq++
+	d.index[key] = diskEntry{off: d.end, size: int64(len(rec)), expire: expire, seq: d.seq}
+	d.queue = append(d.queue, diskSlot{key: key, seq: d.seq})
+	d.n.Store(int64(len(d.index)))
+	d.end += int64(len(rec))
+	for d.maxEntries > 0 && len(d.index) > d.maxEntries {
+		d.evictOldest()
+	}
+	if len(d.queue) > 2*len(d.index)+64 {
+		d.queue = slices.DeleteFunc(d.queue, func(slot diskSlot) bool {
+			e, ok := d.index[slot.key]
+			return !ok || e.seq != slot.seq
+		})
+	}
+	return d.maybeCompact()
+}
+
+// take removes key and returns its value if the disk TTL has not passed.
+func (d *diskStore) take(key string) ([]byte, bool) {
+	if d.n.Load() == 0 {
+		return nil, false
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	e, ok := d.index[key]
+	if !ok || d.f == nil {
+		return nil, false
+	}
+	d.remove(key)
+	return d.read(e)
+}
+
+// get returns the value of key like take, along with the absolute time the
+// disk TTL drops it and the seq of its record, without removing it.
+func (d *diskStore) get(key string) (val []byte, expire int64, seq uint64, ok bool) {
+	if d.n.Load() == 0 {
+		return nil, 0, 0, false
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	e, ok := d.index[key]
+	if !ok || d.f == nil {
+		return nil, 0, 0, false
+	}
+	val, ok = d.read(e)
+	return val, e.expire, e.seq, ok
+}
+
+// read returns the value of the record of e unless it has expired. The
+// caller must hold d.mu.
+func (d *diskStore) read(e diskEntry) ([]byte, bool) {
+	if e.expired(fastime.UnixNanoNow()) {
+		return nil, false
+	}
+	rec := make([]byte, e.size)
+	if _, err := d.f.ReadAt(rec, e.off); err != nil && !errors.Is(err, io.EOF) {
+		return nil, false
+	}
+	return rec[diskHeaderSize+binary.LittleEndian.Uint32(rec[0:]):], true
+}
+
+// keys returns the keys of the records in the store, live or not.
+func (d *diskStore) keys() []string {
+	if d.n.Load() == 0 {
+		return nil
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return slices.Collect(maps.Keys(d.index))
+}
+
+// dropSeq removes key if its current record is still the one numbered seq,
+// as returned by get, and reports whether it did.
+func (d *diskStore) dropSeq(key string, seq uint64) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if e, ok := d.index[key]; ok && e.seq == seq {
+		d.remove(key)
+		return true
+	}
+	return false
+}
+
+func (e diskEntry) expired(now int64) bool {
+	return e.expire > 0 && now > e.expire
+}
+
+// drop removes key if present and cancels its reserved spills.
+func (d *diskStore) drop(key string) {
+	if d.n.Load() == 0 && d.reserved.Load() == 0 {
+		return
+	}
+	d.mu.Lock()
+	d.remove(key)
+	if p, ok := d.pending[key]; ok {
+		p.dropped = d.ticket
+		d.pending[key] = p
+	}
+	d.mu.Unlock()
+}
+
+// remove unindexes key. The caller must hold d.mu.
+func (d *diskStore) remove(key string) {
+	if e, ok := d.index[key]; ok {
+		delete(d.index, key)
+		d.dead += e.size
+		d.n.Store(int64(len(d.index)))
+	}
+}
+
+// evictOldest removes the oldest live entry. The caller must hold d.mu.
+func (d *diskStore) evictOldest() {
+	for len(d.queue) > 0 {
+		slot := d.queue[0]
+		d.queue = d.queue[1:]
+		if e, ok := d.index[slot.key]; ok && e.seq == slot.seq {
+			d.remove(slot.key)
+			return
+		}
+	}
+}
+
+// maybeCompact compacts the log when dead records outweigh live ones. The
+// caller must hold d.mu.
+func (d *diskStore) maybeCompact() error {
+	if d.dead < diskCompactMin || d.dead < d.end-d.dead {
+		return nil
+	}
+	return d.compact()
+}
+
+// compact rewrites the live, non-expired records into a new file that
+// replaces the log. The caller must hold d.mu.
+func (d *diskStore) compact() error {
+	tmp := d.path + ".compact"
+	f, err := os.OpenFile(tmp, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	now := fastime.UnixNanoNow()
+	index := make(map[string]diskEntry, len(d.index))
+	queue := make([]diskSlot, 0, len(d.index))
+	var end int64
+	for _, slot := range d.queue {
+		e, ok := d.index[slot.key]
+		if !ok || e.seq != slot.seq || e.expired(now) {
+			continue
+		}
+		rec := make([]byte, e.size)
+		if _, err = d.f.ReadAt(rec, e.off); err == nil {
+			_, err = f.WriteAt(rec, end)
+		}
+		if err != nil {
+			f.Close()
+			os.Remove(tmp)
+			return err
+		}
+		e.off = end
+		index[slot.key] = e
+		queue = append(queue, slot)
+		end += e.size
+	}
+	if err = os.Rename(tmp, d.path); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	d.f.Close()
+	d.f, d.index, d.queue = f, index, queue
+	d.end, d.dead = end, 0
+	d.n.Store(int64(len(index)))
+	return nil
+}
+
+// clear drops every entry, cancels the reserved spills and truncates the
+// log.
+func (d *diskStore) clear() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.cleared = d.ticket
+	clear(d.index)
+	d.queue = nil
+	d.end, d.dead = 0, 0
+	d.n.Store(0)
+	if d.f != nil {
+		_ = d.f.Truncate(0)
+	}
+}
+
+// close closes and removes the log file.
+func (d *diskStore) close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.f == nil {
+		return nil
+	}
+	err := d.f.Close()
+	d.f = nil
+	clear(d.index)
+	d.queue = nil
+	d.n.Store(0)
+	if rerr := os.Remove(d.path); err == nil {
+		err = rerr
+	}
+	return err
+}
@@ -0,0 +1,86 @@
+package gache
+
+import (
+	"errors"
+	"math/rand/v2"
+	"sync/atomic"
+)
+
+// evictor keeps the number of entries of the cache at or below max by
+// removing an arbitrary entry whenever a new key would exceed it. count is
+// maintained by the insert and release notifications and tracks the live
+// values, which is the number of entries plus the values of writes in
+// flight.
+type evictor[V any] struct {
+	g     *gache[V]
+	max   int64
+	count atomic.Int64
+}
+
+// ErrInvalidMaxEntries is returned by [WithMaxEntries] for a negative limit.
+var ErrInvalidMaxEntries = errors.New("gache: max entries must not be negative")
+
+// WithMaxEntries limits the cache to about n entries. When a write adds a
+// new key to a full cache, an arbitrary other entry is evicted, spilling to
+// the disk tier when one is configured with [WithDiskTier]. The limit is
+// enforced without locking, so concurrent writers may overshoot it briefly.
+// An n of 0 means no limit, which is the default; a negative n is reported
+// by [NewWithError].
+func WithMaxEntries[V any](n int) Option[V] {
+	return func(g *gache[V]) error {
+		if n < 0 {
+			return ErrInvalidMaxEntries
+		}
+		if n > 0 && g.evictor == nil {
+			g.evictor = &evictor[V]{g: g, max: int64(n)}
+			g.addObserver(g.evictor)
+		}
+		return nil
+	}
+}
+
+func (e *evictor[V]) insert(key string, _ V, _ []string) {
+	if e.count.Add(1) <= e.max {
+		return
+	}
+	g := e.g
+	if _, ok := g.shards[getShardID(key, g.maxKeyLength)].LoadPointer(key); ok {
+		// Overwriting an existing key does not grow the cache.
+		return
+	}
+	g.evict(key)
+}
+
+func (e *evictor[V]) release(string, V, []string) {
+	e.count.Add(-1)
+}
+
+// evict removes an arbitrary entry other than skip, starting at a random
+// shard, and spills it to the disk tier if enabled and it has no tags.
+func (g *gache[V]) evict(skip string) {
+	start := rand.IntN(slen)
+	for i := range slen {
+		shard := g.shards[(start+i)&mask]
+		evicted := false
+		shard.RangePointer(func(k string, v *value[V]) bool {
+			if k == skip {
+				return true
+			}
+			v.mu.RLock()
+			match, val, tagged := v.key == k, v.val, len(v.tags()) > 0
+			v.mu.RUnlock()
+			if match && shard.CompareAndDeletePointer(k, v) {
+				g.putValue(v)
+				if !tagged {
+					g.spill(k, val)
+				}
+				evicted = true
+				return false
+			}
+			return true
+		})
+		if evicted {
+			return
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package gache
+
+import (
+	"strconv"
+	"testing"
+)
+
+// TestGache_MaxEntries verifies that new keys evict other entries once the cache is full.
+func TestGache_MaxEntries(t *testing.T) {
+	t.Helper()
+	gc := New[int](WithMaxEntries[int](10))
+	for i := range 100 {
+		gc.Set(strconv.Itoa(i), i)
+	}
+	if l := gc.Len(); l != 10 {
+		t.Errorf("expected 10 entries, got %d", l)
+	}
+	if v, ok := gc.Get("99"); !ok || v != 99 {
+		t.Errorf("expected the latest key to be kept, got %d (ok: %t)", v, ok)
+	}
+}
+
+// TestGache_MaxEntriesOverwrite verifies that overwriting keys of a full cache evicts nothing.
+func TestGache_MaxEntriesOverwrite(t *testing.T) {
+	t.Helper()
+	gc := New[int](WithMaxEntries[int](10))
+	for i := range 10 {
+		gc.Set(strconv.Itoa(i), i)
+	}
+	for i := range 50 {
+		gc.Set(strconv.Itoa(i%10), i)
+		gc.GetRefresh(strconv.Itoa(i % 10))
+	}
+	for i := range 10 {
+		if _, ok := gc.Get(strconv.Itoa(i)); !ok {
+			t.Errorf("expected key %d to remain", i)
+		}
+	}
+}
+
+// TestGache_MaxEntriesCount verifies that the entry count follows deletes and
+// that keys replacing deleted ones evict nothing.
+func TestGache_MaxEntriesCount(t *testing.T) {
+	t.Helper()
+	gc := New[int](WithMaxEntries[int](10)).(*gache[int])
+	for i := range 10 {
+		gc.Set(strconv.Itoa(i), i)
+	}
+	for i := range 5 {
+		gc.Delete(strconv.Itoa(i))
+		gc.SetIfNotExists(strconv.Itoa(i+5), i)
+	}
+	for i := range 5 {
+		gc.Set(strconv.Itoa(i+10), i)
+	}
+	if n := gc.evictor.count.Load(); n != 10 || gc.Len() != 10 {
+		t.Errorf("expected a count of 10 for 10 entries, got %d for %d", n, gc.Len())
+	}
+	for i := 5; i < 15; i++ {
+		if _, ok := gc.Get(strconv.Itoa(i)); !ok {
+			t.Errorf("expected key %d to remain", i)
+		}
+	}
+}
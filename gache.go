@@ -18,9 +18,14 @@ package gache
 import (
 	"context"
 	"encoding/gob"
+	"errors"
 	"hash/maphash"
 	"io"
+	"iter"
+	"math/rand/v2"
+	"reflect"
 	"runtime"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -41,6 +46,8 @@ type (
 		Clear()
 		Delete(string) (V, bool)
 		DeleteExpired(context.Context) uint64
+		DeleteIf(context.Context, func(string, V, int64) bool) uint64
+		DeletePrefix(context.Context, string) uint64
 		DisableExpiredHook() Gache[V]
 		EnableExpiredHook() Gache[V]
 		Range(context.Context, func(string, V, int64) bool) Gache[V]
@@ -66,8 +73,50 @@ type (
 		Keys(context.Context) []string
 		Values(context.Context) []V
 		Pop(string) (V, bool)
-		SetIfNotExists(string, V)
-		SetWithExpireIfNotExists(string, V, time.Duration)
+		SetIfNotExists(string, V) bool
+		SetWithExpireIfNotExists(string, V, time.Duration) bool
+		SetIfExists(string, V) bool
+		SetWithExpireIfExists(string, V, time.Duration) bool
+		GetAndSet(string, V) (V, bool)
+		CompareAndDelete(string, V, func(V, V) bool) bool
+		SetWithDeadline(string, V, time.Time)
+		SetWithSlidingExpire(string, V, time.Duration, time.Duration)
+
+		Compute(string, func(V, bool) (V, Op)) (V, bool)
+		ComputeIfAbsent(string, func() (V, Op)) (V, bool)
+		ComputeIfPresent(string, func(V) (V, Op)) (V, bool)
+		ComputeWithExpire(string, func(V, bool) (V, Op), time.Duration) (V, bool)
+
+		GetVersioned(string) (V, uint64, bool)
+		SetIfVersion(string, V, uint64) bool
+		SetWithExpireIfVersion(string, V, time.Duration, uint64) bool
+		DeleteIfVersion(string, uint64) bool
+
+		GetMulti(...string) (map[string]V, []string)
+		SetMulti(map[string]V)
+		SetMultiWithExpire(...Entry[V])
+		DeleteMulti(...string) map[string]V
+
+		Txn(func(Tx[V]) error) error
+
+		SetWithTags(string, V, time.Duration, ...string)
+		InvalidateTag(string) uint64
+
+		ScanPrefix(context.Context, string) []string
+		ScanRange(context.Context, string, string, int) []string
+		Scan(uint64, int, string) ([]string, uint64)
+
+		All(context.Context) iter.Seq2[string, V]
+		KeysSeq(context.Context) iter.Seq[string]
+		ValuesSeq(context.Context) iter.Seq[V]
+
+		AddIndex(string, func(V) []string) error
+		GetBy(string, string) []V
+
+		Namespace(string, ...NamespaceOption[V]) Gache[V]
+		NamespaceStats(string) (NamespaceStats, bool)
+
+		Close() error
 	}
 
 	// gache is base instance type.
@@ -81,6 +130,37 @@ type (
 		expire         int64
 		maxKeyLength   uint64
 		maxWorkers     int
+		ttlJitter      float64
+		version        atomic.Uint64
+		// gates serialise the commits of transactions on each shard; they
+		// are allocated by the first commit or by WithTxnIsolation, which
+		// also sets isolated to make plain operations pass them.
+		gates    atomic.Pointer[[slen]shardGate]
+		isolated bool
+		// observers are notified whenever a value enters or leaves the cache.
+		observers atomic.Pointer[[]observer[V]]
+		tagIndex  atomic.Pointer[keyIndex[V]]
+		tagOnce   sync.Once
+		ordered   *orderedIndex[V]
+		indexes   Map[string, keyIndex[V]]
+		// namespaces holds the views returned by Namespace, keyed by name.
+		namespaces namespaceRegistry[V]
+		nsOnce     sync.Once
+		// evictor enforces WithMaxEntries, and l2 is the disk tier of
+		// WithDiskTier with spills its writer; all are nil when disabled.
+		evictor *evictor[V]
+		l2      *diskStore
+		spills  *spillWriter[V]
+		// backing is the Store configured with WithStore, or nil.
+		backing *backing[V]
+		// primary and replica are the replication roles configured with
+		// WithReplicationPrimary and WithReplicationReplica, or nil.
+		primary *primary[V]
+		replica *replica[V]
+		// invalidator is the Bus configured with WithInvalidationBus, or nil.
+		invalidator *invalidator[V]
+		// removeFunc is the removal hook set with WithRemovalHookFunc.
+		removeFunc func(context.Context, string, V)
 	}
 
 	value[V any] struct {
@@ -88,6 +168,28 @@ type (
 		key    string
 		val    V
 		expire int64
+		// version identifies the stored value; it is taken from the cache-wide
+		// counter whenever the value is written and is never 0.
+		version uint64
+		// x holds the metadata of the optional features the entry uses. It
+		// stays nil for values that never used one and is kept, zeroed, when
+		// the value returns to the pool.
+		x *valueExtra[V]
+	}
+
+	// valueExtra is the metadata of a value that plain entries do not need.
+	valueExtra[V any] struct {
+		// sliding is the TTL in nanoseconds re-applied on every successful
+		// read; 0 disables sliding expiration for the entry.
+		sliding int64
+		// maxExpire is the absolute unix-nano upper bound for expire; 0 means
+		// the entry has no maximum lifetime.
+		maxExpire int64
+		// tags are the invalidation tags attached by SetWithTags.
+		tags []string
+		// obs are the observers notified when the value was initialised,
+		// which are the ones notified again when it is released.
+		obs *[]observer[V]
 	}
 
 	kv[V any] struct {
@@ -125,7 +227,8 @@ var hashSeed = maphash.MakeSeed()
 // New creates and returns a new [Gache] instance parameterised over the value
 // type V. By default the cache uses a 30-second TTL and a maximum key length
 // of 256 bytes for shard selection. These defaults can be overridden by passing
-// functional [Option] values.
+// functional [Option] values. New ignores the errors of options, which leave
+// the cache as it was; use [NewWithError] to have them reported.
 //
 // Example:
 //
@@ -138,6 +241,38 @@ var hashSeed = maphash.MakeSeed()
 //	    gache.WithMaxKeyLength[string](128),
 //	)
 func New[V any](opts ...Option[V]) Gache[V] {
+	g, _ := newGache(opts)
+	return g
+}
+
+// NewWithError is like [New] but returns the errors of all options, joined
+// with [errors.Join], together with the settings that are invalid on their
+// own or in combination, such as a negative [WithMaxWorkers] or a cache that
+// is both a replication primary and a replica. On error the cache is closed
+// and nil is returned.
+//
+// Example:
+//
+//	gc, err := gache.NewWithError[string](
+//	    gache.WithDefaultExpirationString[string](os.Getenv("CACHE_TTL")),
+//	    gache.WithTTLJitter[string](0.1),
+//	)
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	defer gc.Close()
+func NewWithError[V any](opts ...Option[V]) (Gache[V], error) {
+	g, err := newGache(opts)
+	if err = errors.Join(err, g.validate()); err != nil {
+		g.Close()
+		return nil, err
+	}
+	return g, nil
+}
+
+// newGache applies the default options and then opts to a new cache,
+// applying every option even after one fails.
+func newGache[V any](opts []Option[V]) (*gache[V], error) {
 	g := new(gache[V])
 	g.valPool = &sync.Pool{
 		New: func() any {
@@ -147,15 +282,18 @@ func New[V any](opts ...Option[V]) Gache[V] {
 	for i := range g.shards {
 		g.shards[i] = newMap[V]()
 	}
+	var errs []error
 	for _, opt := range append([]Option[V]{
 		WithDefaultExpiration[V](30 * time.Second),
 		WithMaxKeyLength[V](256),
 		WithMaxWorkers[V](runtime.NumCPU() * 2),
 	}, opts...) {
-		opt(g)
+		if err := opt(g); err != nil {
+			errs = append(errs, err)
+		}
 	}
 	g.expChan = make(chan kv[V], len(g.shards)*10)
-	return g
+	return g, errors.Join(errs...)
 }
 
 func newMap[V any]() (m *Map[string, value[V]]) {
@@ -199,9 +337,76 @@ func (v *value[V]) reset() {
 	v.key = ""
 	v.val = zero
 	atomic.StoreInt64(&v.expire, 0)
+	v.version = 0
+	if v.x != nil {
+		*v.x = valueExtra[V]{}
+	}
 	v.mu.Unlock()
 }
 
+// setExtra sets the optional metadata of v, allocating v.x only when one of
+// them is set. The caller must hold v.mu.
+func (v *value[V]) setExtra(sliding, maxExpire int64, tags []string, obs *[]observer[V]) {
+	if v.x == nil {
+		if sliding == 0 && maxExpire == 0 && len(tags) == 0 && obs == nil {
+			return
+		}
+		v.x = new(valueExtra[V])
+	}
+	*v.x = valueExtra[V]{sliding: sliding, maxExpire: maxExpire, tags: tags, obs: obs}
+}
+
+// The accessors below read the optional metadata of v and return the zero
+// value when it is unset. The caller must hold v.mu.
+
+func (v *value[V]) sliding() int64 {
+	if v.x == nil {
+		return 0
+	}
+	return v.x.sliding
+}
+
+func (v *value[V]) maxExpire() int64 {
+	if v.x == nil {
+		return 0
+	}
+	return v.x.maxExpire
+}
+
+func (v *value[V]) tags() []string {
+	if v.x == nil {
+		return nil
+	}
+	return v.x.tags
+}
+
+func (v *value[V]) observers() *[]observer[V] {
+	if v.x == nil {
+		return nil
+	}
+	return v.x.obs
+}
+
+// clamp bounds expire by the entry's maximum lifetime, if any. The caller must
+// hold v.mu.
+func (v *value[V]) clamp(expire int64) int64 {
+	if maxExpire := v.maxExpire(); maxExpire > 0 && (expire <= 0 || expire > maxExpire) {
+		return maxExpire
+	}
+	return expire
+}
+
+// slide pushes the expiration of a sliding entry forward to now+sliding,
+// bounded by maxExpire. The deadline never moves backwards. The caller must
+// hold v.mu (read lock is sufficient) and it returns the resulting deadline.
+func (v *value[V]) slide(now, expire int64) int64 {
+	next := v.clamp(now + v.sliding())
+	if next > expire && atomic.CompareAndSwapInt64(&v.expire, expire, next) {
+		return next
+	}
+	return atomic.LoadInt64(&v.expire)
+}
+
 // SetDefaultExpire sets the default expiration duration used by [Gache.Set] and
 // other methods that do not accept an explicit TTL. The change takes effect
 // immediately for all subsequent writes. It returns the receiver so calls can
@@ -298,7 +503,7 @@ func (g *gache[V]) StartExpired(ctx context.Context, dur time.Duration) Gache[V]
 				return
 			case ex := <-g.expChan:
 				eg.Go(func() error {
-					g.expFunc(egctx, ex.key, ex.value)
+					g.fireExpiredHook(egctx, ex.key, ex.value)
 					return nil
 				})
 			case <-tick.C:
@@ -442,7 +647,24 @@ func (g *gache[V]) Values(ctx context.Context) (values []V) {
 
 // get returns value & exists from key.
 func (g *gache[V]) get(key string) (v V, expire int64, ok bool) {
-	val, ok := g.shards[getShardID(key, g.maxKeyLength)].LoadPointer(key)
+	return g.getFrom(g.shards[getShardID(key, g.maxKeyLength)], key)
+}
+
+// getFrom returns value & exists from key stored in shard, falling back to
+// the disk tier and the backing store on a miss.
+func (g *gache[V]) getFrom(shard *Map[string, value[V]], key string) (v V, expire int64, ok bool) {
+	if v, expire, ok = g.lookup(shard, key); ok || (g.l2 == nil && g.backing == nil) {
+		return v, expire, ok
+	}
+	if v, expire, ok = g.promote(shard, key); ok {
+		return v, expire, ok
+	}
+	return g.load(shard, key)
+}
+
+// lookup returns value & exists from key stored in shard.
+func (g *gache[V]) lookup(shard *Map[string, value[V]], key string) (v V, expire int64, ok bool) {
+	val, ok := g.loadPointer(shard, key)
 	if !ok {
 		return v, 0, false
 	}
@@ -454,6 +676,11 @@ func (g *gache[V]) get(key string) (v V, expire int64, ok bool) {
 	}
 	v = val.val
 	expire = atomic.LoadInt64(&val.expire)
+	if val.x != nil && val.x.sliding > 0 && expire > 0 {
+		if now := fastime.UnixNanoNow(); now <= expire {
+			expire = val.slide(now, expire)
+		}
+	}
 	val.mu.RUnlock()
 
 	if expire <= 0 || fastime.UnixNanoNow() <= expire {
@@ -498,22 +725,103 @@ func (g *gache[V]) GetWithExpire(key string) (v V, expire int64, ok bool) {
 	return g.get(key)
 }
 
+// jitter shortens a positive ttl by a random amount of up to ttlJitter*ttl
+// so that entries written together do not all expire in the same sweep.
+func (g *gache[V]) jitter(ttl int64) int64 {
+	if g.ttlJitter <= 0 || ttl <= 0 {
+		return ttl
+	}
+	if window := int64(float64(ttl) * g.ttlJitter); window > 0 {
+		return ttl - rand.Int64N(window+1)
+	}
+	return ttl
+}
+
+// absExpire converts a relative ttl in nanoseconds to the absolute unix-nano
+// expiration stored in value. Non-positive ttls mean no expiration.
+func (g *gache[V]) absExpire(ttl int64) int64 {
+	if ttl > 0 {
+		return fastime.UnixNanoNow() + g.jitter(ttl)
+	}
+	return ttl
+}
+
 // set sets key-value & expiration to Gache.
 func (g *gache[V]) set(key string, val V, expire int64) {
-	if expire > 0 {
-		expire = fastime.UnixNanoNow() + expire
-	}
-	shard := g.shards[getShardID(key, g.maxKeyLength)]
+	g.store(key, val, g.absExpire(expire), 0, 0, nil)
+}
+
+// newValue takes a value from the pool and initialises it with key-value, an
+// absolute unix-nano expiration, the sliding expiration parameters and tags.
+// Every value obtained from newValue or copyValue must eventually be handed to
+// putValue, whether or not it was published to a shard.
+func (g *gache[V]) newValue(key string, val V, expire, sliding, maxExpire int64, tags []string) *value[V] {
 	newVal := g.valPool.Get().(*value[V])
 	newVal.mu.Lock()
 	newVal.key = key
 	newVal.val = val
 	atomic.StoreInt64(&newVal.expire, expire)
+	newVal.version = g.version.Add(1)
+	obs := g.observers.Load()
+	newVal.setExtra(sliding, maxExpire, tags, obs)
+	newVal.mu.Unlock()
+	notifyInsert(obs, key, val, tags)
+	return newVal
+}
+
+// copyValue returns a new value holding the same entry as val, including its
+// version, with the expiration replaced by expire(old expiration) bounded by
+// the entry's maximum lifetime. It reports false if val no longer holds key.
+func (g *gache[V]) copyValue(key string, val *value[V], expire func(int64) int64) (newVal *value[V], ok bool) {
+	val.mu.RLock()
+	if val.key != key {
+		val.mu.RUnlock()
+		return nil, false
+	}
+	newVal = g.valPool.Get().(*value[V])
+	newVal.mu.Lock()
+	newVal.key = key
+	newVal.val = val.val
+	newVal.version = val.version
+	tags, obs := val.tags(), g.observers.Load()
+	newVal.setExtra(val.sliding(), val.maxExpire(), tags, obs)
+	atomic.StoreInt64(&newVal.expire, newVal.clamp(expire(atomic.LoadInt64(&val.expire))))
 	newVal.mu.Unlock()
-	old, loaded := shard.SwapPointer(key, newVal)
+	val.mu.RUnlock()
+	notifyInsert(obs, key, newVal.val, tags)
+	return newVal, true
+}
+
+// putValue resets v and returns it to the pool once it has been removed
+// from, or never made it into, a shard.
+func (g *gache[V]) putValue(v *value[V]) {
+	v.mu.RLock()
+	key, val, tags, obs := v.key, v.val, v.tags(), v.observers()
+	v.mu.RUnlock()
+	if obs != nil {
+		for _, o := range *obs {
+			o.release(key, val, tags)
+		}
+	}
+	v.reset()
+	g.valPool.Put(v)
+}
+
+// store sets key-value with an absolute unix-nano expiration, the sliding
+// expiration parameters and the tags of the entry.
+func (g *gache[V]) store(key string, val V, expire, sliding, maxExpire int64, tags []string) {
+	g.storeTo(g.shards[getShardID(key, g.maxKeyLength)], key, val, expire, sliding, maxExpire, tags)
+}
+
+// storeTo is store for a key that belongs to shard.
+func (g *gache[V]) storeTo(shard *Map[string, value[V]], key string, val V, expire, sliding, maxExpire int64, tags []string) {
+	newVal := g.newValue(key, val, expire, sliding, maxExpire, tags)
+	mu := g.lockKey(key)
+	old, loaded := g.swapPointer(shard, key, newVal)
+	g.storeSet(key, val)
+	unlockKey(mu)
 	if loaded {
-		old.reset()
-		g.valPool.Put(old)
+		g.putValue(old)
 	}
 }
 
@@ -529,6 +837,52 @@ func (g *gache[V]) SetWithExpire(key string, val V, expire time.Duration) {
 	g.set(key, val, *(*int64)(unsafe.Pointer(&expire)))
 }
 
+// SetWithDeadline stores the key-value pair so that it expires at the absolute
+// wall-clock time deadline rather than after a relative duration. A zero
+// deadline means the entry never expires; a deadline in the past stores an
+// entry that is already expired.
+//
+// Example:
+//
+//	gc := gache.New[string]()
+//	gc.SetWithDeadline("token", "jwt...", time.Unix(claims.ExpiresAt, 0))
+func (g *gache[V]) SetWithDeadline(key string, val V, deadline time.Time) {
+	var expire int64
+	if !deadline.IsZero() {
+		expire = max(deadline.UnixNano(), 1)
+	}
+	g.store(key, val, expire, 0, 0, nil)
+}
+
+// SetWithSlidingExpire stores the key-value pair with a sliding expiration:
+// the entry expires ttl after it was last read, because every successful
+// [Gache.Get] or [Gache.GetWithExpire] pushes the deadline forward by ttl.
+// If maxLifetime is positive the entry never outlives it, measured from this
+// call, no matter how often it is read. A ttl ≤ 0 stores the entry without
+// expiration.
+//
+// Example:
+//
+//	gc := gache.New[string]()
+//	// Idle sessions expire after 15 minutes, any session after 12 hours.
+//	gc.SetWithSlidingExpire("sess", "user1", 15*time.Minute, 12*time.Hour)
+func (g *gache[V]) SetWithSlidingExpire(key string, val V, ttl, maxLifetime time.Duration) {
+	if ttl <= 0 {
+		g.set(key, val, int64(NoTTL))
+		return
+	}
+	now := fastime.UnixNanoNow()
+	var maxExpire int64
+	if maxLifetime > 0 {
+		maxExpire = now + int64(maxLifetime)
+	}
+	expire := now + int64(ttl)
+	if maxExpire > 0 && expire > maxExpire {
+		expire = maxExpire
+	}
+	g.store(key, val, expire, int64(ttl), maxExpire, nil)
+}
+
 // Set stores the key-value pair using the cache's default expiration duration
 // (set via [Gache.SetDefaultExpire] or [WithDefaultExpiration], defaults to
 // 30 seconds).
@@ -553,30 +907,99 @@ func (g *gache[V]) Set(key string, val V) {
 //	    fmt.Println("deleted:", v) // "deleted: data"
 //	}
 func (g *gache[V]) Delete(key string) (v V, loaded bool) {
-	shard := g.shards[getShardID(key, g.maxKeyLength)]
-	val, loaded := shard.LoadAndDeletePointer(key)
+	return g.remove(g.shards[getShardID(key, g.maxKeyLength)], key)
+}
+
+// remove deletes key from shard, or from the disk tier if it is not in
+// memory, and returns the value that was stored.
+func (g *gache[V]) remove(shard *Map[string, value[V]], key string) (v V, loaded bool) {
+	mu := g.lockKey(key)
+	g.storeDelete(key)
+	if v, loaded = g.deleteFrom(shard, key); !loaded {
+		v, loaded = g.unspill(key)
+	} else {
+		g.dropSpilled(key)
+	}
+	g.replicateKey(key)
+	unlockKey(mu)
 	if loaded {
-		val.mu.RLock()
-		if val.key != key {
-			val.mu.RUnlock()
-			return v, false
-		}
-		v = val.val
-		val.mu.RUnlock()
-		val.reset()
-		g.valPool.Put(val)
-		return v, true
+		g.removal(context.Background(), key, v)
+	}
+	return v, loaded
+}
+
+// removal hands an entry removed on request to the removal hook if one is
+// set. It must not be called under lockKey or the gates of a transaction.
+func (g *gache[V]) removal(ctx context.Context, key string, v V) {
+	if g.removeFunc != nil {
+		g.removeFunc(ctx, key, v)
+	}
+}
+
+// deleteFrom removes key from shard and returns the value that was stored.
+func (g *gache[V]) deleteFrom(shard *Map[string, value[V]], key string) (v V, loaded bool) {
+	if val, loaded := g.loadAndDeletePointer(shard, key); loaded {
+		return g.release(key, val)
 	}
 	return v, false
 }
 
+// release returns the value of val, which has just been deleted from the
+// shard of key, to the pool and reports the value it held for key.
+func (g *gache[V]) release(key string, val *value[V]) (v V, ok bool) {
+	val.mu.RLock()
+	if val.key != key {
+		val.mu.RUnlock()
+		return v, false
+	}
+	v = val.val
+	val.mu.RUnlock()
+	g.putValue(val)
+	return v, true
+}
+
+// expiration removes the expired entry of key, spilling it to the disk tier
+// unless it has tags, and hands it to the expired hook.
 func (g *gache[V]) expiration(key string) {
-	v, loaded := g.Delete(key)
-	if loaded && g.expFuncEnabled {
+	val, loaded := g.loadAndDeletePointer(g.shards[getShardID(key, g.maxKeyLength)], key)
+	if !loaded {
+		return
+	}
+	val.mu.RLock()
+	match, v, tagged := val.key == key, val.val, len(val.tags()) > 0
+	val.mu.RUnlock()
+	if !match {
+		return
+	}
+	g.putValue(val)
+	if !tagged {
+		g.spill(key, v)
+	}
+	if g.hasExpiredHook(key) {
 		g.expChan <- kv[V]{key: key, value: v}
 	}
 }
 
+// hasExpiredHook reports whether the expiration of key must be sent to the
+// expired hook. Keys of a namespace use the hook of that namespace.
+func (g *gache[V]) hasExpiredHook(key string) bool {
+	if ns := g.namespaces.of(key); ns != nil {
+		return ns.expFuncEnabled
+	}
+	return g.expFuncEnabled
+}
+
+// fireExpiredHook calls the expired hook responsible for key.
+func (g *gache[V]) fireExpiredHook(ctx context.Context, key string, v V) {
+	if ns := g.namespaces.of(key); ns != nil {
+		if ns.expFunc != nil {
+			ns.expFunc(ctx, key[len(ns.prefix):], v)
+		}
+		return
+	}
+	g.expFunc(ctx, key, v)
+}
+
 // DeleteExpired scans the entire cache and removes all entries whose
 // expiration time has passed. It returns the number of entries deleted. The
 // operation can be cancelled early via the provided context.
@@ -597,6 +1020,75 @@ func (g *gache[V]) DeleteExpired(ctx context.Context) uint64 {
 	return g.loop(ctx, nil)
 }
 
+// DeleteIf removes every non-expired entry for which f returns true and
+// returns the number of entries removed. f receives the key, value and
+// expiration timestamp (unix nanoseconds) and is called concurrently from the
+// workers that scan the shards, so it must be safe for concurrent use.
+// Expired entries encountered during the scan are removed as in
+// [Gache.DeleteExpired], firing the expired hook if enabled, but are not
+// counted. An entry overwritten while the scan is running is left alone.
+// Entries spilled to the disk tier are decoded and passed to f after the
+// shards have been scanned, with the time the disk TTL drops them, or 0, as
+// their expiration. Every removed entry is passed to the removal hook
+// set with [WithRemovalHookFunc], with ctx, from the scanning workers.
+//
+// Example:
+//
+//	gc := gache.New[int]()
+//	n := gc.DeleteIf(context.Background(), func(key string, v int, exp int64) bool {
+//	    return v < 0
+//	})
+//	fmt.Printf("removed %d negative entries\n", n)
+func (g *gache[V]) DeleteIf(ctx context.Context, f func(string, V, int64) bool) uint64 {
+	var deleted uint64
+	_ = g.loop(ctx, func(workerID int, k string, v *value[V]) bool {
+		v.mu.RLock()
+		if v.key != k {
+			v.mu.RUnlock()
+			return true
+		}
+		val := v.val
+		exp := atomic.LoadInt64(&v.expire)
+		v.mu.RUnlock()
+		if !f(k, val, exp) {
+			return true
+		}
+		mu := g.lockKey(k)
+		removed := g.compareAndDeletePointer(g.shards[getShardID(k, g.maxKeyLength)], k, v)
+		if removed {
+			g.dropSpilled(k)
+			g.storeDelete(k)
+			g.replicateKey(k)
+		}
+		unlockKey(mu)
+		if removed {
+			g.putValue(v)
+			g.removal(ctx, k, val)
+			atomic.AddUint64(&deleted, 1)
+		}
+		return true
+	})
+	return deleted + g.unspillIf(ctx, f)
+}
+
+// DeletePrefix removes every non-expired entry whose key starts with prefix
+// and returns the number of entries removed. It follows the same rules as
+// [Gache.DeleteIf].
+//
+// Example:
+//
+//	gc := gache.New[string]()
+//	gc.Set("tenant:42:user:1", "alice")
+//	gc.Set("tenant:42:user:2", "bob")
+//
+//	n := gc.DeletePrefix(context.Background(), "tenant:42:")
+//	fmt.Println(n) // 2
+func (g *gache[V]) DeletePrefix(ctx context.Context, prefix string) uint64 {
+	return g.DeleteIf(ctx, func(k string, _ V, _ int64) bool {
+		return strings.HasPrefix(k, prefix)
+	})
+}
+
 // Range iterates over every non-expired entry in the cache, calling f for each
 // one. The iteration stops early when f returns false or when the context is
 // cancelled. The function f receives the key, value, and expiration timestamp
@@ -842,8 +1334,10 @@ func (g *gache[V]) Stop() {
 }
 
 // Clear removes all entries from the cache, effectively resetting it to an
-// empty state. This is an O(shards) operation and does not stop the expiration
-// daemon if one is running.
+// empty state. This is an O(shards) operation, or O(entries) when tags,
+// indexes, namespaces, WithMaxEntries or the disk tier are in use, and does
+// not stop the expiration daemon if one is running. Writes racing with Clear
+// may survive it.
 //
 // Example:
 //
@@ -853,12 +1347,44 @@ func (g *gache[V]) Stop() {
 //	gc.Clear()
 //	fmt.Println(gc.Len()) // 0
 func (g *gache[V]) Clear() {
-	for i := range g.shards {
-		if g.shards[i] == nil {
-			g.shards[i] = newMap[V]()
-		} else {
-			g.shards[i].Clear()
+	if g.primary != nil {
+		// Holding the log while clearing orders the clear before the
+		// records of any write that survives it.
+		g.primary.log.lock()
+		defer g.primary.log.unlockClear()
+	}
+	g.clearLocal()
+	if g.invalidator != nil {
+		g.invalidator.publishClear()
+	}
+}
+
+// clearLocal empties the shards and the disk tier without telling replicas
+// or the other caches on the invalidation bus.
+func (g *gache[V]) clearLocal() {
+	if g.observers.Load() == nil {
+		for i := range g.shards {
+			if g.shards[i] == nil {
+				g.shards[i] = newMap[V]()
+			} else {
+				g.shards[i].Clear()
+			}
 		}
+		return
+	}
+	// Releasing each value, rather than resetting the observers, keeps them
+	// balanced with a write whose value was inserted into them before Clear
+	// and lands in its shard after it.
+	for _, shard := range g.shards {
+		shard.RangePointer(func(k string, v *value[V]) bool {
+			if shard.CompareAndDeletePointer(k, v) {
+				g.putValue(v)
+			}
+			return true
+		})
+	}
+	if g.l2 != nil {
+		g.l2.clear()
 	}
 }
 
@@ -875,14 +1401,9 @@ func (g *gache[V]) Clear() {
 //	gc.ExtendExpire("sess", 10*time.Minute)
 func (g *gache[V]) ExtendExpire(key string, addExp time.Duration) {
 	shard := g.shards[getShardID(key, g.maxKeyLength)]
-	var newVal *value[V]
 	for {
-		val, ok := shard.LoadPointer(key)
+		val, ok := g.loadPointer(shard, key)
 		if !ok {
-			if newVal != nil {
-				newVal.reset()
-				g.valPool.Put(newVal)
-			}
 			return
 		}
 		valid, match := val.isValid(key)
@@ -891,38 +1412,21 @@ func (g *gache[V]) ExtendExpire(key string, addExp time.Duration) {
 		}
 		if !valid {
 			g.expiration(key)
-			if newVal != nil {
-				newVal.reset()
-				g.valPool.Put(newVal)
-			}
 			return
 		}
 
-		if newVal == nil {
-			newVal = g.valPool.Get().(*value[V])
-		}
-
-		var copied bool
-		val.mu.RLock()
-		if val.key == key {
-			newVal.mu.Lock()
-			newVal.key = key
-			newVal.val = val.val
-			atomic.StoreInt64(&newVal.expire, atomic.LoadInt64(&val.expire)+int64(addExp))
-			newVal.mu.Unlock()
-			copied = true
-		}
-		val.mu.RUnlock()
-
+		newVal, copied := g.copyValue(key, val, func(expire int64) int64 {
+			return expire + int64(addExp)
+		})
 		if !copied {
 			continue
 		}
 
-		if shard.CompareAndSwapPointer(key, val, newVal) {
-			val.reset()
-			g.valPool.Put(val)
+		if g.compareAndSwapPointer(shard, key, val, newVal) {
+			g.putValue(val)
 			return
 		}
+		g.putValue(newVal)
 	}
 }
 
@@ -958,14 +1462,9 @@ func (g *gache[V]) GetRefresh(key string) (V, bool) {
 //	}
 func (g *gache[V]) GetRefreshWithDur(key string, d time.Duration) (v V, ok bool) {
 	shard := g.shards[getShardID(key, g.maxKeyLength)]
-	var newVal *value[V]
 	for {
-		val, ok := shard.LoadPointer(key)
+		val, ok := g.loadPointer(shard, key)
 		if !ok {
-			if newVal != nil {
-				newVal.reset()
-				g.valPool.Put(newVal)
-			}
 			return v, false
 		}
 		valid, match := val.isValid(key)
@@ -974,39 +1473,22 @@ func (g *gache[V]) GetRefreshWithDur(key string, d time.Duration) (v V, ok bool)
 		}
 		if !valid {
 			g.expiration(key)
-			if newVal != nil {
-				newVal.reset()
-				g.valPool.Put(newVal)
-			}
 			return v, false
 		}
 
-		if newVal == nil {
-			newVal = g.valPool.Get().(*value[V])
-		}
-
-		var copied bool
-		val.mu.RLock()
-		if val.key == key {
-			newVal.mu.Lock()
-			newVal.key = key
-			newVal.val = val.val
-			atomic.StoreInt64(&newVal.expire, fastime.UnixNanoNow()+int64(d))
-			newVal.mu.Unlock()
-			v = newVal.val
-			copied = true
-		}
-		val.mu.RUnlock()
-
+		newVal, copied := g.copyValue(key, val, func(int64) int64 {
+			return fastime.UnixNanoNow() + g.jitter(int64(d))
+		})
 		if !copied {
 			continue
 		}
+		v = newVal.val
 
-		if shard.CompareAndSwapPointer(key, val, newVal) {
-			val.reset()
-			g.valPool.Put(val)
+		if g.compareAndSwapPointer(shard, key, val, newVal) {
+			g.putValue(val)
 			return v, true
 		}
+		g.putValue(newVal)
 	}
 }
 
@@ -1025,7 +1507,7 @@ func (g *gache[V]) GetRefreshWithDur(key string, d time.Duration) (v V, ok bool)
 //	    fmt.Println("stale value:", v)
 //	}
 func (g *gache[V]) GetWithIgnoredExpire(key string) (v V, ok bool) {
-	val, ok := g.shards[getShardID(key, g.maxKeyLength)].LoadPointer(key)
+	val, ok := g.loadPointer(g.shards[getShardID(key, g.maxKeyLength)], key)
 	if !ok {
 		return v, false
 	}
@@ -1055,9 +1537,19 @@ func (g *gache[V]) GetWithIgnoredExpire(key string) (v V, ok bool) {
 //	// "job" is no longer in the cache.
 func (g *gache[V]) Pop(key string) (v V, ok bool) {
 	shard := g.shards[getShardID(key, g.maxKeyLength)]
-	val, loaded := shard.LoadAndDeletePointer(key)
+	mu := g.lockKey(key)
+	g.storeDelete(key)
+	val, loaded := g.loadAndDeletePointer(shard, key)
 	if !loaded {
-		return v, false
+		v, ok = g.unspill(key)
+	}
+	g.replicateKey(key)
+	unlockKey(mu)
+	if !loaded {
+		if ok {
+			g.removal(context.Background(), key, v)
+		}
+		return v, ok
 	}
 	val.mu.RLock()
 	if val.key != key {
@@ -1068,12 +1560,13 @@ func (g *gache[V]) Pop(key string) (v V, ok bool) {
 	expire := atomic.LoadInt64(&val.expire)
 	valid := expire <= 0 || fastime.UnixNanoNow() <= expire
 	val.mu.RUnlock()
-	val.reset()
-	g.valPool.Put(val)
+	g.putValue(val)
+	g.dropSpilled(key)
 	if valid {
+		g.removal(context.Background(), key, v)
 		return v, true
 	}
-	if g.expFuncEnabled {
+	if g.hasExpiredHook(key) {
 		g.expChan <- kv[V]{key: key, value: v}
 	}
 	return v, false
@@ -1081,7 +1574,8 @@ func (g *gache[V]) Pop(key string) (v V, ok bool) {
 
 // SetIfNotExists stores the key-value pair only if key is not already present
 // (or has expired) in the cache. The default expiration is used. This provides
-// a simple compare-and-set semantic for cache population.
+// a simple compare-and-set semantic for cache population. It reports whether
+// the value was stored.
 //
 // Example:
 //
@@ -1091,13 +1585,13 @@ func (g *gache[V]) Pop(key string) (v V, ok bool) {
 //
 //	v, _ := gc.Get("init")
 //	fmt.Println(v) // "first"
-func (g *gache[V]) SetIfNotExists(key string, val V) {
-	g.SetWithExpireIfNotExists(key, val, time.Duration(atomic.LoadInt64(&g.expire)))
+func (g *gache[V]) SetIfNotExists(key string, val V) bool {
+	return g.SetWithExpireIfNotExists(key, val, time.Duration(atomic.LoadInt64(&g.expire)))
 }
 
 // SetWithExpireIfNotExists stores the key-value pair with a custom expiration
 // duration d, but only if key is not already present (or has expired) in the
-// cache.
+// cache. It reports whether the value was stored.
 //
 // Example:
 //
@@ -1107,24 +1601,20 @@ func (g *gache[V]) SetIfNotExists(key string, val V) {
 //
 //	v, _ := gc.Get("counter")
 //	fmt.Println(v) // 1
-func (g *gache[V]) SetWithExpireIfNotExists(key string, val V, d time.Duration) {
+func (g *gache[V]) SetWithExpireIfNotExists(key string, val V, d time.Duration) bool {
 	exp := int64(d)
 	if exp > 0 {
-		exp += fastime.UnixNanoNow()
+		exp = fastime.UnixNanoNow() + g.jitter(exp)
 	}
 
-	newVal := g.valPool.Get().(*value[V])
-	newVal.mu.Lock()
-	newVal.key = key
-	newVal.val = val
-	atomic.StoreInt64(&newVal.expire, exp)
-	newVal.mu.Unlock()
-
+	newVal := g.newValue(key, val, exp, 0, 0, nil)
 	shard := g.shards[getShardID(key, g.maxKeyLength)]
+	defer unlockKey(g.lockKey(key))
 	for {
-		actual, loaded := shard.LoadOrStorePointer(key, newVal)
+		actual, loaded := g.loadOrStorePointer(shard, key, newVal)
 		if !loaded {
-			return
+			g.storeSet(key, val)
+			return true
 		}
 
 		// loaded: actual is the existing value (*value[V])
@@ -1135,18 +1625,169 @@ func (g *gache[V]) SetWithExpireIfNotExists(key string, val V, d time.Duration)
 		}
 		if valid {
 			// New value not used
-			newVal.reset()
-			g.valPool.Put(newVal)
-			return
+			g.putValue(newVal)
+			return false
 		}
 
 		// actual is expired. Replace it.
-		if shard.CompareAndSwapPointer(key, actual, newVal) {
+		if g.compareAndSwapPointer(shard, key, actual, newVal) {
 			// We replaced actual with newVal.
-			actual.reset()
-			g.valPool.Put(actual)
-			return
+			g.putValue(actual)
+			g.storeSet(key, val)
+			return true
 		}
 		// CAS failed, loop again.
 	}
 }
+
+// SetIfExists overwrites the value for key with the default expiration, but
+// only if a non-expired entry for key already exists. It reports whether the
+// value was stored. This is the counterpart of [Gache.SetIfNotExists] and
+// corresponds to memcached's replace.
+//
+// Example:
+//
+//	gc := gache.New[string]()
+//	gc.SetIfExists("k", "v") // false, "k" does not exist
+//	gc.Set("k", "v1")
+//	gc.SetIfExists("k", "v2") // true
+func (g *gache[V]) SetIfExists(key string, val V) bool {
+	return g.SetWithExpireIfExists(key, val, time.Duration(atomic.LoadInt64(&g.expire)))
+}
+
+// SetWithExpireIfExists is like [Gache.SetIfExists] but the stored entry
+// expires after d.
+func (g *gache[V]) SetWithExpireIfExists(key string, val V, d time.Duration) bool {
+	shard := g.shards[getShardID(key, g.maxKeyLength)]
+	var newVal *value[V]
+	faulted := false
+	for {
+		actual, ok := g.loadPointer(shard, key)
+		if !ok {
+			if !faulted {
+				faulted = true
+				if g.fault(shard, key) {
+					continue
+				}
+			}
+			if newVal != nil {
+				g.putValue(newVal)
+			}
+			return false
+		}
+		valid, match := actual.isValid(key)
+		if !match {
+			continue
+		}
+		if !valid {
+			g.expiration(key)
+			continue
+		}
+		if newVal == nil {
+			newVal = g.newValue(key, val, g.absExpire(int64(d)), 0, 0, nil)
+		}
+		mu := g.lockKey(key)
+		if g.compareAndSwapPointer(shard, key, actual, newVal) {
+			g.storeSet(key, val)
+			unlockKey(mu)
+			g.putValue(actual)
+			return true
+		}
+		unlockKey(mu)
+	}
+}
+
+// GetAndSet stores the key-value pair with the default expiration and returns
+// the value it replaced. The second return value reports whether a
+// non-expired previous value existed.
+//
+// Example:
+//
+//	gc := gache.New[string]()
+//	gc.Set("state", "idle")
+//
+//	prev, _ := gc.GetAndSet("state", "running")
+//	fmt.Println(prev) // "idle"
+func (g *gache[V]) GetAndSet(key string, val V) (old V, loaded bool) {
+	return g.getAndSet(key, val, atomic.LoadInt64(&g.expire))
+}
+
+// getAndSet implements GetAndSet with the relative expiration ttl.
+func (g *gache[V]) getAndSet(key string, val V, ttl int64) (old V, loaded bool) {
+	shard := g.shards[getShardID(key, g.maxKeyLength)]
+	newVal := g.newValue(key, val, g.absExpire(ttl), 0, 0, nil)
+	mu := g.lockKey(key)
+	prev, loaded := g.swapPointer(shard, key, newVal)
+	g.storeSet(key, val)
+	unlockKey(mu)
+	if !loaded {
+		return old, false
+	}
+	prev.mu.RLock()
+	if prev.key != key {
+		prev.mu.RUnlock()
+		return old, false
+	}
+	old = prev.val
+	expire := atomic.LoadInt64(&prev.expire)
+	prev.mu.RUnlock()
+	g.putValue(prev)
+	if expire <= 0 || fastime.UnixNanoNow() <= expire {
+		return old, true
+	}
+	if g.hasExpiredHook(key) {
+		g.expChan <- kv[V]{key: key, value: old}
+	}
+	var zero V
+	return zero, false
+}
+
+// CompareAndDelete removes the entry for key only if it has not expired and
+// eq reports that its current value equals expected. A nil eq compares the
+// values with [reflect.DeepEqual]. It reports whether the entry was deleted.
+//
+// Example:
+//
+//	gc := gache.New[string]()
+//	gc.Set("lock", "owner-1")
+//
+//	// Release the lock only if we still own it.
+//	gc.CompareAndDelete("lock", "owner-1", func(a, b string) bool { return a == b })
+func (g *gache[V]) CompareAndDelete(key string, expected V, eq func(a, b V) bool) bool {
+	if eq == nil {
+		eq = func(a, b V) bool { return reflect.DeepEqual(a, b) }
+	}
+	shard := g.shards[getShardID(key, g.maxKeyLength)]
+	for {
+		actual, ok := g.loadPointer(shard, key)
+		if !ok {
+			return g.compareAndUnspill(key, expected, eq)
+		}
+		actual.mu.RLock()
+		if actual.key != key {
+			actual.mu.RUnlock()
+			continue
+		}
+		v := actual.val
+		expire := atomic.LoadInt64(&actual.expire)
+		actual.mu.RUnlock()
+		if expire > 0 && fastime.UnixNanoNow() > expire {
+			g.expiration(key)
+			return false
+		}
+		if !eq(v, expected) {
+			return false
+		}
+		mu := g.lockKey(key)
+		if g.compareAndDeletePointer(shard, key, actual) {
+			g.dropSpilled(key)
+			g.storeDelete(key)
+			g.replicateKey(key)
+			unlockKey(mu)
+			g.putValue(actual)
+			g.removal(context.Background(), key, v)
+			return true
+		}
+		unlockKey(mu)
+	}
+}
@@ -4,13 +4,17 @@ import (
 	"bytes"
 	"context"
 	"encoding/gob"
+	"errors"
 	"fmt"
 	"math/rand"
+	"net"
+	"path/filepath"
 	"strings"
 	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
+	"unsafe"
 )
 
 func forceBug(t *testing.T) {
@@ -41,6 +45,43 @@ func forceBug(t *testing.T) {
 	}
 }
 
+// TestGache_ValueExtra verifies that plain entries carry no optional
+// metadata and that the features using it still see theirs.
+func TestGache_ValueExtra(t *testing.T) {
+	t.Helper()
+	if size := unsafe.Sizeof(value[int64]{}); unsafe.Sizeof(uintptr(0)) == 8 && size > 72 {
+		t.Errorf("expected value[int64] to take at most 72 bytes, got %d", size)
+	}
+	gc := New[int]()
+	g := gc.(*gache[int])
+	extra := func(key string) *valueExtra[int] {
+		t.Helper()
+		val, ok := g.shards[getShardID(key, g.maxKeyLength)].LoadPointer(key)
+		if !ok {
+			t.Fatalf("expected %s to be stored", key)
+		}
+		val.mu.RLock()
+		defer val.mu.RUnlock()
+		return val.x
+	}
+
+	gc.Set("plain", 1)
+	if x := extra("plain"); x != nil {
+		t.Errorf("expected a plain entry to have no metadata, got %+v", *x)
+	}
+	gc.SetWithSlidingExpire("sliding", 1, time.Minute, time.Hour)
+	if x := extra("sliding"); x == nil || x.sliding != int64(time.Minute) || x.maxExpire <= 0 {
+		t.Errorf("expected the sliding parameters to be kept, got %+v", x)
+	}
+	gc.SetWithTags("tagged", 1, NoTTL, "t")
+	if x := extra("tagged"); x == nil || len(x.tags) != 1 || x.obs == nil {
+		t.Errorf("expected the tags and observers to be kept, got %+v", x)
+	}
+	if n := gc.InvalidateTag("t"); n != 1 {
+		t.Errorf("expected InvalidateTag to remove 1 entry, got %d", n)
+	}
+}
+
 // TestGache_DisableExpiredHook ensures that disabling an active expiration hook correctly prevents subsequent callbacks from executing.
 func TestGache_DisableExpiredHook(t *testing.T) {
 	t.Helper()
@@ -141,16 +182,396 @@ func TestGache_Pop(t *testing.T) {
 func TestGache_SetIfNotExists(t *testing.T) {
 	t.Helper()
 	gc := New[string]()
-	gc.SetIfNotExists("key", "value1")
+	if !gc.SetIfNotExists("key", "value1") {
+		t.Error("expected first SetIfNotExists to report stored")
+	}
 	if v, ok := gc.Get("key"); !ok || v != "value1" {
 		t.Errorf("expected value1, got %v", v)
 	}
-	gc.SetIfNotExists("key", "value2")
+	if gc.SetIfNotExists("key", "value2") {
+		t.Error("expected second SetIfNotExists to report not stored")
+	}
 	if v, ok := gc.Get("key"); !ok || v != "value1" {
 		t.Errorf("expected value1 after second SetIfNotExists, got %v", v)
 	}
 }
 
+// TestGache_SetWithDeadline verifies that entries stored with an absolute deadline expire at that wall-clock time.
+func TestGache_SetWithDeadline(t *testing.T) {
+	t.Helper()
+	gc := New[string]()
+	deadline := time.Now().Add(100 * time.Millisecond)
+	gc.SetWithDeadline("key", "value", deadline)
+	if _, exp, ok := gc.GetWithExpire("key"); !ok || exp != deadline.UnixNano() {
+		t.Errorf("expected expire %d, got %d (ok: %t)", deadline.UnixNano(), exp, ok)
+	}
+	time.Sleep(200 * time.Millisecond)
+	if _, ok := gc.Get("key"); ok {
+		t.Error("expected key to expire at its deadline")
+	}
+
+	gc.SetWithDeadline("past", "value", time.Now().Add(-time.Second))
+	if _, ok := gc.Get("past"); ok {
+		t.Error("expected entry with a past deadline to be expired")
+	}
+
+	gc.SetWithDeadline("forever", "value", time.Time{})
+	if _, exp, ok := gc.GetWithExpire("forever"); !ok || exp > 0 {
+		t.Errorf("expected zero deadline to disable expiration, got %d (ok: %t)", exp, ok)
+	}
+}
+
+// TestGache_SetWithSlidingExpire verifies that reads keep sliding entries alive but never past their maximum lifetime.
+func TestGache_SetWithSlidingExpire(t *testing.T) {
+	t.Helper()
+	gc := New[string]()
+	gc.SetWithSlidingExpire("key", "value", 100*time.Millisecond, 350*time.Millisecond)
+	for range 5 {
+		time.Sleep(50 * time.Millisecond)
+		if _, ok := gc.Get("key"); !ok {
+			t.Fatal("expected sliding entry to be kept alive by reads")
+		}
+	}
+	time.Sleep(150 * time.Millisecond)
+	if _, ok := gc.Get("key"); ok {
+		t.Error("expected sliding entry to expire at its maximum lifetime")
+	}
+
+	gc.SetWithSlidingExpire("idle", "value", 50*time.Millisecond, 0)
+	time.Sleep(100 * time.Millisecond)
+	if _, ok := gc.Get("idle"); ok {
+		t.Error("expected idle sliding entry to expire")
+	}
+}
+
+// TestGache_TTLJitter verifies that jittered expirations are spread within the configured window and never exceed the requested TTL.
+func TestGache_TTLJitter(t *testing.T) {
+	t.Helper()
+	const ttl = time.Hour
+	gc := New[int](WithTTLJitter[int](0.5))
+	before := time.Now().UnixNano()
+	for i := range 100 {
+		gc.SetWithExpire(fmt.Sprintf("key-%d", i), i, ttl)
+	}
+	after := time.Now().UnixNano()
+
+	seen := make(map[int64]struct{})
+	for i := range 100 {
+		_, exp, ok := gc.GetWithExpire(fmt.Sprintf("key-%d", i))
+		if !ok {
+			t.Fatalf("expected key-%d to exist", i)
+		}
+		if lo, hi := before+int64(ttl/2), after+int64(ttl); exp < lo || exp > hi {
+			t.Errorf("expire %d outside jitter window [%d, %d]", exp, lo, hi)
+		}
+		seen[exp] = struct{}{}
+	}
+	if len(seen) < 2 {
+		t.Error("expected jitter to spread expirations")
+	}
+
+	if err := WithTTLJitter[int](1.5)(new(gache[int])); err == nil {
+		t.Error("expected an error for a jitter fraction above 1")
+	}
+}
+
+// TestNewWithError verifies that option errors and invalid combinations are reported by NewWithError and ignored by New.
+func TestNewWithError(t *testing.T) {
+	t.Helper()
+	gc, err := NewWithError[int](WithDefaultExpirationString[int]("1m"), WithTTLJitter[int](0.1))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	gc.Close()
+
+	opts := []Option[int]{
+		WithDefaultExpirationString[int]("soon"),
+		WithTTLJitter[int](2),
+		WithMaxWorkers[int](-1),
+	}
+	gc, err = NewWithError(opts...)
+	if gc != nil || !errors.Is(err, ErrInvalidTTLJitter) || !errors.Is(err, ErrInvalidMaxWorkers) ||
+		!strings.Contains(err.Error(), `"soon"`) {
+		t.Errorf("expected every error to be reported, got %v", err)
+	}
+	gc = New(opts...)
+	if g := gc.(*gache[int]); g.expire != int64(30*time.Second) || g.ttlJitter != 0 {
+		t.Errorf("expected New to keep the defaults, got %v and %v", g.expire, g.ttlJitter)
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_, err = NewWithError(
+		WithReplicationPrimary[int](l),
+		WithReplicationReplica[int]("127.0.0.1:1", WithReplicationRetry(time.Hour)),
+	)
+	if !errors.Is(err, ErrReplicationRole) {
+		t.Errorf("expected ErrReplicationRole, got %v", err)
+	}
+	if _, err := l.Accept(); err == nil {
+		t.Error("expected the rejected cache to close its listener")
+	}
+}
+
+// TestNewWithError_InvalidOptions verifies that NewWithError rejects option values that would otherwise be ignored.
+func TestNewWithError_InvalidOptions(t *testing.T) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "l2.log")
+	tests := []struct {
+		name string
+		opt  Option[int]
+		want error
+	}{
+		{name: "zero default expiration", opt: WithDefaultExpiration[int](0), want: ErrInvalidDefaultExpiration},
+		{name: "negative default expiration", opt: WithDefaultExpiration[int](-time.Second), want: ErrInvalidDefaultExpiration},
+		{name: "NoTTL default expiration", opt: WithDefaultExpiration[int](NoTTL)},
+		{name: "negative default expiration string", opt: WithDefaultExpirationString[int]("-5m"), want: ErrInvalidDefaultExpiration},
+		{name: "negative max entries", opt: WithMaxEntries[int](-1), want: ErrInvalidMaxEntries},
+		{name: "zero max entries", opt: WithMaxEntries[int](0)},
+		{name: "negative disk capacity", opt: WithDiskTier[int](path, WithDiskCapacity(-1)), want: ErrInvalidDiskCapacity},
+		{name: "zero disk capacity", opt: WithDiskTier[int](path, WithDiskCapacity(0))},
+		{name: "nil store", opt: WithStore[int](nil), want: ErrNilStore},
+		{name: "nil invalidation bus", opt: WithInvalidationBus[int](nil), want: ErrNilBus},
+		{name: "nil replication listener", opt: WithReplicationPrimary[int](nil), want: ErrNilListener},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gc, err := NewWithError(tt.opt)
+			if !errors.Is(err, tt.want) || (tt.want == nil) != (err == nil) {
+				t.Fatalf("expected %v, got %v", tt.want, err)
+			}
+			if gc != nil {
+				gc.Close()
+			}
+		})
+	}
+}
+
+// TestGache_SetIfExists verifies that conditional overwrites only succeed for live entries.
+func TestGache_SetIfExists(t *testing.T) {
+	t.Helper()
+	gc := New[string]()
+	if gc.SetIfExists("key", "value1") {
+		t.Error("expected SetIfExists to fail for an absent key")
+	}
+	if _, ok := gc.Get("key"); ok {
+		t.Error("expected SetIfExists not to create the key")
+	}
+	gc.Set("key", "value1")
+	if !gc.SetIfExists("key", "value2") {
+		t.Error("expected SetIfExists to succeed for an existing key")
+	}
+	if v, ok := gc.Get("key"); !ok || v != "value2" {
+		t.Errorf("expected value2, got %v", v)
+	}
+
+	gc.SetWithExpire("short", "value", 50*time.Millisecond)
+	time.Sleep(150 * time.Millisecond)
+	if gc.SetWithExpireIfExists("short", "value", time.Minute) {
+		t.Error("expected SetWithExpireIfExists to fail for an expired key")
+	}
+}
+
+// TestGache_GetAndSet verifies that GetAndSet stores the new value and returns the previous live value.
+func TestGache_GetAndSet(t *testing.T) {
+	t.Helper()
+	gc := New[string]()
+	if _, loaded := gc.GetAndSet("key", "value1"); loaded {
+		t.Error("expected no previous value")
+	}
+	if old, loaded := gc.GetAndSet("key", "value2"); !loaded || old != "value1" {
+		t.Errorf("expected previous value1, got %v (loaded: %t)", old, loaded)
+	}
+	if v, ok := gc.Get("key"); !ok || v != "value2" {
+		t.Errorf("expected value2, got %v", v)
+	}
+	if l := gc.Len(); l != 1 {
+		t.Errorf("expected length 1, got %d", l)
+	}
+}
+
+// TestGache_CompareAndDelete verifies that entries are only deleted when their current value matches the expected one.
+func TestGache_CompareAndDelete(t *testing.T) {
+	t.Helper()
+	gc := New[string]()
+	gc.Set("lock", "owner-1")
+	eq := func(a, b string) bool { return a == b }
+
+	if gc.CompareAndDelete("lock", "owner-2", eq) {
+		t.Error("expected CompareAndDelete to fail for a different value")
+	}
+	if _, ok := gc.Get("lock"); !ok {
+		t.Error("expected lock to remain")
+	}
+	if !gc.CompareAndDelete("lock", "owner-1", eq) {
+		t.Error("expected CompareAndDelete to succeed for the matching value")
+	}
+	if _, ok := gc.Get("lock"); ok {
+		t.Error("expected lock to be deleted")
+	}
+
+	gc.Set("lock", "owner-1")
+	if !gc.CompareAndDelete("lock", "owner-1", nil) {
+		t.Error("expected nil eq to fall back to deep equality")
+	}
+}
+
+// TestGache_DeleteIf verifies that predicate deletion removes exactly the matching entries and reports how many were removed.
+func TestGache_DeleteIf(t *testing.T) {
+	t.Helper()
+	gc := New[int]()
+	for i := range 1000 {
+		gc.Set(fmt.Sprintf("key-%d", i), i)
+	}
+
+	n := gc.DeleteIf(t.Context(), func(k string, v int, exp int64) bool {
+		return v%2 == 0
+	})
+	if n != 500 {
+		t.Errorf("expected 500 deletions, got %d", n)
+	}
+	if l := gc.Len(); l != 500 {
+		t.Errorf("expected length 500, got %d", l)
+	}
+	for _, v := range gc.Values(t.Context()) {
+		if v%2 == 0 {
+			t.Fatalf("expected even values to be deleted, found %d", v)
+		}
+	}
+}
+
+// TestGache_DeletePrefix verifies that prefix deletion only removes keys sharing the prefix.
+func TestGache_DeletePrefix(t *testing.T) {
+	t.Helper()
+	gc := New[string]()
+	for i := range 100 {
+		gc.Set(fmt.Sprintf("tenant:42:user:%d", i), "v")
+		gc.Set(fmt.Sprintf("tenant:7:user:%d", i), "v")
+	}
+
+	if n := gc.DeletePrefix(t.Context(), "tenant:42:"); n != 100 {
+		t.Errorf("expected 100 deletions, got %d", n)
+	}
+	for _, k := range gc.Keys(t.Context()) {
+		if strings.HasPrefix(k, "tenant:42:") {
+			t.Fatalf("expected %s to be deleted", k)
+		}
+	}
+	if l := gc.Len(); l != 100 {
+		t.Errorf("expected length 100, got %d", l)
+	}
+}
+
+// TestGache_RemovalHook verifies that every explicit removal, in memory or on disk, passes the removed entry to the removal hook, while overwrites, expirations and Clear do not.
+func TestGache_RemovalHook(t *testing.T) {
+	t.Helper()
+	var mu sync.Mutex
+	removed := make(map[string]int)
+	gc := New(
+		WithMaxEntries[int](10),
+		WithDiskTier[int](filepath.Join(t.TempDir(), "l2.log")),
+		WithRemovalHookFunc(func(ctx context.Context, key string, v int) {
+			mu.Lock()
+			removed[key] = v
+			mu.Unlock()
+		}),
+	)
+	defer gc.Close()
+	for i := range 20 {
+		gc.Set(fmt.Sprintf("key-%d", i), i)
+	}
+	gc.Set("other", -1)
+	flushSpills(gc)
+
+	n := gc.DeleteIf(t.Context(), func(k string, v int, exp int64) bool {
+		return v >= 0 && v%2 == 0
+	})
+	if n != 10 || len(removed) != 10 {
+		t.Fatalf("expected 10 entries removed and hooked, got %d and %d", n, len(removed))
+	}
+	for k, v := range removed {
+		if k != fmt.Sprintf("key-%d", v) || v%2 != 0 {
+			t.Errorf("unexpected hooked entry %s = %d", k, v)
+		}
+	}
+
+	clear(removed)
+	gc.Set("tenant:1", 1)
+	if n := gc.DeletePrefix(t.Context(), "tenant:"); n != 1 || removed["tenant:1"] != 1 || len(removed) != 1 {
+		t.Errorf("expected DeletePrefix to hook tenant:1, got %d and %v", n, removed)
+	}
+
+	clear(removed)
+	if _, ok := gc.Delete("key-1"); !ok || removed["key-1"] != 1 || len(removed) != 1 {
+		t.Errorf("expected Delete to hook key-1, got %v", removed)
+	}
+
+	tests := []struct {
+		name   string
+		remove func(Gache[int]) bool
+	}{
+		{name: "Delete", remove: func(gc Gache[int]) bool {
+			_, ok := gc.Delete("k")
+			return ok
+		}},
+		{name: "Pop", remove: func(gc Gache[int]) bool {
+			_, ok := gc.Pop("k")
+			return ok
+		}},
+		{name: "CompareAndDelete", remove: func(gc Gache[int]) bool {
+			return gc.CompareAndDelete("k", 7, nil)
+		}},
+		{name: "DeleteIfVersion", remove: func(gc Gache[int]) bool {
+			_, version, _ := gc.GetVersioned("k")
+			return gc.DeleteIfVersion("k", version)
+		}},
+		{name: "DeleteMulti", remove: func(gc Gache[int]) bool {
+			return len(gc.DeleteMulti("k", "missing")) == 1
+		}},
+		{name: "InvalidateTag", remove: func(gc Gache[int]) bool {
+			gc.SetWithTags("k", 7, time.Hour, "t")
+			return gc.InvalidateTag("t") == 1
+		}},
+		{name: "Compute", remove: func(gc Gache[int]) bool {
+			_, ok := gc.Compute("k", func(int, bool) (int, Op) { return 0, OpDelete })
+			return !ok
+		}},
+		{name: "Txn", remove: func(gc Gache[int]) bool {
+			return gc.Txn(func(tx Tx[int]) error {
+				tx.Delete("k")
+				return nil
+			}) == nil
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var hooked []string
+			gc := New(WithRemovalHookFunc(func(ctx context.Context, key string, v int) {
+				hooked = append(hooked, fmt.Sprintf("%s=%d", key, v))
+			}))
+			gc.Set("k", 7)
+			if !tt.remove(gc) {
+				t.Fatal("expected the entry to be removed")
+			}
+			if len(hooked) != 1 || hooked[0] != "k=7" {
+				t.Errorf("expected the removal hook to get k=7 once, got %v", hooked)
+			}
+			gc.Set("k", 8)
+			gc.Set("k", 9)
+			gc.SetWithExpire("gone", 1, time.Nanosecond)
+			time.Sleep(time.Millisecond)
+			gc.DeleteExpired(t.Context())
+			gc.Clear()
+			if len(hooked) != 1 {
+				t.Errorf("expected overwrites, expirations and Clear not to fire the removal hook, got %v", hooked)
+			}
+		})
+	}
+}
+
 // TestGache_DataRace rigorously hammers the cache with concurrent mixed operations to expose any potential data races or synchronization flaws.
 func TestGache_DataRace(t *testing.T) {
 	c := New[string]()
@@ -496,6 +917,59 @@ func TestGache_LenBasic(t *testing.T) {
 	}
 }
 
+// TestGache_IndexClearConcurrent verifies that the tag index, the ordered
+// index and the namespace counts still match the shards after writes racing
+// with Clear.
+func TestGache_IndexClearConcurrent(t *testing.T) {
+	t.Helper()
+	g := New[int](WithOrderedKeys[int]()).(*gache[int])
+	ns := g.Namespace("n")
+
+	// A write whose value was indexed before Clear and lands in its shard
+	// after it.
+	g.tags()
+	val := g.newValue("late", 1, 0, 0, 0, []string{"t"})
+	g.Clear()
+	g.swapPointer(g.shards[getShardID("late", g.maxKeyLength)], "late", val)
+	if keys := g.ScanPrefix(t.Context(), ""); len(keys) != 1 {
+		t.Errorf("expected the ordered index to hold the late write, got %v", keys)
+	}
+	if got := g.InvalidateTag("t"); got != 1 {
+		t.Errorf("expected the tag index to hold the late write, got %d", got)
+	}
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for id := range 4 {
+		wg.Go(func() {
+			for i := 0; ; i++ {
+				select {
+				case <-done:
+					return
+				default:
+					ns.SetWithTags(fmt.Sprintf("k-%d-%d", id, i%100), i, NoTTL, "t")
+				}
+			}
+		})
+	}
+	for range 200 {
+		g.Clear()
+	}
+	close(done)
+	wg.Wait()
+
+	n := g.Len()
+	if l := ns.Len(); l != n {
+		t.Errorf("expected the namespace to count %d entries, got %d", n, l)
+	}
+	if keys := g.ScanPrefix(t.Context(), ""); len(keys) != n {
+		t.Errorf("expected the ordered index to hold %d keys, got %d", n, len(keys))
+	}
+	if got := ns.InvalidateTag("t"); got != uint64(n) {
+		t.Errorf("expected the tag index to hold %d keys, got %d", n, got)
+	}
+}
+
 // TestGache_LenClearConcurrent ensures that clearing the cache during heavy concurrent activity results in a correct and consistent item count.
 func TestGache_LenClearConcurrent(t *testing.T) {
 	t.Parallel()
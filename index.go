@@ -0,0 +1,151 @@
+package gache
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// keyIndex maps derived index keys to the cache keys whose values produce
+// them. Each cache key is reference counted by the number of values deriving
+// the index key, so the index follows overwrites, deletes and expiration
+// through the observer callbacks. It backs both tags and [Gache.AddIndex].
+type keyIndex[V any] struct {
+	derive func(val V, tags []string) []string
+	keys   map[string]map[string]int
+	// prefix restricts the index to the cache keys starting with it.
+	prefix string
+	mu     sync.Mutex
+}
+
+var (
+	// ErrIndexExists is returned by [Gache.AddIndex] when an index with the
+	// same name has already been added.
+	ErrIndexExists = errors.New("gache: index already exists")
+	// ErrNilIndexFunc is returned by [Gache.AddIndex] when the index
+	// function is nil.
+	ErrNilIndexFunc = errors.New("gache: index function is nil")
+)
+
+func newKeyIndex[V any](derive func(val V, tags []string) []string) *keyIndex[V] {
+	return &keyIndex[V]{
+		derive: derive,
+		keys:   make(map[string]map[string]int),
+	}
+}
+
+func (x *keyIndex[V]) insert(key string, val V, tags []string) {
+	if !strings.HasPrefix(key, x.prefix) {
+		return
+	}
+	ids := x.derive(val, tags)
+	if len(ids) == 0 {
+		return
+	}
+	x.mu.Lock()
+	for _, id := range ids {
+		keys, ok := x.keys[id]
+		if !ok {
+			keys = make(map[string]int)
+			x.keys[id] = keys
+		}
+		keys[key]++
+	}
+	x.mu.Unlock()
+}
+
+func (x *keyIndex[V]) release(key string, val V, tags []string) {
+	if !strings.HasPrefix(key, x.prefix) {
+		return
+	}
+	ids := x.derive(val, tags)
+	if len(ids) == 0 {
+		return
+	}
+	x.mu.Lock()
+	for _, id := range ids {
+		keys, ok := x.keys[id]
+		if !ok {
+			continue
+		}
+		if keys[key]--; keys[key] <= 0 {
+			delete(keys, key)
+			if len(keys) == 0 {
+				delete(x.keys, id)
+			}
+		}
+	}
+	x.mu.Unlock()
+}
+
+// keysOf returns a snapshot of the cache keys indexed under id.
+func (x *keyIndex[V]) keysOf(id string) []string {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	keys := make([]string, 0, len(x.keys[id]))
+	for key := range x.keys[id] {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// AddIndex adds a secondary index called name. f derives the index keys of a
+// value, for example its e-mail address, and is re-evaluated on every write,
+// delete and expiration so the index never drifts from the cache. Entries
+// already in the cache are indexed when AddIndex is called, each exactly once
+// even if it is written concurrently. f must be safe for
+// concurrent use and deterministic for a given value. AddIndex returns
+// [ErrIndexExists] if an index with the same name already exists.
+//
+// Example:
+//
+//	gc := gache.New[User]()
+//	gc.AddIndex("email", func(u User) []string { return []string{u.Email} })
+//	gc.Set("user:1", User{ID: 1, Email: "alice@example.com"})
+//
+//	users := gc.GetBy("email", "alice@example.com")
+func (g *gache[V]) AddIndex(name string, f func(V) []string) error {
+	return g.addIndex(name, "", f)
+}
+
+// addIndex implements AddIndex for the cache keys starting with prefix.
+func (g *gache[V]) addIndex(name, prefix string, f func(V) []string) error {
+	if f == nil {
+		return ErrNilIndexFunc
+	}
+	idx := newKeyIndex(func(val V, _ []string) []string { return f(val) })
+	idx.prefix = prefix
+	if _, loaded := g.indexes.LoadOrStorePointer(name, idx); loaded {
+		return ErrIndexExists
+	}
+	g.addObserver(idx)
+	// Index the entries written before the observer was registered. adopt
+	// skips the values already inserted since, so each is counted once.
+	for i := range g.shards {
+		g.shards[i].RangePointer(func(k string, v *value[V]) bool {
+			adopt[V](idx, k, v)
+			return true
+		})
+	}
+	return nil
+}
+
+// GetBy returns, ordered by cache key, the values of all non-expired entries
+// whose index keys in the index called name include indexKey. It returns nil
+// if no such index exists.
+func (g *gache[V]) GetBy(name, indexKey string) (vals []V) {
+	idx, ok := g.indexes.LoadPointer(name)
+	if !ok {
+		return nil
+	}
+	keys := idx.keysOf(indexKey)
+	slices.Sort(keys)
+	for _, key := range keys {
+		v, ok := g.Get(key)
+		if ok && slices.Contains(idx.derive(v, nil), indexKey) {
+			vals = append(vals, v)
+		}
+	}
+	return vals
+}
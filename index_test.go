@@ -0,0 +1,169 @@
+package gache
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type indexedUser struct {
+	Name  string
+	Email string
+	Roles []string
+}
+
+func userEmail(u indexedUser) []string {
+	return []string{u.Email}
+}
+
+// TestGache_GetBy verifies lookups through a secondary index, including multi-valued index keys.
+func TestGache_GetBy(t *testing.T) {
+	t.Helper()
+	gc := New[indexedUser]()
+	if err := gc.AddIndex("email", userEmail); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := gc.AddIndex("role", func(u indexedUser) []string { return u.Roles }); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	gc.Set("user:2", indexedUser{Name: "bob", Email: "bob@example.com", Roles: []string{"dev"}})
+	gc.Set("user:1", indexedUser{Name: "alice", Email: "alice@example.com", Roles: []string{"admin", "dev"}})
+
+	if got := gc.GetBy("email", "alice@example.com"); len(got) != 1 || got[0].Name != "alice" {
+		t.Errorf("expected alice, got %v", got)
+	}
+	got := gc.GetBy("role", "dev")
+	if len(got) != 2 || got[0].Name != "alice" || got[1].Name != "bob" {
+		t.Errorf("expected [alice bob] ordered by key, got %v", got)
+	}
+	if got := gc.GetBy("email", "carol@example.com"); len(got) != 0 {
+		t.Errorf("expected no match, got %v", got)
+	}
+	if got := gc.GetBy("unknown", "dev"); got != nil {
+		t.Errorf("expected nil for an unknown index, got %v", got)
+	}
+}
+
+// TestGache_AddIndexErrors verifies that duplicate names and nil functions are rejected.
+func TestGache_AddIndexErrors(t *testing.T) {
+	t.Helper()
+	gc := New[indexedUser]()
+	if err := gc.AddIndex("email", nil); !errors.Is(err, ErrNilIndexFunc) {
+		t.Errorf("expected ErrNilIndexFunc, got %v", err)
+	}
+	if err := gc.AddIndex("email", userEmail); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := gc.AddIndex("email", userEmail); !errors.Is(err, ErrIndexExists) {
+		t.Errorf("expected ErrIndexExists, got %v", err)
+	}
+}
+
+// TestGache_AddIndexBackfill verifies that entries stored before AddIndex are indexed.
+func TestGache_AddIndexBackfill(t *testing.T) {
+	t.Helper()
+	gc := New[string]()
+	gc.Set("a", "Apple")
+	gc.Set("b", "avocado")
+	gc.Set("c", "banana")
+	if err := gc.AddIndex("initial", func(s string) []string {
+		return []string{strings.ToLower(s[:1])}
+	}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := gc.GetBy("initial", "a"); len(got) != 2 || got[0] != "Apple" || got[1] != "avocado" {
+		t.Errorf("expected [Apple avocado], got %v", got)
+	}
+}
+
+// TestGache_AddIndexBackfillOnce verifies that the backfill of AddIndex does
+// not count again the values written since the index was registered, so that
+// deleting them empties the index.
+func TestGache_AddIndexBackfillOnce(t *testing.T) {
+	t.Helper()
+	gc := New[string]().(*gache[string])
+	gc.Set("before", "x")
+	if err := gc.AddIndex("all", func(string) []string { return []string{"all"} }); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	gc.Set("after", "x")
+	idx, _ := gc.indexes.LoadPointer("all")
+	// Replay the backfill over both values, as if it had raced with the Set.
+	for _, key := range []string{"before", "after"} {
+		v, _ := gc.shards[getShardID(key, gc.maxKeyLength)].LoadPointer(key)
+		adopt[string](idx, key, v)
+	}
+	gc.Delete("before")
+	gc.Delete("after")
+	if keys := idx.keysOf("all"); len(keys) != 0 {
+		t.Errorf("expected deletes to empty the index, got %v", keys)
+	}
+
+	// Concurrent writers racing with the backfill of another index.
+	var wg sync.WaitGroup
+	for w := range 4 {
+		wg.Go(func() {
+			for i := range 500 {
+				gc.Set(strconv.Itoa(w*1000+i%50), "x")
+			}
+		})
+	}
+	if err := gc.AddIndex("racy", func(string) []string { return []string{"racy"} }); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	wg.Wait()
+	for w := range 4 {
+		for i := range 50 {
+			gc.Delete(strconv.Itoa(w*1000 + i))
+		}
+	}
+	racy, _ := gc.indexes.LoadPointer("racy")
+	if keys := racy.keysOf("racy"); len(keys) != 0 {
+		t.Errorf("expected deletes to empty the racy index, got %d keys", len(keys))
+	}
+}
+
+// TestGache_IndexConsistency verifies that the index follows overwrites, deletes, expiration and Clear.
+func TestGache_IndexConsistency(t *testing.T) {
+	t.Helper()
+	gc := New[indexedUser]()
+	if err := gc.AddIndex("email", userEmail); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	gc.Set("user:1", indexedUser{Name: "alice", Email: "old@example.com"})
+	gc.Set("user:1", indexedUser{Name: "alice", Email: "new@example.com"})
+	if got := gc.GetBy("email", "old@example.com"); len(got) != 0 {
+		t.Errorf("expected the old email to be unindexed, got %v", got)
+	}
+	if got := gc.GetBy("email", "new@example.com"); len(got) != 1 {
+		t.Errorf("expected the new email to be indexed, got %v", got)
+	}
+	idx, _ := gc.(*gache[indexedUser]).indexes.LoadPointer("email")
+	if keys := idx.keysOf("old@example.com"); len(keys) != 0 {
+		t.Errorf("expected no references to the old email, got %v", keys)
+	}
+
+	gc.Delete("user:1")
+	if got := gc.GetBy("email", "new@example.com"); len(got) != 0 {
+		t.Errorf("expected deleted entry to be unindexed, got %v", got)
+	}
+
+	gc.SetWithExpire("user:2", indexedUser{Name: "bob", Email: "bob@example.com"}, 50*time.Millisecond)
+	time.Sleep(150 * time.Millisecond)
+	if got := gc.GetBy("email", "bob@example.com"); len(got) != 0 {
+		t.Errorf("expected expired entry to be excluded, got %v", got)
+	}
+	if keys := idx.keysOf("bob@example.com"); len(keys) != 0 {
+		t.Errorf("expected expired entry to be unindexed, got %v", keys)
+	}
+
+	gc.Set("user:3", indexedUser{Name: "carol", Email: "carol@example.com"})
+	gc.Clear()
+	if keys := idx.keysOf("carol@example.com"); len(keys) != 0 {
+		t.Errorf("expected Clear to empty the index, got %v", keys)
+	}
+}
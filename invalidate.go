@@ -0,0 +1,312 @@
+package gache
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"math/bits"
+	"slices"
+	"sync"
+)
+
+type (
+	// Invalidation is a message telling the other caches on a [Bus] to drop
+	// their copies of Keys, or all their entries if Clear is set.
+	Invalidation struct {
+		// Origin identifies the cache that published the message.
+		Origin string
+		// Seq numbers the messages of Origin consecutively, starting at 1.
+		Seq uint64
+		// Keys are the keys written or deleted on Origin.
+		Keys []string
+		// Clear reports that Origin was cleared; Keys is empty then.
+		Clear bool
+	}
+
+	// Bus carries invalidation messages between caches, typically in
+	// different processes. Messages may be lost, duplicated or reordered;
+	// duplicates are discarded by the receiving cache. Implementations must
+	// be safe for concurrent use.
+	Bus interface {
+		// Publish sends msg to the other caches on the bus.
+		Publish(msg Invalidation) error
+		// Subscribe calls f with every message received until cancel is
+		// called. f may receive the subscriber's own messages.
+		Subscribe(f func(Invalidation)) (cancel func())
+	}
+
+	// InvalidationOption configures [WithInvalidationBus].
+	InvalidationOption func(*invalidationConfig)
+
+	invalidationConfig struct {
+		origin  string
+		onGap   func(origin string, missed uint64)
+		onError func(err error)
+	}
+
+	// invalidator publishes the keys written to a cache and applies the
+	// invalidations published by other caches. Keys written between two
+	// publications are coalesced in pending, and cleared records a Clear
+	// that has not been published yet.
+	invalidator[V any] struct {
+		g       *gache[V]
+		bus     Bus
+		cfg     invalidationConfig
+		cancel  func()
+		mu      sync.Mutex
+		pending map[string]struct{}
+		cleared bool
+		seq     uint64
+		// windows tracks the sequence numbers received from each origin.
+		windows map[string]*seqWindow
+		wmu     sync.Mutex
+		kick    chan struct{}
+		done    chan struct{}
+		closed  chan struct{}
+		once    sync.Once
+	}
+
+	// seqWindow remembers which of the last 64 sequence numbers up to high
+	// have been received; bit i of seen stands for high-i.
+	seqWindow struct {
+		high uint64
+		seen uint64
+	}
+)
+
+const (
+	// maxInvalidationKeys and maxInvalidationBytes bound the size of one
+	// message so that it fits into a single datagram.
+	maxInvalidationKeys  = 256
+	maxInvalidationBytes = 32 << 10
+)
+
+// WithNodeID names the cache in the messages it publishes. A random suffix
+// is appended so that a restarted process is not mistaken for a duplicate
+// of its previous incarnation. By default the name is random.
+func WithNodeID(id string) InvalidationOption {
+	return func(c *invalidationConfig) {
+		c.origin = id
+	}
+}
+
+// WithInvalidationGapHandler sets a function called when messages from
+// origin were lost, as detected from gaps in their sequence numbers. Copies
+// of the keys in lost messages may be stale; a handler can, for example,
+// Clear the cache.
+func WithInvalidationGapHandler(f func(origin string, missed uint64)) InvalidationOption {
+	return func(c *invalidationConfig) {
+		c.onGap = f
+	}
+}
+
+// WithInvalidationErrorHandler sets a function called when publishing a
+// message fails.
+func WithInvalidationErrorHandler(f func(err error)) InvalidationOption {
+	return func(c *invalidationConfig) {
+		c.onError = f
+	}
+}
+
+// ErrNilBus is returned by [WithInvalidationBus] for a nil Bus.
+var ErrNilBus = errors.New("gache: invalidation bus must not be nil")
+
+// WithInvalidationBus connects the cache to the other caches on bus. Every
+// Set, conditional set, Compute, Txn, SetMulti, Delete, Pop, DeleteMulti,
+// CompareAndDelete, DeleteIfVersion, DeleteIf, DeletePrefix and InvalidateTag
+// publishes the affected keys, and keys published by other caches are dropped
+// from this one, so that the next read misses or reloads from the [Store].
+// Clear clears the other caches too. Expiration and eviction stay local.
+//
+// Keys are published asynchronously, coalescing keys written in quick
+// succession into one message. [Gache.Close] publishes the pending keys and
+// unsubscribes from bus.
+//
+// Example:
+//
+//	b, _ := bus.ListenUDP(":7946", "10.0.0.2:7946", "10.0.0.3:7946")
+//	defer b.Close()
+//	gc := gache.New[User](
+//	    gache.WithInvalidationBus[User](b, gache.WithNodeID(hostname)),
+//	)
+//	defer gc.Close()
+func WithInvalidationBus[V any](bus Bus, opts ...InvalidationOption) Option[V] {
+	return func(g *gache[V]) error {
+		if bus == nil {
+			return ErrNilBus
+		}
+		inv := &invalidator[V]{
+			g:       g,
+			bus:     bus,
+			pending: make(map[string]struct{}),
+			windows: make(map[string]*seqWindow),
+			kick:    make(chan struct{}, 1),
+			done:    make(chan struct{}),
+			closed:  make(chan struct{}),
+		}
+		for _, opt := range opts {
+			opt(&inv.cfg)
+		}
+		var incarnation [8]byte
+		rand.Read(incarnation[:])
+		if inv.cfg.origin != "" {
+			inv.cfg.origin += "#"
+		}
+		inv.cfg.origin += hex.EncodeToString(incarnation[:])
+		if g.invalidator != nil {
+			g.invalidator.close()
+		}
+		g.invalidator = inv
+		inv.cancel = bus.Subscribe(inv.receive)
+		go inv.run()
+		return nil
+	}
+}
+
+// publish queues key for the next message.
+func (inv *invalidator[V]) publish(key string) {
+	inv.mu.Lock()
+	inv.pending[key] = struct{}{}
+	inv.mu.Unlock()
+	select {
+	case inv.kick <- struct{}{}:
+	default:
+	}
+}
+
+// publishClear queues a message clearing the other caches.
+func (inv *invalidator[V]) publishClear() {
+	inv.mu.Lock()
+	inv.cleared = true
+	inv.mu.Unlock()
+	select {
+	case inv.kick <- struct{}{}:
+	default:
+	}
+}
+
+// run publishes the pending keys whenever keys are queued and a last time
+// when the invalidator is closed.
+func (inv *invalidator[V]) run() {
+	defer close(inv.done)
+	for {
+		select {
+		case <-inv.closed:
+			inv.flush()
+			return
+		case <-inv.kick:
+		}
+		inv.flush()
+	}
+}
+
+// flush publishes a pending clear and then the pending keys in messages of
+// bounded size.
+func (inv *invalidator[V]) flush() {
+	inv.mu.Lock()
+	cleared := inv.cleared
+	inv.cleared = false
+	keys := make([]string, 0, len(inv.pending))
+	for key := range inv.pending {
+		keys = append(keys, key)
+	}
+	clear(inv.pending)
+	inv.mu.Unlock()
+	slices.Sort(keys)
+
+	if cleared {
+		inv.seq++
+		msg := Invalidation{Origin: inv.cfg.origin, Seq: inv.seq, Clear: true}
+		if err := inv.bus.Publish(msg); err != nil && inv.cfg.onError != nil {
+			inv.cfg.onError(err)
+		}
+	}
+
+	for len(keys) > 0 {
+		n, size := 0, 0
+		for n < len(keys) && n < maxInvalidationKeys &&
+			(n == 0 || size+len(keys[n]) <= maxInvalidationBytes) {
+			size += len(keys[n])
+			n++
+		}
+		inv.seq++
+		msg := Invalidation{Origin: inv.cfg.origin, Seq: inv.seq, Keys: keys[:n:n]}
+		if err := inv.bus.Publish(msg); err != nil && inv.cfg.onError != nil {
+			inv.cfg.onError(err)
+		}
+		keys = keys[n:]
+	}
+}
+
+// receive drops the keys of a message from another cache, unless the
+// message is a duplicate.
+func (inv *invalidator[V]) receive(msg Invalidation) {
+	if msg.Origin == inv.cfg.origin {
+		return
+	}
+	inv.wmu.Lock()
+	w, ok := inv.windows[msg.Origin]
+	if !ok {
+		w = new(seqWindow)
+		inv.windows[msg.Origin] = w
+	}
+	fresh, missed := w.observe(msg.Seq)
+	inv.wmu.Unlock()
+	if missed > 0 && inv.cfg.onGap != nil {
+		inv.cfg.onGap(msg.Origin, missed)
+	}
+	if !fresh {
+		return
+	}
+	g := inv.g
+	if msg.Clear {
+		g.clearLocal()
+	}
+	for _, key := range msg.Keys {
+		g.deleteFrom(g.shards[getShardID(key, g.maxKeyLength)], key)
+		g.dropSpilled(key)
+	}
+}
+
+// close stops receiving and publishes the pending keys.
+func (inv *invalidator[V]) close() {
+	inv.once.Do(func() {
+		inv.cancel()
+		close(inv.closed)
+		<-inv.done
+	})
+}
+
+// observe records seq and reports whether it was not received before and how
+// many earlier sequence numbers left the window without being received.
+// Sequence numbers older than the window are reported as fresh: applying an
+// invalidation twice is harmless, missing one is not.
+func (w *seqWindow) observe(seq uint64) (fresh bool, missed uint64) {
+	if w.high == 0 {
+		// Messages published before the first one received are not missed.
+		w.high, w.seen = seq, ^uint64(0)
+		return true, 0
+	}
+	if seq > w.high {
+		shift := seq - w.high
+		if shift >= 64 {
+			missed = uint64(64-bits.OnesCount64(w.seen)) + shift - 64
+			w.seen = 0
+		} else {
+			missed = shift - uint64(bits.OnesCount64(w.seen>>(64-shift)))
+			w.seen <<= shift
+		}
+		w.high = seq
+		w.seen |= 1
+		return true, missed
+	}
+	off := w.high - seq
+	if off >= 64 {
+		return true, 0
+	}
+	if w.seen&(1<<off) != 0 {
+		return false, 0
+	}
+	w.seen |= 1 << off
+	return true, 0
+}
@@ -0,0 +1,176 @@
+package gache
+
+import (
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testBus delivers every message synchronously to all subscribers, dup times.
+type testBus struct {
+	mu   sync.Mutex
+	subs map[int]func(Invalidation)
+	next int
+	dup  int
+	// sent and delivered count messages before and after delivery.
+	sent, delivered atomic.Int64
+}
+
+func newTestBus() *testBus {
+	return &testBus{subs: make(map[int]func(Invalidation)), dup: 1}
+}
+
+func (b *testBus) Publish(msg Invalidation) error {
+	b.sent.Add(1)
+	b.mu.Lock()
+	subs := make([]func(Invalidation), 0, len(b.subs))
+	for _, f := range b.subs {
+		subs = append(subs, f)
+	}
+	b.mu.Unlock()
+	for range b.dup {
+		for _, f := range subs {
+			f(msg)
+		}
+	}
+	b.delivered.Add(1)
+	return nil
+}
+
+func (b *testBus) Subscribe(f func(Invalidation)) func() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	id := b.next
+	b.next++
+	b.subs[id] = f
+	return func() {
+		b.mu.Lock()
+		delete(b.subs, id)
+		b.mu.Unlock()
+	}
+}
+
+// eventually fails the test unless cond becomes true within a second.
+func eventually(t *testing.T, cond func() bool, msg string) {
+	t.Helper()
+	for deadline := time.Now().Add(time.Second); !cond(); {
+		if time.Now().After(deadline) {
+			t.Fatal(msg)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// TestGache_InvalidationBus verifies that writes, deletes and InvalidateTag
+// on one cache drop the key from the others, but not from the writer, and
+// that Clear clears the others.
+func TestGache_InvalidationBus(t *testing.T) {
+	t.Helper()
+	bus := newTestBus()
+	a := New(WithInvalidationBus[string](bus, WithNodeID("a")))
+	b := New(WithInvalidationBus[string](bus, WithNodeID("b")))
+	defer a.Close()
+	defer b.Close()
+
+	b.Set("k", "stale")
+	eventually(t, func() bool { return bus.delivered.Load() == 1 }, "expected the write of k to be published")
+	a.Set("k", "fresh")
+	eventually(t, func() bool { _, ok := b.Get("k"); return !ok }, "expected Set on a to drop k from b")
+	if v, ok := a.Get("k"); !ok || v != "fresh" {
+		t.Errorf("expected a to keep its own write, got %q, %v", v, ok)
+	}
+
+	b.Set("d", "x")
+	eventually(t, func() bool { return bus.delivered.Load() == 3 }, "expected the write of d to be published")
+	a.Delete("d")
+	eventually(t, func() bool { _, ok := b.Get("d"); return !ok }, "expected Delete on a to drop d from b")
+
+	a.SetWithTags("t", "x", NoTTL, "group")
+	eventually(t, func() bool { return bus.delivered.Load() == 5 }, "expected the tagged write of t to be published")
+	var invalidated atomic.Bool
+	bus.Subscribe(func(msg Invalidation) {
+		if slices.Contains(msg.Keys, "t") {
+			invalidated.Store(true)
+		}
+	})
+	if a.InvalidateTag("group") != 1 {
+		t.Fatal("expected InvalidateTag to remove t")
+	}
+	eventually(t, invalidated.Load, "expected InvalidateTag on a to publish t")
+
+	b.Set("c", "x")
+	a.Clear()
+	eventually(t, func() bool { return b.Len() == 0 }, "expected Clear on a to clear b")
+
+	// Expiration stays local.
+	sent := bus.sent.Load()
+	a.SetWithExpire("e", "x", 10*time.Millisecond)
+	eventually(t, func() bool { return bus.sent.Load() > sent }, "expected the write of e to be published")
+	sent = bus.sent.Load()
+	time.Sleep(50 * time.Millisecond)
+	a.Get("e")
+	time.Sleep(20 * time.Millisecond)
+	if n := bus.sent.Load(); n != sent {
+		t.Errorf("expected expiration not to publish, got %d messages", n-sent)
+	}
+}
+
+// TestGache_InvalidationDuplicates verifies that duplicated messages are
+// applied once and that Close publishes the pending keys.
+func TestGache_InvalidationDuplicates(t *testing.T) {
+	t.Helper()
+	bus := newTestBus()
+	bus.dup = 2
+	var received atomic.Int64
+	bus.Subscribe(func(Invalidation) { received.Add(1) })
+	a := New(WithInvalidationBus[int](bus))
+	b := New(WithInvalidationBus[int](bus))
+	defer b.Close()
+
+	for i := range 100 {
+		a.Set("k"+string(rune('a'+i%26)), i)
+	}
+	a.Close()
+	if received.Load() != 2*bus.sent.Load() {
+		t.Fatalf("expected every message to be delivered twice")
+	}
+
+	b.Set("k", 1)
+	applied := 0
+	inv := b.(*gache[int]).invalidator
+	for range 2 {
+		before := b.Len()
+		inv.receive(Invalidation{Origin: "x", Seq: 1, Keys: []string{"k"}})
+		applied += before - b.Len()
+		b.Set("k", 1)
+	}
+	if applied != 1 {
+		t.Errorf("expected a duplicate message to be ignored, applied %d times", applied)
+	}
+}
+
+// TestSeqWindow verifies duplicate and gap detection of sequence numbers.
+func TestSeqWindow(t *testing.T) {
+	t.Helper()
+	var w seqWindow
+	check := func(seq uint64, fresh bool, missed uint64) {
+		t.Helper()
+		if f, m := w.observe(seq); f != fresh || m != missed {
+			t.Fatalf("observe(%d): expected (%v, %d), got (%v, %d)", seq, fresh, missed, f, m)
+		}
+	}
+	check(10, true, 0)
+	check(10, false, 0)
+	check(12, true, 0)
+	check(11, true, 0)
+	check(11, false, 0)
+	check(14, true, 0)
+	// 13 leaves the window unseen once 77 arrives.
+	check(77, true, 1)
+	check(13, true, 0)
+	// 15 to 76 leave the window unseen, as do 78 to 236.
+	check(300, true, 62+159)
+	check(299, true, 0)
+}
@@ -0,0 +1,78 @@
+package gache
+
+import (
+	"context"
+	"iter"
+	"sync/atomic"
+
+	"github.com/kpango/fastime"
+)
+
+// All returns an iterator over the key-value pairs of all non-expired entries.
+// Unlike [Gache.Range] it walks the shards one by one in the calling goroutine
+// and does not build intermediate slices, so breaking out of the loop stops
+// the iteration immediately. Expired entries encountered are removed as in
+// Range, firing the expired hook if enabled. The iteration also stops when
+// ctx is cancelled.
+//
+// Example:
+//
+//	for key, val := range gc.All(ctx) {
+//	    fmt.Println(key, val)
+//	}
+func (g *gache[V]) All(ctx context.Context) iter.Seq2[string, V] {
+	return func(yield func(string, V) bool) {
+		cancelable := ctx.Done() != nil
+		for i, shard := range g.shards {
+			if cancelable && i&63 == 0 && ctx.Err() != nil {
+				return
+			}
+			now := fastime.UnixNanoNow()
+			for k, e := range shard.readMap() {
+				v, ok := e.loadPointer()
+				if !ok {
+					continue
+				}
+				v.mu.RLock()
+				if v.key != k {
+					v.mu.RUnlock()
+					continue
+				}
+				val := v.val
+				expire := atomic.LoadInt64(&v.expire)
+				v.mu.RUnlock()
+				if expire > 0 && now > expire {
+					g.expiration(k)
+					continue
+				}
+				if !yield(k, val) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// KeysSeq returns an iterator over the keys of all non-expired entries. It is
+// the streaming counterpart of [Gache.Keys]; see [Gache.All].
+func (g *gache[V]) KeysSeq(ctx context.Context) iter.Seq[string] {
+	return func(yield func(string) bool) {
+		for k := range g.All(ctx) {
+			if !yield(k) {
+				return
+			}
+		}
+	}
+}
+
+// ValuesSeq returns an iterator over the values of all non-expired entries.
+// It is the streaming counterpart of [Gache.Values]; see [Gache.All].
+func (g *gache[V]) ValuesSeq(ctx context.Context) iter.Seq[V] {
+	return func(yield func(V) bool) {
+		for _, v := range g.All(ctx) {
+			if !yield(v) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package gache
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// TestGache_All verifies that the iterators visit every live entry once, skip expired entries and stop on break.
+func TestGache_All(t *testing.T) {
+	t.Helper()
+	gc := New[int]()
+	for i := range 1000 {
+		gc.Set(fmt.Sprintf("key-%d", i), i)
+	}
+	gc.SetWithExpire("expired", -1, 50*time.Millisecond)
+	time.Sleep(150 * time.Millisecond)
+
+	seen := make(map[string]int)
+	for k, v := range gc.All(t.Context()) {
+		if v < 0 {
+			t.Fatalf("expected expired entry %s to be skipped", k)
+		}
+		seen[k] = v
+	}
+	if len(seen) != 1000 {
+		t.Errorf("expected 1000 entries, got %d", len(seen))
+	}
+	if _, ok := gc.GetWithIgnoredExpire("expired"); ok {
+		t.Error("expected the expired entry to be removed during iteration")
+	}
+
+	var keys, sum int
+	for range gc.KeysSeq(t.Context()) {
+		keys++
+	}
+	for v := range gc.ValuesSeq(t.Context()) {
+		sum += v
+	}
+	if keys != 1000 || sum != 999*1000/2 {
+		t.Errorf("expected 1000 keys summing to %d, got %d keys summing to %d", 999*1000/2, keys, sum)
+	}
+
+	var n int
+	for range gc.All(t.Context()) {
+		n++
+		if n == 10 {
+			break
+		}
+	}
+	if n != 10 {
+		t.Errorf("expected break to stop after 10 entries, got %d", n)
+	}
+}
+
+// TestGache_AllContextCancellation verifies that cancelling the context stops the iteration.
+func TestGache_AllContextCancellation(t *testing.T) {
+	gc := New[int]()
+	for i := range 10000 {
+		gc.Set(fmt.Sprintf("k-%d", i), i)
+	}
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+	var n int
+	for range gc.All(ctx) {
+		n++
+	}
+	if n != 0 {
+		t.Errorf("expected no entries from a cancelled context, got %d", n)
+	}
+}
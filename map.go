@@ -30,6 +30,7 @@
 package gache
 
 import (
+	"iter"
 	"reflect"
 	"sync"
 	"sync/atomic"
@@ -455,6 +456,23 @@ func (m *Map[K, V]) CompareAndDelete(key K, old V) (deleted bool) {
 	return false
 }
 
+// CompareAndDeletePointer deletes the entry for key only if it currently
+// holds the pointer old.
+func (m *Map[K, V]) CompareAndDeletePointer(key K, old *V) (deleted bool) {
+	if old == nil || old == expungedPtr[V]() {
+		return false
+	}
+	e, ok := m.loadEntry(key, false)
+	if !ok || e == nil {
+		return false
+	}
+	if e.p.CompareAndSwap(old, nil) {
+		e.c.Add(-1)
+		return true
+	}
+	return false
+}
+
 func (m *Map[K, V]) Range(f func(key K, value V) bool) {
 	m.RangePointer(func(key K, value *V) bool {
 		return f(key, *value)
@@ -473,6 +491,22 @@ func (m *Map[K, V]) RangePointer(f func(key K, value *V) bool) {
 	}
 }
 
+// All returns an iterator over the key-value pairs in the map, with the same
+// consistency guarantees as Range.
+func (m *Map[K, V]) All() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		for k, e := range m.readMap() {
+			v, ok := e.loadPointer()
+			if !ok {
+				continue
+			}
+			if !yield(k, *v) {
+				return
+			}
+		}
+	}
+}
+
 // readMap returns the read map for direct iteration in the common
 // steady-state case: the map has entries and no dirty-promotion is needed.
 // Returns (map, true) if the result is complete, (nil, true) if the map is
@@ -29,6 +29,7 @@ import (
 	"math/rand"
 	"reflect"
 	"runtime"
+	"strconv"
 	"sync"
 	"sync/atomic"
 	"testing"
@@ -621,3 +622,39 @@ func TestMap_RangeNestedCall(t *testing.T) {
 		t.Fatalf("Unexpected gache.Map[any, any] size, got %v want %v", length, 0)
 	}
 }
+
+// TestMap_All verifies that the All iterator yields every stored pair once and stops when the loop breaks.
+func TestMap_All(t *testing.T) {
+	var m gache.Map[int, string]
+	for i := range 100 {
+		m.Store(i, strconv.Itoa(i))
+	}
+	m.Delete(42)
+
+	seen := make(map[int]string)
+	for k, v := range m.All() {
+		seen[k] = v
+	}
+	if len(seen) != 99 {
+		t.Fatalf("expected 99 entries, got %d", len(seen))
+	}
+	if _, ok := seen[42]; ok {
+		t.Fatal("expected deleted key 42 to be skipped")
+	}
+	for k, v := range seen {
+		if v != strconv.Itoa(k) {
+			t.Errorf("expected %d=%q, got %q", k, strconv.Itoa(k), v)
+		}
+	}
+
+	var n int
+	for range m.All() {
+		n++
+		if n == 5 {
+			break
+		}
+	}
+	if n != 5 {
+		t.Fatalf("expected break to stop after 5 entries, got %d", n)
+	}
+}
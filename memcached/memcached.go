@@ -0,0 +1,632 @@
+// Package memcached serves a gache cache over the memcached text protocol, so
+// that existing memcached clients can use a gache process in place of a
+// memcached server.
+//
+// Supported commands are get, gets, set, add, replace, append, prepend, cas,
+// delete, incr, decr, touch, flush_all and stats, plus version, verbosity
+// and quit. Values are stored as [Item]s carrying the client flags, and cas
+// uniques are the versions reported by [gache.Gache.GetVersioned]. As in
+// memcached, an exptime of 0 never expires, a negative one expires
+// immediately and one greater than 30 days is an absolute Unix time.
+//
+// Example:
+//
+//	gc := gache.New[memcached.Item]().StartExpired(ctx, time.Second)
+//	srv := memcached.New(gc)
+//	go srv.ListenAndServe("127.0.0.1:11211")
+//	defer srv.Close()
+package memcached
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/kpango/gache/v2"
+)
+
+// Item is a value stored through the memcached protocol.
+type Item struct {
+	// Value is the data stored by the client.
+	Value []byte
+	// Flags is the opaque client flags word stored along with the data.
+	Flags uint32
+}
+
+// ErrServerClosed is returned by [Server.Serve] after [Server.Close].
+var ErrServerClosed = errors.New("memcached: server closed")
+
+const (
+	// maxRelativeExptime is the largest exptime interpreted as a number of
+	// seconds from now; larger values are absolute Unix times.
+	maxRelativeExptime = 60 * 60 * 24 * 30
+	// maxKeyLength is the longest key memcached accepts.
+	maxKeyLength = 250
+	// maxItemSize bounds the size of a value, like memcached's default
+	// item size limit.
+	maxItemSize = 1 << 20
+	// maxLine bounds the length of a command line; it is also the size of
+	// the connection's read buffer.
+	maxLine = 64 << 10
+
+	version = "1.6.0-gache"
+)
+
+// Server serves a [gache.Gache] to memcached clients.
+type Server struct {
+	gc         gache.Gache[Item]
+	start      time.Time
+	mu         sync.Mutex
+	listeners  map[net.Listener]struct{}
+	conns      map[net.Conn]struct{}
+	flushTimer *time.Timer
+	wg         sync.WaitGroup
+	closed     atomic.Bool
+	stats      stats
+}
+
+type stats struct {
+	currConns    atomic.Int64
+	totalConns   atomic.Uint64
+	cmdGet       atomic.Uint64
+	cmdSet       atomic.Uint64
+	cmdTouch     atomic.Uint64
+	cmdFlush     atomic.Uint64
+	getHits      atomic.Uint64
+	getMisses    atomic.Uint64
+	deleteHits   atomic.Uint64
+	deleteMisses atomic.Uint64
+	casHits      atomic.Uint64
+	casMisses    atomic.Uint64
+	casBadval    atomic.Uint64
+}
+
+// New returns a Server for gc.
+func New(gc gache.Gache[Item]) *Server {
+	return &Server{
+		gc:        gc,
+		start:     time.Now(),
+		listeners: make(map[net.Listener]struct{}),
+		conns:     make(map[net.Conn]struct{}),
+	}
+}
+
+// ListenAndServe listens on the TCP address addr and calls [Server.Serve].
+func (s *Server) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
+
+// Serve accepts connections on l and serves each in its own goroutine until
+// l fails or the server is closed. It always returns a non-nil error.
+func (s *Server) Serve(l net.Listener) error {
+	if !s.track(l, nil) {
+		l.Close()
+		return ErrServerClosed
+	}
+	defer s.untrack(l, nil)
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if s.closed.Load() {
+				return ErrServerClosed
+			}
+			return err
+		}
+		if !s.track(nil, conn) {
+			conn.Close()
+			return ErrServerClosed
+		}
+		s.wg.Go(func() {
+			defer s.untrack(nil, conn)
+			s.serveConn(conn)
+		})
+	}
+}
+
+// Close closes all listeners and connections, cancels a delayed flush_all
+// and waits for the connection goroutines to return.
+func (s *Server) Close() error {
+	s.closed.Store(true)
+	s.mu.Lock()
+	for l := range s.listeners {
+		l.Close()
+	}
+	for c := range s.conns {
+		c.Close()
+	}
+	if s.flushTimer != nil {
+		s.flushTimer.Stop()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	return nil
+}
+
+func (s *Server) track(l net.Listener, c net.Conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed.Load() {
+		return false
+	}
+	if l != nil {
+		s.listeners[l] = struct{}{}
+	}
+	if c != nil {
+		s.conns[c] = struct{}{}
+	}
+	return true
+}
+
+func (s *Server) untrack(l net.Listener, c net.Conn) {
+	s.mu.Lock()
+	delete(s.listeners, l)
+	delete(s.conns, c)
+	s.mu.Unlock()
+}
+
+// errBadChunk reports a data block that is not terminated by "\r\n"; the
+// rest of the stream cannot be parsed, so the connection is closed.
+var errBadChunk = errors.New("bad data chunk")
+
+func (s *Server) serveConn(conn net.Conn) {
+	s.stats.currConns.Add(1)
+	s.stats.totalConns.Add(1)
+	defer s.stats.currConns.Add(-1)
+	defer conn.Close()
+	r := bufio.NewReaderSize(conn, maxLine)
+	w := bufio.NewWriter(conn)
+	for {
+		line, err := r.ReadSlice('\n')
+		if errors.Is(err, bufio.ErrBufferFull) {
+			w.WriteString("CLIENT_ERROR line too long\r\n")
+			w.Flush()
+			return
+		}
+		if err != nil {
+			return
+		}
+		// The line is copied because reading a data block reuses the buffer.
+		quit, err := s.exec(r, w, bytes.Fields(bytes.Clone(line)))
+		if errors.Is(err, errBadChunk) {
+			w.WriteString("CLIENT_ERROR bad data chunk\r\n")
+		}
+		if quit || err != nil {
+			w.Flush()
+			return
+		}
+		// Flush once the pipelined commands received so far are answered.
+		if r.Buffered() == 0 {
+			if err := w.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+const (
+	errFormat = "CLIENT_ERROR bad command line format\r\n"
+	stored    = "STORED\r\n"
+	notStored = "NOT_STORED\r\n"
+	exists    = "EXISTS\r\n"
+	notFound  = "NOT_FOUND\r\n"
+)
+
+// exec runs one command and reports whether the connection must be closed.
+// Errors are returned only when the connection cannot be used any further.
+func (s *Server) exec(r *bufio.Reader, w *bufio.Writer, args [][]byte) (quit bool, err error) {
+	if len(args) == 0 {
+		w.WriteString("ERROR\r\n")
+		return false, nil
+	}
+	switch cmd := string(args[0]); cmd {
+	case "get", "gets":
+		s.get(w, args[1:], cmd == "gets")
+	case "set", "add", "replace", "append", "prepend", "cas":
+		return false, s.storage(r, w, cmd, args[1:])
+	case "delete":
+		s.delete(w, args[1:])
+	case "incr", "decr":
+		s.incr(w, args[1:], cmd == "incr")
+	case "touch":
+		s.touch(w, args[1:])
+	case "flush_all":
+		s.flushAll(w, args[1:])
+	case "stats":
+		s.writeStats(w, args[1:])
+	case "version":
+		w.WriteString("VERSION " + version + "\r\n")
+	case "verbosity":
+		_, quiet := noreply(args[1:])
+		reply(w, quiet, "OK\r\n")
+	case "quit":
+		return true, nil
+	default:
+		w.WriteString("ERROR\r\n")
+	}
+	return false, nil
+}
+
+// noreply strips a trailing "noreply" from args and reports whether it was
+// present.
+func noreply(args [][]byte) ([][]byte, bool) {
+	if n := len(args); n > 0 && string(args[n-1]) == "noreply" {
+		return args[:n-1], true
+	}
+	return args, false
+}
+
+func reply(w *bufio.Writer, quiet bool, msg string) {
+	if !quiet {
+		w.WriteString(msg)
+	}
+}
+
+func validKey(key []byte) bool {
+	return len(key) > 0 && len(key) <= maxKeyLength
+}
+
+// expiry converts a memcached exptime to a gache TTL and reports whether
+// the item is already expired.
+func expiry(exptime int64) (ttl time.Duration, expired bool) {
+	switch {
+	case exptime == 0:
+		return gache.NoTTL, false
+	case exptime < 0:
+		return 0, true
+	case exptime > maxRelativeExptime:
+		ttl = time.Until(time.Unix(exptime, 0))
+		return ttl, ttl <= 0
+	}
+	return time.Duration(exptime) * time.Second, false
+}
+
+func (s *Server) get(w *bufio.Writer, keys [][]byte, withCAS bool) {
+	if len(keys) == 0 {
+		w.WriteString("ERROR\r\n")
+		return
+	}
+	for _, k := range keys {
+		key := string(k)
+		s.stats.cmdGet.Add(1)
+		var (
+			item Item
+			ver  uint64
+			ok   bool
+		)
+		if withCAS {
+			item, ver, ok = s.gc.GetVersioned(key)
+		} else {
+			item, ok = s.gc.Get(key)
+		}
+		if !ok {
+			s.stats.getMisses.Add(1)
+			continue
+		}
+		s.stats.getHits.Add(1)
+		w.WriteString("VALUE ")
+		w.WriteString(key)
+		w.WriteByte(' ')
+		w.WriteString(strconv.FormatUint(uint64(item.Flags), 10))
+		w.WriteByte(' ')
+		w.WriteString(strconv.Itoa(len(item.Value)))
+		if withCAS {
+			w.WriteByte(' ')
+			w.WriteString(strconv.FormatUint(ver, 10))
+		}
+		w.WriteString("\r\n")
+		w.Write(item.Value)
+		w.WriteString("\r\n")
+	}
+	w.WriteString("END\r\n")
+}
+
+// storage handles "<cmd> <key> <flags> <exptime> <bytes> [<cas>] [noreply]"
+// followed by a data block.
+func (s *Server) storage(r *bufio.Reader, w *bufio.Writer, cmd string, args [][]byte) error {
+	args, quiet := noreply(args)
+	want := 4
+	if cmd == "cas" {
+		want = 5
+	}
+	if len(args) != want {
+		w.WriteString("ERROR\r\n")
+		return nil
+	}
+	flags, ferr := strconv.ParseUint(string(args[1]), 10, 32)
+	exptime, eerr := strconv.ParseInt(string(args[2]), 10, 64)
+	size, serr := strconv.Atoi(string(args[3]))
+	var (
+		cas  uint64
+		cerr error
+	)
+	if cmd == "cas" {
+		cas, cerr = strconv.ParseUint(string(args[4]), 10, 64)
+	}
+	if serr != nil || size < 0 {
+		// Without a length the data block cannot be skipped.
+		return errBadChunk
+	}
+	data, err := readData(r, size)
+	if err != nil {
+		return err
+	}
+	switch {
+	case ferr != nil || eerr != nil || cerr != nil || !validKey(args[0]):
+		w.WriteString(errFormat)
+		return nil
+	case size > maxItemSize:
+		w.WriteString("SERVER_ERROR object too large for cache\r\n")
+		return nil
+	}
+	s.stats.cmdSet.Add(1)
+	item := Item{Value: data, Flags: uint32(flags)}
+	reply(w, quiet, s.store(cmd, string(args[0]), item, exptime, cas))
+	return nil
+}
+
+// readData reads a data block of size bytes and its "\r\n" terminator.
+// Blocks larger than maxItemSize are discarded and returned as nil.
+func readData(r *bufio.Reader, size int) ([]byte, error) {
+	if size > maxItemSize {
+		if _, err := r.Discard(size); err != nil {
+			return nil, err
+		}
+		size = 0
+	}
+	buf := make([]byte, size+2)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, err
+	}
+	if buf[size] != '\r' || buf[size+1] != '\n' {
+		return nil, errBadChunk
+	}
+	return buf[:size:size], nil
+}
+
+// store applies a storage command and returns its reply.
+func (s *Server) store(cmd, key string, item Item, exptime int64, cas uint64) string {
+	ttl, expired := expiry(exptime)
+	switch cmd {
+	case "set":
+		if expired {
+			s.gc.Delete(key)
+		} else {
+			s.gc.SetWithExpire(key, item, ttl)
+		}
+		return stored
+	case "add":
+		var ok bool
+		if expired {
+			_, found := s.gc.Get(key)
+			ok = !found
+		} else {
+			ok = s.gc.SetWithExpireIfNotExists(key, item, ttl)
+		}
+		if ok {
+			return stored
+		}
+		return notStored
+	case "replace":
+		var ok bool
+		if expired {
+			_, ok = s.gc.Delete(key)
+		} else {
+			ok = s.gc.SetWithExpireIfExists(key, item, ttl)
+		}
+		if ok {
+			return stored
+		}
+		return notStored
+	case "append", "prepend":
+		// The flags and exptime of the command are ignored, as in memcached.
+		var found bool
+		s.gc.Compute(key, func(old Item, ok bool) (Item, gache.Op) {
+			if found = ok; !ok {
+				return old, gache.OpKeep
+			}
+			if cmd == "append" {
+				return Item{Value: slices.Concat(old.Value, item.Value), Flags: old.Flags}, gache.OpReplace
+			}
+			return Item{Value: slices.Concat(item.Value, old.Value), Flags: old.Flags}, gache.OpReplace
+		})
+		if found {
+			return stored
+		}
+		return notStored
+	}
+	// cas
+	var ok bool
+	if expired {
+		ok = s.gc.DeleteIfVersion(key, cas)
+	} else {
+		ok = s.gc.SetWithExpireIfVersion(key, item, ttl, cas)
+	}
+	if ok {
+		s.stats.casHits.Add(1)
+		return stored
+	}
+	if _, _, found := s.gc.GetVersioned(key); found {
+		s.stats.casBadval.Add(1)
+		return exists
+	}
+	s.stats.casMisses.Add(1)
+	return notFound
+}
+
+func (s *Server) delete(w *bufio.Writer, args [][]byte) {
+	args, quiet := noreply(args)
+	// Old clients send a hold time of 0 after the key.
+	if len(args) == 2 && string(args[1]) == "0" {
+		args = args[:1]
+	}
+	if len(args) != 1 || !validKey(args[0]) {
+		w.WriteString(errFormat)
+		return
+	}
+	if _, ok := s.gc.Delete(string(args[0])); ok {
+		s.stats.deleteHits.Add(1)
+		reply(w, quiet, "DELETED\r\n")
+		return
+	}
+	s.stats.deleteMisses.Add(1)
+	reply(w, quiet, notFound)
+}
+
+func (s *Server) incr(w *bufio.Writer, args [][]byte, up bool) {
+	args, quiet := noreply(args)
+	if len(args) != 2 || !validKey(args[0]) {
+		w.WriteString("ERROR\r\n")
+		return
+	}
+	delta, err := strconv.ParseUint(string(args[1]), 10, 64)
+	if err != nil {
+		w.WriteString("CLIENT_ERROR invalid numeric delta argument\r\n")
+		return
+	}
+	var (
+		result uint64
+		msg    string
+	)
+	s.gc.Compute(string(args[0]), func(old Item, ok bool) (Item, gache.Op) {
+		if !ok {
+			msg = notFound
+			return old, gache.OpKeep
+		}
+		n, err := strconv.ParseUint(string(old.Value), 10, 64)
+		if err != nil {
+			msg = "CLIENT_ERROR cannot increment or decrement non-numeric value\r\n"
+			return old, gache.OpKeep
+		}
+		switch {
+		case up:
+			// Incrementing wraps around at 2^64, as in memcached.
+			n += delta
+		case delta > n:
+			// Decrementing below 0 yields 0.
+			n = 0
+		default:
+			n -= delta
+		}
+		msg, result = "", n
+		return Item{Value: strconv.AppendUint(nil, n, 10), Flags: old.Flags}, gache.OpReplace
+	})
+	if msg == "" {
+		msg = strconv.FormatUint(result, 10) + "\r\n"
+	}
+	reply(w, quiet, msg)
+}
+
+func (s *Server) touch(w *bufio.Writer, args [][]byte) {
+	args, quiet := noreply(args)
+	if len(args) != 2 || !validKey(args[0]) {
+		w.WriteString("ERROR\r\n")
+		return
+	}
+	exptime, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		w.WriteString("CLIENT_ERROR invalid exptime argument\r\n")
+		return
+	}
+	s.stats.cmdTouch.Add(1)
+	key := string(args[0])
+	ttl, expired := expiry(exptime)
+	var ok bool
+	switch {
+	case expired:
+		_, ok = s.gc.Delete(key)
+	case ttl == gache.NoTTL:
+		ok = s.persist(key)
+	default:
+		_, ok = s.gc.GetRefreshWithDur(key, ttl)
+	}
+	if ok {
+		reply(w, quiet, "TOUCHED\r\n")
+		return
+	}
+	reply(w, quiet, notFound)
+}
+
+// persist removes the expiration of key and reports whether it exists.
+func (s *Server) persist(key string) bool {
+	for {
+		item, ver, ok := s.gc.GetVersioned(key)
+		if !ok {
+			return false
+		}
+		if s.gc.SetWithExpireIfVersion(key, item, gache.NoTTL, ver) {
+			return true
+		}
+	}
+}
+
+func (s *Server) flushAll(w *bufio.Writer, args [][]byte) {
+	args, quiet := noreply(args)
+	var delay int64
+	if len(args) > 1 {
+		w.WriteString("ERROR\r\n")
+		return
+	}
+	if len(args) == 1 {
+		var err error
+		if delay, err = strconv.ParseInt(string(args[0]), 10, 64); err != nil || delay < 0 {
+			w.WriteString(errFormat)
+			return
+		}
+	}
+	s.stats.cmdFlush.Add(1)
+	s.mu.Lock()
+	if s.flushTimer != nil {
+		s.flushTimer.Stop()
+		s.flushTimer = nil
+	}
+	if delay > 0 {
+		s.flushTimer = time.AfterFunc(time.Duration(delay)*time.Second, s.gc.Clear)
+	}
+	s.mu.Unlock()
+	if delay == 0 {
+		s.gc.Clear()
+	}
+	reply(w, quiet, "OK\r\n")
+}
+
+// writeStats answers "stats" with the general-purpose statistics. Other
+// groups such as "stats items" are answered with an empty list.
+func (s *Server) writeStats(w *bufio.Writer, args [][]byte) {
+	if len(args) == 0 {
+		stat := func(name string, v uint64) {
+			w.WriteString("STAT " + name + " " + strconv.FormatUint(v, 10) + "\r\n")
+		}
+		stat("pid", uint64(os.Getpid()))
+		stat("uptime", uint64(time.Since(s.start).Seconds()))
+		stat("time", uint64(time.Now().Unix()))
+		w.WriteString("STAT version " + version + "\r\n")
+		stat("curr_connections", uint64(s.stats.currConns.Load()))
+		stat("total_connections", s.stats.totalConns.Load())
+		stat("curr_items", uint64(s.gc.Len()))
+		stat("bytes", uint64(s.gc.Size()))
+		stat("cmd_get", s.stats.cmdGet.Load())
+		stat("cmd_set", s.stats.cmdSet.Load())
+		stat("cmd_touch", s.stats.cmdTouch.Load())
+		stat("cmd_flush", s.stats.cmdFlush.Load())
+		stat("get_hits", s.stats.getHits.Load())
+		stat("get_misses", s.stats.getMisses.Load())
+		stat("delete_hits", s.stats.deleteHits.Load())
+		stat("delete_misses", s.stats.deleteMisses.Load())
+		stat("cas_hits", s.stats.casHits.Load())
+		stat("cas_misses", s.stats.casMisses.Load())
+		stat("cas_badval", s.stats.casBadval.Load())
+	}
+	w.WriteString("END\r\n")
+}
@@ -0,0 +1,193 @@
+package memcached
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kpango/gache/v2"
+)
+
+type client struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func newTestServer(t *testing.T) (gache.Gache[Item], *client) {
+	t.Helper()
+	gc := gache.New[Item]()
+	srv := New(gc)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- srv.Serve(l) }()
+	t.Cleanup(func() {
+		srv.Close()
+		if err := <-done; !errors.Is(err, ErrServerClosed) {
+			t.Errorf("expected ErrServerClosed, got %v", err)
+		}
+	})
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	return gc, &client{t: t, conn: conn, r: bufio.NewReader(conn)}
+}
+
+func (c *client) send(s string) {
+	c.t.Helper()
+	if _, err := c.conn.Write([]byte(s)); err != nil {
+		c.t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// line reads one reply line without its terminator.
+func (c *client) line() string {
+	c.t.Helper()
+	s, err := c.r.ReadString('\n')
+	if err != nil {
+		c.t.Fatalf("unexpected error: %v", err)
+	}
+	return strings.TrimSuffix(s, "\r\n")
+}
+
+// do sends a command and reads the reply lines up to and including one that
+// starts with end, or a single line when end is empty.
+func (c *client) do(cmd, end string) string {
+	c.t.Helper()
+	c.send(cmd)
+	var lines []string
+	for {
+		l := c.line()
+		lines = append(lines, l)
+		if end == "" || strings.HasPrefix(l, end) {
+			return strings.Join(lines, "\n")
+		}
+	}
+}
+
+func expect(t *testing.T, got, want string) {
+	t.Helper()
+	if got != want {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+}
+
+// TestServer_Storage verifies set, add, replace, append, prepend and get,
+// including flags, multi-key get and noreply.
+func TestServer_Storage(t *testing.T) {
+	t.Helper()
+	gc, c := newTestServer(t)
+
+	expect(t, c.do("get k\r\n", "END"), "END")
+	expect(t, c.do("set k 42 0 5\r\nhello\r\n", ""), "STORED")
+	expect(t, c.do("get k\r\n", "END"), "VALUE k 42 5\nhello\nEND")
+	if item, ok := gc.Get("k"); !ok || string(item.Value) != "hello" || item.Flags != 42 {
+		t.Errorf("expected the item to be stored in the cache, got %+v", item)
+	}
+
+	expect(t, c.do("add k 0 0 1\r\nx\r\n", ""), "NOT_STORED")
+	expect(t, c.do("add n 0 0 1\r\nx\r\n", ""), "STORED")
+	expect(t, c.do("replace missing 0 0 1\r\nx\r\n", ""), "NOT_STORED")
+	expect(t, c.do("replace n 0 0 1\r\ny\r\n", ""), "STORED")
+	expect(t, c.do("append k 0 0 2\r\n!!\r\n", ""), "STORED")
+	expect(t, c.do("prepend k 0 0 2\r\n<<\r\n", ""), "STORED")
+	expect(t, c.do("append missing 0 0 1\r\nx\r\n", ""), "NOT_STORED")
+	expect(t, c.do("get k n missing\r\n", "END"), "VALUE k 42 9\n<<hello!!\nVALUE n 0 1\ny\nEND")
+
+	c.send("set q 0 0 1 noreply\r\nq\r\n")
+	expect(t, c.do("get q\r\n", "END"), "VALUE q 0 1\nq\nEND")
+
+	expect(t, c.do("set k 0 0 a\r\n", ""), "CLIENT_ERROR bad data chunk")
+}
+
+// TestServer_CAS verifies gets and cas.
+func TestServer_CAS(t *testing.T) {
+	t.Helper()
+	_, c := newTestServer(t)
+
+	c.do("set k 0 0 1\r\na\r\n", "")
+	fields := strings.Fields(strings.SplitN(c.do("gets k\r\n", "END"), "\n", 2)[0])
+	if len(fields) != 5 {
+		t.Fatalf("expected a cas unique in %v", fields)
+	}
+	cas := fields[4]
+	expect(t, c.do("cas k 0 0 1 "+cas+"\r\nb\r\n", ""), "STORED")
+	expect(t, c.do("cas k 0 0 1 "+cas+"\r\nc\r\n", ""), "EXISTS")
+	expect(t, c.do("cas missing 0 0 1 1\r\nc\r\n", ""), "NOT_FOUND")
+	expect(t, c.do("get k\r\n", "END"), "VALUE k 0 1\nb\nEND")
+}
+
+// TestServer_Expiration verifies relative, absolute and negative exptimes
+// and touch.
+func TestServer_Expiration(t *testing.T) {
+	t.Helper()
+	gc, c := newTestServer(t)
+
+	c.do("set rel 0 100 1\r\na\r\n", "")
+	if _, expire, _ := gc.GetWithExpire("rel"); time.Until(time.Unix(0, expire)) > 100*time.Second {
+		t.Errorf("expected a relative expiration of 100s, got %v", time.Until(time.Unix(0, expire)))
+	}
+	abs := time.Now().Add(time.Hour).Unix()
+	c.do("set abs 0 "+strconv.FormatInt(abs, 10)+" 1\r\na\r\n", "")
+	_, expire, _ := gc.GetWithExpire("abs")
+	if d := time.Until(time.Unix(0, expire)); d < 59*time.Minute || d > time.Hour {
+		t.Errorf("expected an absolute expiration in one hour, got %v", d)
+	}
+	past := time.Now().Add(-time.Hour).Unix()
+	expect(t, c.do("set old 0 "+strconv.FormatInt(past, 10)+" 1\r\na\r\n", ""), "STORED")
+	expect(t, c.do("get old\r\n", "END"), "END")
+	expect(t, c.do("set rel 0 -1 1\r\na\r\n", ""), "STORED")
+	expect(t, c.do("get rel\r\n", "END"), "END")
+
+	expect(t, c.do("touch abs 0\r\n", ""), "TOUCHED")
+	if _, expire, _ := gc.GetWithExpire("abs"); expire > 0 {
+		t.Errorf("expected touch with 0 to remove the expiration, got %d", expire)
+	}
+	expect(t, c.do("touch abs 1\r\n", ""), "TOUCHED")
+	expect(t, c.do("touch missing 1\r\n", ""), "NOT_FOUND")
+	time.Sleep(1100 * time.Millisecond)
+	expect(t, c.do("get abs\r\n", "END"), "END")
+}
+
+// TestServer_Commands verifies delete, incr, decr, flush_all, stats and
+// unknown commands.
+func TestServer_Commands(t *testing.T) {
+	t.Helper()
+	gc, c := newTestServer(t)
+
+	c.do("set n 7 0 2\r\n10\r\n", "")
+	expect(t, c.do("incr n 5\r\n", ""), "15")
+	expect(t, c.do("decr n 20\r\n", ""), "0")
+	expect(t, c.do("incr missing 1\r\n", ""), "NOT_FOUND")
+	c.do("set s 0 0 1\r\nx\r\n", "")
+	expect(t, c.do("incr s 1\r\n", ""), "CLIENT_ERROR cannot increment or decrement non-numeric value")
+	c.do("set max 0 0 20\r\n18446744073709551615\r\n", "")
+	expect(t, c.do("incr max 2\r\n", ""), "1")
+	if item, _ := gc.Get("n"); item.Flags != 7 {
+		t.Errorf("expected incr to keep the flags, got %d", item.Flags)
+	}
+
+	expect(t, c.do("delete n\r\n", ""), "DELETED")
+	expect(t, c.do("delete n\r\n", ""), "NOT_FOUND")
+
+	stats := c.do("stats\r\n", "END")
+	for _, want := range []string{"STAT curr_items 2", "STAT delete_hits 1", "STAT curr_connections 1"} {
+		if !strings.Contains(stats, want) {
+			t.Errorf("expected stats to contain %q, got %q", want, stats)
+		}
+	}
+	expect(t, c.do("flush_all\r\n", ""), "OK")
+	expect(t, c.do("get s max\r\n", "END"), "END")
+	expect(t, c.do("bogus\r\n", ""), "ERROR")
+	expect(t, c.do("version\r\n", ""), "VERSION "+version)
+}
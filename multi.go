@@ -0,0 +1,140 @@
+package gache
+
+import (
+	"cmp"
+	"slices"
+	"sync/atomic"
+	"time"
+)
+
+// Entry is a key-value pair with its own expiration duration, as accepted by
+// [Gache.SetMultiWithExpire]. An Expire of [NoTTL] stores the entry without
+// expiration.
+type Entry[V any] struct {
+	Key    string
+	Value  V
+	Expire time.Duration
+}
+
+// shardOrder returns the indices 0..n-1 ordered by the shard ID of the key
+// at each index, together with those shard IDs, so that batch operations
+// visit every shard once.
+func (g *gache[V]) shardOrder(n int, keyAt func(int) string) (order []int, ids []uint64) {
+	order = make([]int, n)
+	ids = make([]uint64, n)
+	for i := range n {
+		order[i] = i
+		ids[i] = getShardID(keyAt(i), g.maxKeyLength)
+	}
+	slices.SortStableFunc(order, func(a, b int) int {
+		return cmp.Compare(ids[a], ids[b])
+	})
+	return order, ids
+}
+
+// GetMulti retrieves the values for several keys at once. It returns the
+// non-expired entries that were found and, in input order, the keys that were
+// missing or expired. Keys are grouped by shard so each shard is visited once,
+// and keys missing from memory are loaded from the [Store] configured with
+// [WithStore] in a single LoadMany call.
+//
+// Example:
+//
+//	gc := gache.New[string]()
+//	gc.Set("a", "alpha")
+//
+//	found, missing := gc.GetMulti("a", "b")
+//	fmt.Println(found["a"], missing) // "alpha" [b]
+func (g *gache[V]) GetMulti(keys ...string) (found map[string]V, missing []string) {
+	found = make(map[string]V, len(keys))
+	order, ids := g.shardOrder(len(keys), func(i int) string { return keys[i] })
+	var misses []int
+	for _, i := range order {
+		shard := g.shards[ids[i]]
+		if v, _, ok := g.lookup(shard, keys[i]); ok {
+			found[keys[i]] = v
+		} else if v, _, ok = g.promote(shard, keys[i]); ok {
+			found[keys[i]] = v
+		} else {
+			misses = append(misses, i)
+		}
+	}
+	if g.backing != nil && len(misses) > 0 {
+		rest := make([]string, len(misses))
+		for j, i := range misses {
+			rest[j] = keys[i]
+		}
+		loaded := g.backing.loadMany(rest)
+		for _, i := range misses {
+			if v, ok := loaded[keys[i]]; ok {
+				if v, _, ok = g.fill(g.shards[ids[i]], keys[i], v); ok {
+					found[keys[i]] = v
+				}
+			}
+		}
+	}
+	for _, key := range keys {
+		if _, ok := found[key]; !ok {
+			missing = append(missing, key)
+		}
+	}
+	return found, missing
+}
+
+// SetMulti stores every key-value pair of m using the cache's default
+// expiration.
+//
+// Example:
+//
+//	gc := gache.New[int]()
+//	gc.SetMulti(map[string]int{"a": 1, "b": 2})
+func (g *gache[V]) SetMulti(m map[string]V) {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	expire := atomic.LoadInt64(&g.expire)
+	order, ids := g.shardOrder(len(keys), func(i int) string { return keys[i] })
+	for _, i := range order {
+		g.storeTo(g.shards[ids[i]], keys[i], m[keys[i]], g.absExpire(expire), 0, 0, nil)
+	}
+}
+
+// SetMultiWithExpire stores every entry with its own expiration duration.
+// When the same key appears more than once, the last entry wins.
+//
+// Example:
+//
+//	gc := gache.New[string]()
+//	gc.SetMultiWithExpire(
+//	    gache.Entry[string]{Key: "a", Value: "alpha", Expire: time.Minute},
+//	    gache.Entry[string]{Key: "b", Value: "beta", Expire: gache.NoTTL},
+//	)
+func (g *gache[V]) SetMultiWithExpire(entries ...Entry[V]) {
+	order, ids := g.shardOrder(len(entries), func(i int) string { return entries[i].Key })
+	for _, i := range order {
+		e := entries[i]
+		g.storeTo(g.shards[ids[i]], e.Key, e.Value, g.absExpire(int64(e.Expire)), 0, 0, nil)
+	}
+}
+
+// DeleteMulti removes several keys at once and returns the values that were
+// stored for the keys that were present.
+//
+// Example:
+//
+//	gc := gache.New[int]()
+//	gc.SetMulti(map[string]int{"a": 1, "b": 2})
+//
+//	deleted := gc.DeleteMulti("a", "c")
+//	fmt.Println(deleted) // map[a:1]
+func (g *gache[V]) DeleteMulti(keys ...string) (deleted map[string]V) {
+	deleted = make(map[string]V, len(keys))
+	order, ids := g.shardOrder(len(keys), func(i int) string { return keys[i] })
+	for _, i := range order {
+		if v, ok := g.remove(g.shards[ids[i]], keys[i]); ok {
+			deleted[keys[i]] = v
+		}
+	}
+	return deleted
+}
@@ -0,0 +1,81 @@
+package gache
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+)
+
+// TestGache_GetMulti verifies that batch reads return found entries and report missing or expired keys in input order.
+func TestGache_GetMulti(t *testing.T) {
+	t.Helper()
+	gc := New[int]()
+	for i := range 100 {
+		gc.Set(fmt.Sprintf("key-%d", i), i)
+	}
+	gc.SetWithExpire("expired", 1, 50*time.Millisecond)
+	time.Sleep(150 * time.Millisecond)
+
+	keys := []string{"absent-1", "expired"}
+	for i := range 100 {
+		keys = append(keys, fmt.Sprintf("key-%d", i))
+	}
+	keys = append(keys, "absent-2")
+
+	found, missing := gc.GetMulti(keys...)
+	if len(found) != 100 {
+		t.Fatalf("expected 100 found entries, got %d", len(found))
+	}
+	for i := range 100 {
+		if v, ok := found[fmt.Sprintf("key-%d", i)]; !ok || v != i {
+			t.Errorf("expected key-%d=%d, got %d (ok: %t)", i, i, v, ok)
+		}
+	}
+	if want := []string{"absent-1", "expired", "absent-2"}; !slices.Equal(missing, want) {
+		t.Errorf("expected missing %v, got %v", want, missing)
+	}
+}
+
+// TestGache_SetMulti verifies that batch writes store every entry with the default or per-entry expiration.
+func TestGache_SetMulti(t *testing.T) {
+	t.Helper()
+	gc := New[string]()
+	gc.SetMulti(map[string]string{"a": "alpha", "b": "beta"})
+	if found, missing := gc.GetMulti("a", "b"); len(found) != 2 || len(missing) != 0 {
+		t.Errorf("expected both keys, got %v missing %v", found, missing)
+	}
+
+	gc.SetMultiWithExpire(
+		Entry[string]{Key: "short", Value: "s", Expire: 50 * time.Millisecond},
+		Entry[string]{Key: "forever", Value: "f", Expire: NoTTL},
+	)
+	if _, exp, ok := gc.GetWithExpire("forever"); !ok || exp > 0 {
+		t.Errorf("expected forever to have no expiration, got %d (ok: %t)", exp, ok)
+	}
+	time.Sleep(150 * time.Millisecond)
+	if _, ok := gc.Get("short"); ok {
+		t.Error("expected short to expire")
+	}
+	if v, ok := gc.Get("forever"); !ok || v != "f" {
+		t.Errorf("expected 'f', got %q (ok: %t)", v, ok)
+	}
+}
+
+// TestGache_DeleteMulti verifies that batch deletes remove the given keys and return the deleted values.
+func TestGache_DeleteMulti(t *testing.T) {
+	t.Helper()
+	gc := New[int]()
+	gc.SetMulti(map[string]int{"a": 1, "b": 2, "c": 3})
+
+	deleted := gc.DeleteMulti("a", "c", "d")
+	if len(deleted) != 2 || deleted["a"] != 1 || deleted["c"] != 3 {
+		t.Errorf("expected map[a:1 c:3], got %v", deleted)
+	}
+	if l := gc.Len(); l != 1 {
+		t.Errorf("expected length 1, got %d", l)
+	}
+	if _, ok := gc.Get("b"); !ok {
+		t.Error("expected b to remain")
+	}
+}
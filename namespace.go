@@ -0,0 +1,761 @@
+package gache
+
+import (
+	"context"
+	"encoding/gob"
+	"errors"
+	"io"
+	"iter"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
+
+	"github.com/kpango/fastime"
+)
+
+type (
+	// NamespaceOption configures a namespace returned by [Gache.Namespace].
+	NamespaceOption[V any] func(*namespace[V])
+
+	// NamespaceStats is a snapshot of the counters of a namespace, as
+	// returned by [Gache.NamespaceStats].
+	NamespaceStats struct {
+		// Len is the number of entries in the namespace, including expired
+		// entries that have not been removed yet.
+		Len int
+		// Quota is the maximum number of entries, or 0 if unlimited.
+		Quota int
+		// Hits and Misses count the lookups that found or missed a live entry.
+		Hits   uint64
+		Misses uint64
+		// Sets counts stored entries and Deletes removed ones.
+		Sets    uint64
+		Deletes uint64
+		// Rejected counts writes of new keys refused because of the quota.
+		Rejected uint64
+	}
+
+	// namespace is a view of the parent cache restricted to the keys starting
+	// with prefix. It implements Gache by translating keys and delegating to
+	// the parent, so all namespaces share the parent's shards and daemon.
+	namespace[V any] struct {
+		g              *gache[V]
+		name           string
+		prefix         string
+		expFunc        func(context.Context, string, V)
+		expFuncEnabled bool
+		expire         int64
+		quota          atomic.Int64
+		// count is the number of values held for the namespace, maintained
+		// by namespaceRegistry from the observer callbacks.
+		count    atomic.Int64
+		hits     atomic.Uint64
+		misses   atomic.Uint64
+		sets     atomic.Uint64
+		deletes  atomic.Uint64
+		rejected atomic.Uint64
+	}
+
+	// namespaceRegistry holds the namespaces of a cache and counts their
+	// entries as an observer.
+	namespaceRegistry[V any] struct {
+		m Map[string, namespace[V]]
+	}
+
+	// nsTx is the Tx of a namespace; it translates keys and tracks the new
+	// keys staged so the quota can be checked before committing.
+	nsTx[V any] struct {
+		ns    *namespace[V]
+		tx    Tx[V]
+		added map[string]struct{}
+	}
+)
+
+var (
+	// ErrQuotaExceeded is returned by [Gache.Txn] on a namespace when
+	// committing the transaction would exceed the namespace's entry quota.
+	ErrQuotaExceeded = errors.New("gache: namespace quota exceeded")
+	// ErrNamespaceName is the value [Gache.Namespace] panics with when the
+	// name contains a NUL byte, which delimits the internal key prefix.
+	ErrNamespaceName = errors.New("gache: namespace name must not contain a NUL byte")
+)
+
+// namespaceSep separates nested namespace names.
+const namespaceSep = "/"
+
+// WithNamespaceExpiration sets the default expiration of the namespace, which
+// otherwise inherits the parent's default expiration when it is created.
+func WithNamespaceExpiration[V any](dur time.Duration) NamespaceOption[V] {
+	return func(ns *namespace[V]) {
+		atomic.StoreInt64(&ns.expire, int64(dur))
+	}
+}
+
+// WithNamespaceQuota limits the namespace to n entries. Writes that would add
+// a new key to a full namespace are dropped and counted as rejected;
+// conditional writes report false. Overwriting existing keys is always
+// allowed. Expired entries count towards the quota until they are removed.
+// The quota is enforced without locking, so concurrent writers may overshoot
+// it slightly. An n <= 0 removes the quota.
+func WithNamespaceQuota[V any](n int) NamespaceOption[V] {
+	return func(ns *namespace[V]) {
+		ns.quota.Store(int64(max(n, 0)))
+	}
+}
+
+// Namespace returns a view of the cache whose keys are isolated from the
+// parent and from other namespaces. The view stores its entries in the
+// parent's shards under an internal prefix and is swept by the parent's
+// expiration daemon, so it is much cheaper than a separate [New] instance.
+// Each namespace has its own default expiration, expired hook, quota and
+// statistics, and its Len, Clear, iteration and serialisation only cover its
+// own entries. Calling Namespace again with the same name returns the same
+// namespace after applying opts.
+//
+// The parent sees namespaced entries under their internal keys, the name and
+// the key joined as "\x00name\x00key": they are counted by its Len, returned
+// by its Keys and Range and serialised by its Write, so that a snapshot of
+// the parent restores every namespace. Namespaces of a namespace are
+// independent namespaces named "parent/child"; they are not cleared with
+// their parent. StartExpired and Stop are no-ops on a namespace. Namespace
+// panics with [ErrNamespaceName] if name contains a NUL byte.
+//
+// Example:
+//
+//	gc := gache.New[[]byte]().StartExpired(ctx, time.Minute)
+//	sessions := gc.Namespace("sessions",
+//	    gache.WithNamespaceExpiration[[]byte](30*time.Minute),
+//	    gache.WithNamespaceQuota[[]byte](100000))
+//	pages := gc.Namespace("pages")
+//
+//	sessions.Set("42", sess) // does not collide with pages.Set("42", page)
+//	stats, _ := gc.NamespaceStats("sessions")
+func (g *gache[V]) Namespace(name string, opts ...NamespaceOption[V]) Gache[V] {
+	if strings.IndexByte(name, 0) >= 0 {
+		panic(ErrNamespaceName)
+	}
+	g.nsOnce.Do(func() { g.addObserver(&g.namespaces) })
+	ns, ok := g.namespaces.m.LoadPointer(name)
+	if !ok {
+		ns, _ = g.namespaces.m.LoadOrStorePointer(name, &namespace[V]{
+			g:      g,
+			name:   name,
+			prefix: "\x00" + name + "\x00",
+			expire: atomic.LoadInt64(&g.expire),
+		})
+	}
+	for _, opt := range opts {
+		opt(ns)
+	}
+	return ns
+}
+
+// NamespaceStats returns the statistics of the namespace called name and
+// reports whether it exists.
+func (g *gache[V]) NamespaceStats(name string) (NamespaceStats, bool) {
+	ns, ok := g.namespaces.m.LoadPointer(name)
+	if !ok {
+		return NamespaceStats{}, false
+	}
+	return ns.stats(), true
+}
+
+// of returns the namespace owning key, or nil for keys outside namespaces.
+func (r *namespaceRegistry[V]) of(key string) *namespace[V] {
+	if len(key) < 2 || key[0] != 0 {
+		return nil
+	}
+	end := strings.IndexByte(key[1:], 0)
+	if end < 0 {
+		return nil
+	}
+	ns, _ := r.m.LoadPointer(key[1 : end+1])
+	return ns
+}
+
+func (r *namespaceRegistry[V]) insert(key string, _ V, _ []string) {
+	if ns := r.of(key); ns != nil {
+		ns.count.Add(1)
+	}
+}
+
+func (r *namespaceRegistry[V]) release(key string, _ V, _ []string) {
+	if ns := r.of(key); ns != nil {
+		ns.count.Add(-1)
+	}
+}
+
+func (ns *namespace[V]) stats() NamespaceStats {
+	return NamespaceStats{
+		Len:      ns.Len(),
+		Quota:    int(ns.quota.Load()),
+		Hits:     ns.hits.Load(),
+		Misses:   ns.misses.Load(),
+		Sets:     ns.sets.Load(),
+		Deletes:  ns.deletes.Load(),
+		Rejected: ns.rejected.Load(),
+	}
+}
+
+// key returns the parent key of the namespace key k.
+func (ns *namespace[V]) key(k string) string {
+	return ns.prefix + k
+}
+
+// strip returns the namespace key of the parent key k and reports whether k
+// belongs to the namespace.
+func (ns *namespace[V]) strip(k string) (string, bool) {
+	if !strings.HasPrefix(k, ns.prefix) {
+		return "", false
+	}
+	return k[len(ns.prefix):], true
+}
+
+func (ns *namespace[V]) stripAll(keys []string) []string {
+	for i, k := range keys {
+		keys[i] = k[len(ns.prefix):]
+	}
+	return keys
+}
+
+func (ns *namespace[V]) ttl() time.Duration {
+	return time.Duration(atomic.LoadInt64(&ns.expire))
+}
+
+// admit reports whether the parent key may be written without exceeding the
+// quota, counting the write as rejected otherwise.
+func (ns *namespace[V]) admit(key string) bool {
+	q := ns.quota.Load()
+	if q <= 0 || ns.count.Load() < q {
+		return true
+	}
+	if _, ok := ns.g.shards[getShardID(key, ns.g.maxKeyLength)].LoadPointer(key); ok {
+		return true
+	}
+	ns.rejected.Add(1)
+	return false
+}
+
+func (ns *namespace[V]) hit(ok bool) {
+	if ok {
+		ns.hits.Add(1)
+	} else {
+		ns.misses.Add(1)
+	}
+}
+
+// tally increments c if ok and returns ok.
+func (ns *namespace[V]) tally(c *atomic.Uint64, ok bool) bool {
+	if ok {
+		c.Add(1)
+	}
+	return ok
+}
+
+// Clear removes all entries of the namespace.
+// Clear drops the entries of the namespace, including those spilled to the
+// disk tier. Like the parent's Clear it leaves the Store alone and fires no
+// hooks; unlike it, it is not replicated nor published on the bus.
+func (ns *namespace[V]) Clear() {
+	g := ns.g
+	for _, shard := range g.shards {
+		for k := range shard.readMap() {
+			if strings.HasPrefix(k, ns.prefix) {
+				g.deleteFrom(shard, k)
+			}
+		}
+	}
+	if g.l2 != nil {
+		for _, k := range g.l2.keys() {
+			if strings.HasPrefix(k, ns.prefix) {
+				g.l2.drop(k)
+			}
+		}
+	}
+}
+
+func (ns *namespace[V]) Delete(key string) (v V, ok bool) {
+	v, ok = ns.g.Delete(ns.key(key))
+	ns.tally(&ns.deletes, ok)
+	return v, ok
+}
+
+// DeleteExpired removes the expired entries of the namespace.
+func (ns *namespace[V]) DeleteExpired(ctx context.Context) (n uint64) {
+	cancelable := ctx.Done() != nil
+	for i, shard := range ns.g.shards {
+		if cancelable && i&63 == 0 && ctx.Err() != nil {
+			return n
+		}
+		now := fastime.UnixNanoNow()
+		for k, e := range shard.readMap() {
+			if !strings.HasPrefix(k, ns.prefix) {
+				continue
+			}
+			v, ok := e.loadPointer()
+			if !ok {
+				continue
+			}
+			if expire := atomic.LoadInt64(&v.expire); expire > 0 && now > expire {
+				ns.g.expiration(k)
+				n++
+			}
+		}
+	}
+	return n
+}
+
+func (ns *namespace[V]) DeleteIf(ctx context.Context, f func(string, V, int64) bool) uint64 {
+	n := ns.g.DeleteIf(ctx, func(k string, v V, exp int64) bool {
+		key, ok := ns.strip(k)
+		return ok && f(key, v, exp)
+	})
+	ns.deletes.Add(n)
+	return n
+}
+
+func (ns *namespace[V]) DeletePrefix(ctx context.Context, prefix string) uint64 {
+	n := ns.g.DeletePrefix(ctx, ns.key(prefix))
+	ns.deletes.Add(n)
+	return n
+}
+
+func (ns *namespace[V]) DisableExpiredHook() Gache[V] {
+	ns.expFuncEnabled = false
+	return ns
+}
+
+func (ns *namespace[V]) EnableExpiredHook() Gache[V] {
+	ns.expFuncEnabled = true
+	return ns
+}
+
+// SetExpiredHook sets the hook called, with namespace keys, when entries of
+// the namespace expire. The parent's hook is not called for them.
+func (ns *namespace[V]) SetExpiredHook(f func(context.Context, string, V)) Gache[V] {
+	ns.expFunc = f
+	return ns
+}
+
+// StartExpired is a no-op; namespaces are swept by the parent's daemon.
+func (ns *namespace[V]) StartExpired(context.Context, time.Duration) Gache[V] {
+	return ns
+}
+
+// Stop is a no-op; the daemon belongs to the parent.
+func (ns *namespace[V]) Stop() {}
+
+// Close is a no-op; the resources belong to the parent.
+func (ns *namespace[V]) Close() error {
+	return nil
+}
+
+func (ns *namespace[V]) Range(ctx context.Context, f func(string, V, int64) bool) Gache[V] {
+	ns.g.Range(ctx, func(k string, v V, exp int64) bool {
+		if key, ok := ns.strip(k); ok {
+			return f(key, v, exp)
+		}
+		return true
+	})
+	return ns
+}
+
+func (ns *namespace[V]) Get(key string) (v V, ok bool) {
+	v, ok = ns.g.Get(ns.key(key))
+	ns.hit(ok)
+	return v, ok
+}
+
+func (ns *namespace[V]) GetWithExpire(key string) (v V, expire int64, ok bool) {
+	v, expire, ok = ns.g.GetWithExpire(ns.key(key))
+	ns.hit(ok)
+	return v, expire, ok
+}
+
+// Read stores the entries written by [Gache.Write] in the namespace with its
+// default expiration.
+func (ns *namespace[V]) Read(r io.Reader) error {
+	var m map[string]V
+	gob.Register(map[string]V{})
+	if err := gob.NewDecoder(r).Decode(&m); err != nil {
+		return err
+	}
+	for k, v := range m {
+		ns.Set(k, v)
+	}
+	return nil
+}
+
+func (ns *namespace[V]) Set(key string, val V) {
+	ns.SetWithExpire(key, val, ns.ttl())
+}
+
+func (ns *namespace[V]) SetDefaultExpire(ex time.Duration) Gache[V] {
+	atomic.StoreInt64(&ns.expire, int64(ex))
+	return ns
+}
+
+func (ns *namespace[V]) SetWithExpire(key string, val V, expire time.Duration) {
+	if k := ns.key(key); ns.admit(k) {
+		ns.g.SetWithExpire(k, val, expire)
+		ns.sets.Add(1)
+	}
+}
+
+// Len returns the number of entries in the namespace, including expired
+// entries that have not been removed yet.
+func (ns *namespace[V]) Len() int {
+	return int(max(ns.count.Load(), 0))
+}
+
+// Size returns the approximate in-memory size of the namespace's entries.
+func (ns *namespace[V]) Size() (size uintptr) {
+	size += unsafe.Sizeof(*ns)
+	for k := range ns.KeysSeq(context.Background()) {
+		size += uintptr(len(ns.prefix)+len(k)) + unsafe.Sizeof(value[V]{})
+	}
+	return size
+}
+
+func (ns *namespace[V]) ToMap(ctx context.Context) *sync.Map {
+	m := new(sync.Map)
+	for k, v := range ns.All(ctx) {
+		m.Store(k, v)
+	}
+	return m
+}
+
+func (ns *namespace[V]) ToRawMap(ctx context.Context) map[string]V {
+	m := make(map[string]V, ns.Len())
+	for k, v := range ns.All(ctx) {
+		m[k] = v
+	}
+	return m
+}
+
+// Write serialises the entries of the namespace, with namespace keys, in the
+// format of [Gache.Write].
+func (ns *namespace[V]) Write(ctx context.Context, w io.Writer) error {
+	m := ns.ToRawMap(ctx)
+	gob.Register(map[string]V{})
+	return gob.NewEncoder(w).Encode(&m)
+}
+
+func (ns *namespace[V]) ExtendExpire(key string, addExp time.Duration) {
+	ns.g.ExtendExpire(ns.key(key), addExp)
+}
+
+func (ns *namespace[V]) GetRefresh(key string) (V, bool) {
+	return ns.GetRefreshWithDur(key, ns.ttl())
+}
+
+func (ns *namespace[V]) GetRefreshWithDur(key string, d time.Duration) (v V, ok bool) {
+	v, ok = ns.g.GetRefreshWithDur(ns.key(key), d)
+	ns.hit(ok)
+	return v, ok
+}
+
+func (ns *namespace[V]) GetWithIgnoredExpire(key string) (v V, ok bool) {
+	v, ok = ns.g.GetWithIgnoredExpire(ns.key(key))
+	ns.hit(ok)
+	return v, ok
+}
+
+func (ns *namespace[V]) Keys(ctx context.Context) []string {
+	keys := make([]string, 0, ns.Len())
+	for k := range ns.KeysSeq(ctx) {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+func (ns *namespace[V]) Values(ctx context.Context) []V {
+	values := make([]V, 0, ns.Len())
+	for v := range ns.ValuesSeq(ctx) {
+		values = append(values, v)
+	}
+	return values
+}
+
+func (ns *namespace[V]) Pop(key string) (v V, ok bool) {
+	v, ok = ns.g.Pop(ns.key(key))
+	ns.tally(&ns.deletes, ok)
+	return v, ok
+}
+
+func (ns *namespace[V]) SetIfNotExists(key string, val V) bool {
+	return ns.SetWithExpireIfNotExists(key, val, ns.ttl())
+}
+
+func (ns *namespace[V]) SetWithExpireIfNotExists(key string, val V, d time.Duration) bool {
+	k := ns.key(key)
+	return ns.admit(k) && ns.tally(&ns.sets, ns.g.SetWithExpireIfNotExists(k, val, d))
+}
+
+func (ns *namespace[V]) SetIfExists(key string, val V) bool {
+	return ns.SetWithExpireIfExists(key, val, ns.ttl())
+}
+
+func (ns *namespace[V]) SetWithExpireIfExists(key string, val V, d time.Duration) bool {
+	return ns.tally(&ns.sets, ns.g.SetWithExpireIfExists(ns.key(key), val, d))
+}
+
+// GetAndSet returns the zero value and false without storing val when the
+// namespace is full and key does not exist.
+func (ns *namespace[V]) GetAndSet(key string, val V) (old V, loaded bool) {
+	k := ns.key(key)
+	if !ns.admit(k) {
+		return old, false
+	}
+	ns.sets.Add(1)
+	return ns.g.getAndSet(k, val, int64(ns.ttl()))
+}
+
+func (ns *namespace[V]) CompareAndDelete(key string, expected V, eq func(V, V) bool) bool {
+	return ns.tally(&ns.deletes, ns.g.CompareAndDelete(ns.key(key), expected, eq))
+}
+
+func (ns *namespace[V]) SetWithDeadline(key string, val V, deadline time.Time) {
+	if k := ns.key(key); ns.admit(k) {
+		ns.g.SetWithDeadline(k, val, deadline)
+		ns.sets.Add(1)
+	}
+}
+
+func (ns *namespace[V]) SetWithSlidingExpire(key string, val V, ttl, maxLifetime time.Duration) {
+	if k := ns.key(key); ns.admit(k) {
+		ns.g.SetWithSlidingExpire(k, val, ttl, maxLifetime)
+		ns.sets.Add(1)
+	}
+}
+
+func (ns *namespace[V]) Compute(key string, f func(V, bool) (V, Op)) (V, bool) {
+	return ns.ComputeWithExpire(key, f, ns.ttl())
+}
+
+// ComputeWithExpire keeps the entry absent instead of creating it when the
+// namespace is full.
+func (ns *namespace[V]) ComputeWithExpire(key string, f func(V, bool) (V, Op), d time.Duration) (V, bool) {
+	k := ns.key(key)
+	return ns.g.ComputeWithExpire(k, func(old V, exists bool) (V, Op) {
+		v, op := f(old, exists)
+		if op == OpReplace && !exists && !ns.admit(k) {
+			return old, OpKeep
+		}
+		return v, op
+	}, d)
+}
+
+func (ns *namespace[V]) ComputeIfPresent(key string, f func(V) (V, Op)) (V, bool) {
+	return ns.Compute(key, func(old V, exists bool) (V, Op) {
+		if !exists {
+			return old, OpKeep
+		}
+		return f(old)
+	})
+}
+
+func (ns *namespace[V]) ComputeIfAbsent(key string, f func() (V, Op)) (V, bool) {
+	return ns.Compute(key, func(old V, exists bool) (V, Op) {
+		if exists {
+			return old, OpKeep
+		}
+		return f()
+	})
+}
+
+func (ns *namespace[V]) GetVersioned(key string) (v V, version uint64, ok bool) {
+	v, version, ok = ns.g.GetVersioned(ns.key(key))
+	ns.hit(ok)
+	return v, version, ok
+}
+
+func (ns *namespace[V]) SetIfVersion(key string, val V, version uint64) bool {
+	return ns.SetWithExpireIfVersion(key, val, ns.ttl(), version)
+}
+
+func (ns *namespace[V]) SetWithExpireIfVersion(key string, val V, d time.Duration, version uint64) bool {
+	return ns.tally(&ns.sets, ns.g.SetWithExpireIfVersion(ns.key(key), val, d, version))
+}
+
+func (ns *namespace[V]) DeleteIfVersion(key string, version uint64) bool {
+	return ns.tally(&ns.deletes, ns.g.DeleteIfVersion(ns.key(key), version))
+}
+
+func (ns *namespace[V]) GetMulti(keys ...string) (map[string]V, []string) {
+	pkeys := make([]string, len(keys))
+	for i, k := range keys {
+		pkeys[i] = ns.key(k)
+	}
+	found, missing := ns.g.GetMulti(pkeys...)
+	res := make(map[string]V, len(found))
+	for k, v := range found {
+		res[k[len(ns.prefix):]] = v
+	}
+	ns.hits.Add(uint64(len(found)))
+	ns.misses.Add(uint64(len(missing)))
+	return res, ns.stripAll(missing)
+}
+
+func (ns *namespace[V]) SetMulti(m map[string]V) {
+	entries := make([]Entry[V], 0, len(m))
+	for k, v := range m {
+		entries = append(entries, Entry[V]{Key: k, Value: v, Expire: ns.ttl()})
+	}
+	ns.SetMultiWithExpire(entries...)
+}
+
+func (ns *namespace[V]) SetMultiWithExpire(entries ...Entry[V]) {
+	admitted := make([]Entry[V], 0, len(entries))
+	for _, e := range entries {
+		if e.Key = ns.key(e.Key); ns.admit(e.Key) {
+			admitted = append(admitted, e)
+		}
+	}
+	ns.g.SetMultiWithExpire(admitted...)
+	ns.sets.Add(uint64(len(admitted)))
+}
+
+func (ns *namespace[V]) DeleteMulti(keys ...string) map[string]V {
+	pkeys := make([]string, len(keys))
+	for i, k := range keys {
+		pkeys[i] = ns.key(k)
+	}
+	deleted := ns.g.DeleteMulti(pkeys...)
+	res := make(map[string]V, len(deleted))
+	for k, v := range deleted {
+		res[k[len(ns.prefix):]] = v
+	}
+	ns.deletes.Add(uint64(len(deleted)))
+	return res
+}
+
+// Txn returns [ErrQuotaExceeded] without applying anything if the new keys
+// staged by f do not fit in the namespace's quota.
+func (ns *namespace[V]) Txn(f func(Tx[V]) error) error {
+	return ns.g.Txn(func(tx Tx[V]) error {
+		t := &nsTx[V]{ns: ns, tx: tx, added: make(map[string]struct{})}
+		if err := f(t); err != nil {
+			return err
+		}
+		if q := ns.quota.Load(); q > 0 && len(t.added) > 0 && ns.count.Load()+int64(len(t.added)) > q {
+			ns.rejected.Add(uint64(len(t.added)))
+			return ErrQuotaExceeded
+		}
+		return nil
+	})
+}
+
+func (ns *namespace[V]) SetWithTags(key string, val V, d time.Duration, tags ...string) {
+	k := ns.key(key)
+	if !ns.admit(k) {
+		return
+	}
+	ptags := make([]string, len(tags))
+	for i, tag := range tags {
+		ptags[i] = ns.key(tag)
+	}
+	ns.g.SetWithTags(k, val, d, ptags...)
+	ns.sets.Add(1)
+}
+
+func (ns *namespace[V]) InvalidateTag(tag string) uint64 {
+	n := ns.g.InvalidateTag(ns.key(tag))
+	ns.deletes.Add(n)
+	return n
+}
+
+func (ns *namespace[V]) ScanPrefix(ctx context.Context, prefix string) []string {
+	return ns.stripAll(ns.g.ScanPrefix(ctx, ns.key(prefix)))
+}
+
+func (ns *namespace[V]) ScanRange(ctx context.Context, from, to string, limit int) []string {
+	if to == "" {
+		// Keys of the namespace sort before its prefix with the trailing
+		// NUL byte incremented.
+		to = ns.prefix[:len(ns.prefix)-1] + "\x01"
+	} else {
+		to = ns.key(to)
+	}
+	return ns.stripAll(ns.g.ScanRange(ctx, ns.key(from), to, limit))
+}
+
+func (ns *namespace[V]) Scan(cursor uint64, count int, match string) ([]string, uint64) {
+	if match == "" {
+		match = "*"
+	}
+	keys, next := ns.g.Scan(cursor, count, globQuote(ns.prefix)+match)
+	return ns.stripAll(keys), next
+}
+
+func (ns *namespace[V]) All(ctx context.Context) iter.Seq2[string, V] {
+	return func(yield func(string, V) bool) {
+		for k, v := range ns.g.All(ctx) {
+			if key, ok := ns.strip(k); ok && !yield(key, v) {
+				return
+			}
+		}
+	}
+}
+
+func (ns *namespace[V]) KeysSeq(ctx context.Context) iter.Seq[string] {
+	return func(yield func(string) bool) {
+		for k := range ns.All(ctx) {
+			if !yield(k) {
+				return
+			}
+		}
+	}
+}
+
+func (ns *namespace[V]) ValuesSeq(ctx context.Context) iter.Seq[V] {
+	return func(yield func(V) bool) {
+		for _, v := range ns.All(ctx) {
+			if !yield(v) {
+				return
+			}
+		}
+	}
+}
+
+// AddIndex adds an index that only covers the entries of the namespace.
+func (ns *namespace[V]) AddIndex(name string, f func(V) []string) error {
+	return ns.g.addIndex(ns.key(name), ns.prefix, f)
+}
+
+func (ns *namespace[V]) GetBy(name, indexKey string) []V {
+	return ns.g.GetBy(ns.key(name), indexKey)
+}
+
+// Namespace returns the namespace called name + "/" + child of the parent.
+func (ns *namespace[V]) Namespace(child string, opts ...NamespaceOption[V]) Gache[V] {
+	return ns.g.Namespace(ns.name+namespaceSep+child, opts...)
+}
+
+func (ns *namespace[V]) NamespaceStats(child string) (NamespaceStats, bool) {
+	return ns.g.NamespaceStats(ns.name + namespaceSep + child)
+}
+
+func (t *nsTx[V]) Get(key string) (V, bool) {
+	return t.tx.Get(t.ns.key(key))
+}
+
+func (t *nsTx[V]) Set(key string, val V) {
+	t.SetWithExpire(key, val, t.ns.ttl())
+}
+
+func (t *nsTx[V]) SetWithExpire(key string, val V, d time.Duration) {
+	k := t.ns.key(key)
+	if _, ok := t.ns.g.shards[getShardID(k, t.ns.g.maxKeyLength)].LoadPointer(k); !ok {
+		t.added[k] = struct{}{}
+	}
+	t.tx.SetWithExpire(k, val, d)
+}
+
+func (t *nsTx[V]) Delete(key string) {
+	k := t.ns.key(key)
+	delete(t.added, k)
+	t.tx.Delete(k)
+}
@@ -0,0 +1,326 @@
+package gache
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestGache_NamespaceIsolation verifies that namespaces do not see each other's keys or the parent's.
+func TestGache_NamespaceIsolation(t *testing.T) {
+	t.Helper()
+	gc := New[string]()
+	users := gc.Namespace("users")
+	pages := gc.Namespace("pages")
+
+	gc.Set("42", "root")
+	users.Set("42", "alice")
+	pages.Set("42", "home")
+
+	for _, tc := range []struct {
+		c    Gache[string]
+		want string
+	}{{gc, "root"}, {users, "alice"}, {pages, "home"}} {
+		if v, ok := tc.c.Get("42"); !ok || v != tc.want {
+			t.Errorf("expected %q, got %q (ok: %t)", tc.want, v, ok)
+		}
+	}
+	if gc.Namespace("users") != users {
+		t.Error("expected the same namespace for the same name")
+	}
+	if keys := users.Keys(context.Background()); !slices.Equal(keys, []string{"42"}) {
+		t.Errorf("expected [42], got %v", keys)
+	}
+	if l := users.Len(); l != 1 {
+		t.Errorf("expected namespace length 1, got %d", l)
+	}
+	if l := gc.Len(); l != 3 {
+		t.Errorf("expected parent length 3, got %d", l)
+	}
+
+	users.Clear()
+	if l := users.Len(); l != 0 {
+		t.Errorf("expected empty namespace after Clear, got %d", l)
+	}
+	if _, ok := pages.Get("42"); !ok {
+		t.Error("expected Clear to leave other namespaces alone")
+	}
+	if _, ok := gc.Get("42"); !ok {
+		t.Error("expected Clear to leave the parent alone")
+	}
+
+	gc.Clear()
+	if l := pages.Len(); l != 0 {
+		t.Errorf("expected parent Clear to empty namespaces, got %d", l)
+	}
+}
+
+// TestGache_NamespaceExpiration verifies the per-namespace default TTL and expired hook.
+func TestGache_NamespaceExpiration(t *testing.T) {
+	t.Helper()
+	var (
+		mu      sync.Mutex
+		expired []string
+	)
+	gc := New[string]().SetDefaultExpire(time.Hour)
+	ns := gc.Namespace("short", WithNamespaceExpiration[string](50*time.Millisecond)).
+		SetExpiredHook(func(_ context.Context, key string, _ string) {
+			mu.Lock()
+			expired = append(expired, key)
+			mu.Unlock()
+		}).
+		EnableExpiredHook()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	gc.StartExpired(ctx, 10*time.Millisecond)
+
+	ns.Set("k", "v")
+	gc.Set("k", "v")
+	time.Sleep(150 * time.Millisecond)
+
+	if _, ok := ns.Get("k"); ok {
+		t.Error("expected namespaced entry to expire with the namespace TTL")
+	}
+	if _, ok := gc.Get("k"); !ok {
+		t.Error("expected parent entry to keep the parent TTL")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if !slices.Equal(expired, []string{"k"}) {
+		t.Errorf("expected the namespace hook to see [k], got %v", expired)
+	}
+}
+
+// TestGache_NamespaceQuota verifies that writes of new keys beyond the quota are rejected.
+func TestGache_NamespaceQuota(t *testing.T) {
+	t.Helper()
+	gc := New[int]()
+	ns := gc.Namespace("limited", WithNamespaceQuota[int](2))
+
+	ns.Set("a", 1)
+	ns.Set("b", 2)
+	ns.Set("c", 3)
+	if _, ok := ns.Get("c"); ok {
+		t.Error("expected write beyond the quota to be dropped")
+	}
+	ns.Set("a", 10)
+	if v, _ := ns.Get("a"); v != 10 {
+		t.Errorf("expected overwrite within the quota, got %d", v)
+	}
+	if ns.SetIfNotExists("d", 4) {
+		t.Error("expected SetIfNotExists beyond the quota to fail")
+	}
+	if _, ok := ns.ComputeIfAbsent("e", func() (int, Op) { return 5, OpReplace }); ok {
+		t.Error("expected Compute beyond the quota to leave the key absent")
+	}
+	err := ns.Txn(func(tx Tx[int]) error {
+		tx.Set("f", 6)
+		return nil
+	})
+	if !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("expected ErrQuotaExceeded, got %v", err)
+	}
+
+	ns.Delete("b")
+	ns.Set("c", 3)
+	if _, ok := ns.Get("c"); !ok {
+		t.Error("expected a write to succeed once space is freed")
+	}
+
+	stats, ok := gc.NamespaceStats("limited")
+	if !ok {
+		t.Fatal("expected stats for the namespace")
+	}
+	if stats.Len != 2 || stats.Quota != 2 || stats.Rejected != 4 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+	if _, ok := gc.NamespaceStats("unknown"); ok {
+		t.Error("expected no stats for an unknown namespace")
+	}
+}
+
+// TestGache_NamespaceStats verifies the hit, miss, set and delete counters.
+func TestGache_NamespaceStats(t *testing.T) {
+	t.Helper()
+	gc := New[int]()
+	ns := gc.Namespace("stats")
+	ns.Set("a", 1)
+	ns.SetMulti(map[string]int{"b": 2, "c": 3})
+	ns.Get("a")
+	ns.Get("missing")
+	ns.GetMulti("b", "missing")
+	ns.Delete("c")
+
+	stats, _ := gc.NamespaceStats("stats")
+	want := NamespaceStats{Len: 2, Hits: 2, Misses: 2, Sets: 3, Deletes: 1}
+	if stats != want {
+		t.Errorf("expected %+v, got %+v", want, stats)
+	}
+}
+
+// TestGache_NamespaceScan verifies that scans and iteration return namespace keys only.
+func TestGache_NamespaceScan(t *testing.T) {
+	t.Helper()
+	gc := New[int](WithOrderedKeys[int]())
+	ns := gc.Namespace("n")
+	gc.Set("user:0", 0)
+	for _, k := range []string{"user:1", "user:2", "item:1"} {
+		ns.Set(k, 1)
+	}
+	gc.Namespace("n2").Set("user:9", 9)
+	ctx := context.Background()
+
+	if keys := ns.ScanPrefix(ctx, "user:"); !slices.Equal(keys, []string{"user:1", "user:2"}) {
+		t.Errorf("unexpected ScanPrefix result %v", keys)
+	}
+	if keys := ns.ScanRange(ctx, "", "", 0); !slices.Equal(keys, []string{"item:1", "user:1", "user:2"}) {
+		t.Errorf("unexpected ScanRange result %v", keys)
+	}
+	var all []string
+	for cursor := uint64(0); ; {
+		var keys []string
+		keys, cursor = ns.Scan(cursor, 100, "user:*")
+		all = append(all, keys...)
+		if cursor == 0 {
+			break
+		}
+	}
+	slices.Sort(all)
+	if !slices.Equal(all, []string{"user:1", "user:2"}) {
+		t.Errorf("unexpected Scan result %v", all)
+	}
+	if m := ns.ToRawMap(ctx); len(m) != 3 {
+		t.Errorf("expected 3 entries, got %v", m)
+	}
+}
+
+// TestGache_NamespaceWriteRead verifies that snapshots of a namespace use namespace keys.
+func TestGache_NamespaceWriteRead(t *testing.T) {
+	t.Helper()
+	gc := New[string]()
+	src := gc.Namespace("src")
+	src.Set("a", "1")
+	src.Set("b", "2")
+	gc.Set("root", "x")
+
+	var buf bytes.Buffer
+	if err := src.Write(context.Background(), &buf); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	dst := New[string]().Namespace("dst")
+	if err := dst.Read(&buf); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if m := dst.ToRawMap(context.Background()); len(m) != 2 || m["a"] != "1" || m["b"] != "2" {
+		t.Errorf("unexpected restored entries %v", m)
+	}
+}
+
+// TestGache_NamespaceParentView verifies that the parent lists, counts and
+// serialises namespaced entries under their internal keys and that names
+// containing a NUL byte are rejected.
+func TestGache_NamespaceParentView(t *testing.T) {
+	t.Helper()
+	ctx := context.Background()
+	gc := New[string]()
+	gc.Namespace("users").Set("42", "alice")
+	gc.Set("root", "x")
+
+	want := []string{"\x00users\x0042", "root"}
+	keys := gc.Keys(ctx)
+	slices.Sort(keys)
+	if !slices.Equal(keys, want) {
+		t.Errorf("expected parent keys %q, got %q", want, keys)
+	}
+	var ranged []string
+	gc.Range(ctx, func(k string, _ string, _ int64) bool {
+		ranged = append(ranged, k)
+		return true
+	})
+	slices.Sort(ranged)
+	if !slices.Equal(ranged, want) {
+		t.Errorf("expected Range to visit %q, got %q", want, ranged)
+	}
+	if l := gc.Len(); l != 2 {
+		t.Errorf("expected parent length 2, got %d", l)
+	}
+
+	var buf bytes.Buffer
+	if err := gc.Write(ctx, &buf); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	dst := New[string]()
+	if err := dst.Read(&buf); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if v, ok := dst.Namespace("users").Get("42"); !ok || v != "alice" {
+		t.Errorf("expected the parent snapshot to restore the namespace, got %q (ok: %t)", v, ok)
+	}
+
+	defer func() {
+		if r := recover(); r != ErrNamespaceName {
+			t.Errorf("expected a panic with ErrNamespaceName, got %v", r)
+		}
+	}()
+	gc.Namespace("a\x00b")
+}
+
+// TestGache_NamespaceClearStore verifies that clearing a namespace drops its
+// cached entries only, leaving the Store and the removal hook alone.
+func TestGache_NamespaceClearStore(t *testing.T) {
+	t.Helper()
+	s := NewMemoryStore[string]()
+	var hooked atomic.Int64
+	gc := New(WithStore[string](s), WithRemovalHookFunc(func(context.Context, string, string) {
+		hooked.Add(1)
+	}))
+	defer gc.Close()
+	users := gc.Namespace("users")
+	users.Set("1", "alice")
+	users.Set("2", "bob")
+	gc.Set("root", "x")
+
+	users.Clear()
+	if l := users.Len(); l != 0 {
+		t.Errorf("expected an empty namespace, got %d entries", l)
+	}
+	if _, ok := gc.(*gache[string]).shards[getShardID("root", gc.(*gache[string]).maxKeyLength)].LoadPointer("root"); !ok {
+		t.Error("expected Clear to leave the parent alone")
+	}
+	if l := s.Len(); l != 3 {
+		t.Errorf("expected the store to keep 3 entries, got %d", l)
+	}
+	if n := hooked.Load(); n != 0 {
+		t.Errorf("expected no removal hook calls, got %d", n)
+	}
+}
+
+// TestGache_NamespaceIndexAndTags verifies that indexes and tags are scoped to the namespace.
+func TestGache_NamespaceIndexAndTags(t *testing.T) {
+	t.Helper()
+	gc := New[string]()
+	a := gc.Namespace("a")
+	b := gc.Namespace("b")
+	if err := a.AddIndex("value", func(v string) []string { return []string{v} }); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	a.Set("k", "x")
+	b.Set("k", "x")
+	if got := a.GetBy("value", "x"); len(got) != 1 {
+		t.Errorf("expected one indexed value, got %v", got)
+	}
+
+	a.SetWithTags("t1", "v", time.Minute, "tag")
+	b.SetWithTags("t1", "v", time.Minute, "tag")
+	if n := a.InvalidateTag("tag"); n != 1 {
+		t.Errorf("expected one invalidated entry, got %d", n)
+	}
+	if _, ok := b.Get("t1"); !ok {
+		t.Error("expected tags of other namespaces to be untouched")
+	}
+}
@@ -0,0 +1,61 @@
+package gache
+
+import "slices"
+
+// observer is notified about every value that enters or leaves the cache.
+// insert is called when a value is initialised for key and release when that
+// value is returned to the pool, so each value produces exactly one balanced
+// insert/release pair even when writers race. A value is released only to the
+// observers it was inserted into, so an observer registered later never sees
+// the release of a value it has not been told about. Derived indexes can
+// therefore keep reference counts per key without coordinating with the
+// shards. [Gache.Clear] releases every value it drops rather than resetting
+// the observers, so that a write racing with it stays balanced too.
+type observer[V any] interface {
+	insert(key string, val V, tags []string)
+	release(key string, val V, tags []string)
+}
+
+// addObserver registers o; values already in the cache are not replayed, but
+// can be passed to o with adopt.
+func (g *gache[V]) addObserver(o observer[V]) {
+	for {
+		old := g.observers.Load()
+		var obs []observer[V]
+		if old != nil {
+			obs = make([]observer[V], 0, len(*old)+1)
+			obs = append(obs, *old...)
+		}
+		obs = append(obs, o)
+		if g.observers.CompareAndSwap(old, &obs) {
+			return
+		}
+	}
+}
+
+func notifyInsert[V any](obs *[]observer[V], key string, val V, tags []string) {
+	if obs != nil {
+		for _, o := range *obs {
+			o.insert(key, val, tags)
+		}
+	}
+}
+
+// adopt inserts v, the value stored for key, into o unless it has been
+// already, and makes its release notify o. It is safe to call concurrently
+// with writers and with adopt for the same value, which inserts it once.
+func adopt[V any](o observer[V], key string, v *value[V]) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	old := v.observers()
+	if v.key != key || (old != nil && slices.Contains(*old, o)) {
+		return
+	}
+	var obs []observer[V]
+	if old != nil {
+		obs = append(obs, *old...)
+	}
+	obs = append(obs, o)
+	v.setExtra(v.sliding(), v.maxExpire(), v.tags(), &obs)
+	o.insert(key, v.val, v.tags())
+}
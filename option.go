@@ -2,11 +2,21 @@ package gache
 
 import (
 	"context"
+	"errors"
 	"time"
 )
 
 type Option[V any] func(g *gache[V]) error
 
+// ErrInvalidDefaultExpiration is returned by [WithDefaultExpiration] and
+// [WithDefaultExpirationString] for an expiration that is neither positive
+// nor [NoTTL].
+var ErrInvalidDefaultExpiration = errors.New("gache: default expiration must be positive or NoTTL")
+
+// WithDefaultExpirationString sets the default expiration from a duration
+// string such as "5m", as parsed by [time.ParseDuration]. An empty string
+// keeps the default; an invalid or non-positive one is reported by
+// [NewWithError].
 func WithDefaultExpirationString[V any](t string) Option[V] {
 	return func(g *gache[V]) error {
 		if len(t) != 0 {
@@ -14,17 +24,24 @@ func WithDefaultExpirationString[V any](t string) Option[V] {
 			if err != nil {
 				return err
 			}
+			if dur <= 0 {
+				return ErrInvalidDefaultExpiration
+			}
 			return WithDefaultExpiration[V](dur)(g)
 		}
 		return nil
 	}
 }
 
+// WithDefaultExpiration sets the expiration of entries written without one,
+// such as by Set. [NoTTL] disables expiration for the entire cache; any
+// other dur <= 0 is reported by [NewWithError] and keeps the default.
 func WithDefaultExpiration[V any](dur time.Duration) Option[V] {
 	return func(g *gache[V]) error {
-		if dur > 0 {
-			g.expire = dur.Nanoseconds()
+		if dur <= 0 && dur != NoTTL {
+			return ErrInvalidDefaultExpiration
 		}
+		g.expire = dur.Nanoseconds()
 		return nil
 	}
 }
@@ -39,6 +56,31 @@ func WithExpiredHookFunc[V any](f func(ctx context.Context, key string, v V)) Op
 	}
 }
 
+// WithRemovalHookFunc registers f to be called for every entry removed on
+// request: by Delete, DeleteMulti, Pop, CompareAndDelete, DeleteIfVersion,
+// InvalidateTag, DeleteIf, DeletePrefix, a Compute returning [OpDelete] or a
+// committed [Tx] deletion, including entries spilled to the disk tier. f gets
+// the context passed to DeleteIf or DeletePrefix, or context.Background for
+// the others, the key and the removed value. Overwrites, expirations,
+// evictions and Clear do not call it. f is called synchronously once the
+// entry is gone, from the workers that scan the shards in DeleteIf and
+// DeletePrefix, so it must be safe for concurrent use. Keys of namespaces are
+// passed in their internal form, as the parent sees them.
+//
+// Example:
+//
+//	gc := gache.New[Session](
+//	    gache.WithRemovalHookFunc[Session](func(ctx context.Context, key string, s Session) {
+//	        s.Close()
+//	    }),
+//	)
+func WithRemovalHookFunc[V any](f func(ctx context.Context, key string, v V)) Option[V] {
+	return func(g *gache[V]) error {
+		g.removeFunc = f
+		return nil
+	}
+}
+
 // WithMaxKeyLength sets the maximum number of bytes used from each key when
 // computing the shard ID. One-byte keys use a fast, non-hashing path; keys of
 // length 2 through 32 bytes use maphash for hashing; longer keys use xxh3. A
@@ -55,10 +97,55 @@ func WithMaxKeyLength[V any](kl uint64) Option[V] {
 // DeleteExpired, ToMap, Keys, Values and ToRawMap. A value <= 0 disables
 // this limit and lets gache choose a default based on runtime.GOMAXPROCS(0).
 // If not set, the default number of workers is derived from
-// runtime.GOMAXPROCS(0) at construction time.
+// runtime.GOMAXPROCS(0) at construction time. [NewWithError] rejects a
+// negative value.
 func WithMaxWorkers[V any](workers int) Option[V] {
 	return func(g *gache[V]) error {
 		g.maxWorkers = workers
 		return nil
 	}
 }
+
+// ErrInvalidTTLJitter is returned by [WithTTLJitter] when the fraction is
+// outside the range [0, 1].
+var ErrInvalidTTLJitter = errors.New("gache: ttl jitter fraction must be within [0, 1]")
+
+// WithTTLJitter randomises every computed expiration to avoid synchronised
+// mass expiry when many keys are written with the same TTL (for example by
+// [Gache.Read]). Each TTL applied by Set, SetWithExpire, SetIfNotExists,
+// SetWithExpireIfNotExists, GetRefresh and GetRefreshWithDur is shortened by a
+// random amount of up to fraction*TTL, so an entry never outlives the
+// requested TTL. A fraction of 0 disables jitter.
+func WithTTLJitter[V any](fraction float64) Option[V] {
+	return func(g *gache[V]) error {
+		if !(fraction >= 0 && fraction <= 1) {
+			return ErrInvalidTTLJitter
+		}
+		g.ttlJitter = fraction
+		return nil
+	}
+}
+
+var (
+	// ErrInvalidMaxWorkers is returned by [NewWithError] for a negative
+	// [WithMaxWorkers].
+	ErrInvalidMaxWorkers = errors.New("gache: max workers must not be negative")
+
+	// ErrReplicationRole is returned by [NewWithError] for a cache configured
+	// with both [WithReplicationPrimary] and [WithReplicationReplica], since a
+	// replica does not log the mutations it applies.
+	ErrReplicationRole = errors.New("gache: a cache cannot be both a replication primary and a replica")
+)
+
+// validate reports the settings that the options accept but that make no
+// sense on their own or together.
+func (g *gache[V]) validate() error {
+	var errs []error
+	if g.maxWorkers < 0 {
+		errs = append(errs, ErrInvalidMaxWorkers)
+	}
+	if g.primary != nil && g.replica != nil {
+		errs = append(errs, ErrReplicationRole)
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,224 @@
+package gache
+
+import (
+	"context"
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/kpango/fastime"
+)
+
+const (
+	// skipListMaxLevel bounds the height of the ordered key index; with
+	// skipListP = 1/4 it comfortably indexes billions of keys.
+	skipListMaxLevel = 32
+	skipListP        = 4
+	// scanBatch is the number of keys copied out of the ordered index per
+	// lock acquisition while scanning.
+	scanBatch = 256
+)
+
+type (
+	// orderedIndex is a skip list over the keys of the cache, kept in sorted
+	// order. Keys are reference counted by the number of live values, like
+	// keyIndex, so the index follows every set, delete and expiration.
+	orderedIndex[V any] struct {
+		mu    sync.RWMutex
+		head  skipNode
+		level int
+	}
+
+	skipNode struct {
+		key  string
+		refs int
+		next []*skipNode
+	}
+)
+
+func newOrderedIndex[V any]() *orderedIndex[V] {
+	o := &orderedIndex[V]{level: 1}
+	o.head.next = make([]*skipNode, skipListMaxLevel)
+	return o
+}
+
+func randomLevel() int {
+	level := 1
+	for level < skipListMaxLevel && rand.IntN(skipListP) == 0 {
+		level++
+	}
+	return level
+}
+
+// seek fills prev with the rightmost node before key on every level and
+// returns the first node whose key is >= key. The caller must hold o.mu.
+func (o *orderedIndex[V]) seek(key string, prev []*skipNode) *skipNode {
+	x := &o.head
+	for i := o.level - 1; i >= 0; i-- {
+		for x.next[i] != nil && x.next[i].key < key {
+			x = x.next[i]
+		}
+		if prev != nil {
+			prev[i] = x
+		}
+	}
+	return x.next[0]
+}
+
+func (o *orderedIndex[V]) insert(key string, _ V, _ []string) {
+	var prev [skipListMaxLevel]*skipNode
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if n := o.seek(key, prev[:]); n != nil && n.key == key {
+		n.refs++
+		return
+	}
+	level := randomLevel()
+	for i := o.level; i < level; i++ {
+		prev[i] = &o.head
+	}
+	o.level = max(o.level, level)
+	n := &skipNode{key: key, refs: 1, next: make([]*skipNode, level)}
+	for i := range level {
+		n.next[i] = prev[i].next[i]
+		prev[i].next[i] = n
+	}
+}
+
+func (o *orderedIndex[V]) release(key string, _ V, _ []string) {
+	var prev [skipListMaxLevel]*skipNode
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	n := o.seek(key, prev[:])
+	if n == nil || n.key != key {
+		return
+	}
+	if n.refs--; n.refs > 0 {
+		return
+	}
+	for i := range n.next {
+		if prev[i].next[i] == n {
+			prev[i].next[i] = n.next[i]
+		}
+	}
+	for o.level > 1 && o.head.next[o.level-1] == nil {
+		o.level--
+	}
+}
+
+// ascend appends to keys up to n indexed keys starting at from, or strictly
+// after it when inclusive is false, in ascending order.
+func (o *orderedIndex[V]) ascend(keys []string, from string, inclusive bool, n int) []string {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	x := o.seek(from, nil)
+	if !inclusive && x != nil && x.key == from {
+		x = x.next[0]
+	}
+	for ; x != nil && n > 0; x, n = x.next[0], n-1 {
+		keys = append(keys, x.key)
+	}
+	return keys
+}
+
+// WithOrderedKeys maintains a sorted secondary index over all keys so that
+// [Gache.ScanPrefix] and [Gache.ScanRange] can walk keys in lexicographic
+// order without scanning every shard. The index is updated on every write,
+// delete and expiration under a single lock, which adds contention to
+// write-heavy workloads; enable it only when ordered scans are needed.
+func WithOrderedKeys[V any]() Option[V] {
+	return func(g *gache[V]) error {
+		if g.ordered == nil {
+			g.ordered = newOrderedIndex[V]()
+			g.addObserver(g.ordered)
+		}
+		return nil
+	}
+}
+
+// ScanPrefix returns, in ascending order, the keys of all non-expired entries
+// that start with prefix. It uses the ordered index enabled by
+// [WithOrderedKeys] and falls back to sorting the matching keys of a full
+// scan otherwise. The operation can be cancelled via the provided context.
+//
+// Example:
+//
+//	gc := gache.New[string](gache.WithOrderedKeys[string]())
+//	gc.Set("user:2", "bob")
+//	gc.Set("user:1", "alice")
+//
+//	keys := gc.ScanPrefix(context.Background(), "user:")
+//	fmt.Println(keys) // [user:1 user:2]
+func (g *gache[V]) ScanPrefix(ctx context.Context, prefix string) []string {
+	return g.scan(ctx, prefix, "", 0, func(key string) bool {
+		return strings.HasPrefix(key, prefix)
+	})
+}
+
+// ScanRange returns, in ascending order, up to limit keys of non-expired
+// entries in the half-open range [from, to). An empty to means no upper bound
+// and a limit <= 0 means no limit. Like [Gache.ScanPrefix] it uses the
+// ordered index when enabled. Passing the last returned key, with a zero byte
+// appended, as the next from pages through a range.
+//
+// Example:
+//
+//	keys := gc.ScanRange(context.Background(), "2024-01-01", "2024-02-01", 100)
+func (g *gache[V]) ScanRange(ctx context.Context, from, to string, limit int) []string {
+	return g.scan(ctx, from, to, limit, func(string) bool { return true })
+}
+
+// scan walks the keys >= from (and < to when to is non-empty) in ascending
+// order while match holds, returning at most limit live keys.
+func (g *gache[V]) scan(ctx context.Context, from, to string, limit int, match func(string) bool) (keys []string) {
+	inRange := func(key string) bool {
+		return key >= from && (to == "" || key < to) && match(key)
+	}
+	if g.ordered == nil {
+		keys = g.Keys(ctx)
+		keys = slices.DeleteFunc(keys, func(key string) bool { return !inRange(key) })
+		slices.Sort(keys)
+		if limit > 0 && len(keys) > limit {
+			keys = keys[:limit]
+		}
+		return keys
+	}
+
+	batch := make([]string, 0, scanBatch)
+	cursor, inclusive := from, true
+	for ctx.Err() == nil {
+		batch = g.ordered.ascend(batch[:0], cursor, inclusive, scanBatch)
+		for _, key := range batch {
+			if !inRange(key) {
+				return keys
+			}
+			if g.live(key) {
+				keys = append(keys, key)
+				if limit > 0 && len(keys) >= limit {
+					return keys
+				}
+			}
+		}
+		if len(batch) < scanBatch {
+			break
+		}
+		cursor, inclusive = batch[len(batch)-1], false
+	}
+	return keys
+}
+
+// live reports whether a non-expired entry exists for key without sliding
+// or sweeping it.
+func (g *gache[V]) live(key string) bool {
+	val, ok := g.shards[getShardID(key, g.maxKeyLength)].LoadPointer(key)
+	if !ok {
+		return false
+	}
+	val.mu.RLock()
+	match := val.key == key
+	expire := atomic.LoadInt64(&val.expire)
+	val.mu.RUnlock()
+	return match && (expire <= 0 || fastime.UnixNanoNow() <= expire)
+}
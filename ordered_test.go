@@ -0,0 +1,113 @@
+package gache
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestGache_ScanPrefix verifies that prefix scans return live keys in sorted order, with and without the ordered index.
+func TestGache_ScanPrefix(t *testing.T) {
+	t.Helper()
+	for _, tt := range []struct {
+		name string
+		opts []Option[int]
+	}{
+		{name: "ordered", opts: []Option[int]{WithOrderedKeys[int]()}},
+		{name: "fallback"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			gc := New(tt.opts...)
+			var want []string
+			for i := range 1000 {
+				key := fmt.Sprintf("user:%04d", i)
+				gc.Set(key, i)
+				gc.Set(fmt.Sprintf("group:%04d", i), i)
+				if i%3 == 0 {
+					gc.Delete(key)
+					continue
+				}
+				want = append(want, key)
+			}
+			gc.SetWithExpire("user:expired", 1, 50*time.Millisecond)
+			time.Sleep(150 * time.Millisecond)
+
+			if got := gc.ScanPrefix(t.Context(), "user:"); !slices.Equal(got, want) {
+				t.Errorf("expected %d sorted keys, got %d", len(want), len(got))
+			}
+			if got := gc.ScanPrefix(t.Context(), "none:"); len(got) != 0 {
+				t.Errorf("expected no keys, got %v", got)
+			}
+		})
+	}
+}
+
+// TestGache_ScanRange verifies half-open range bounds, limits and paging through a range.
+func TestGache_ScanRange(t *testing.T) {
+	t.Helper()
+	gc := New(WithOrderedKeys[int]())
+	for i := range 100 {
+		gc.Set(fmt.Sprintf("k%02d", i), i)
+	}
+
+	if got, want := gc.ScanRange(t.Context(), "k10", "k13", 0), []string{"k10", "k11", "k12"}; !slices.Equal(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+	if got, want := gc.ScanRange(t.Context(), "k95", "", 0), []string{"k95", "k96", "k97", "k98", "k99"}; !slices.Equal(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+
+	var paged []string
+	from := ""
+	for {
+		page := gc.ScanRange(t.Context(), from, "", 7)
+		paged = append(paged, page...)
+		if len(page) < 7 {
+			break
+		}
+		from = page[len(page)-1] + "\x00"
+	}
+	if len(paged) != 100 || !slices.IsSorted(paged) {
+		t.Errorf("expected 100 sorted keys across pages, got %d", len(paged))
+	}
+}
+
+// TestGache_OrderedIndexConsistency verifies that the ordered index drops keys on delete, expiration and Clear under concurrent writes.
+func TestGache_OrderedIndexConsistency(t *testing.T) {
+	gc := New(WithOrderedKeys[int]())
+	idx := gc.(*gache[int]).ordered
+
+	var wg sync.WaitGroup
+	for n := range 20 {
+		wg.Go(func() {
+			for i := range 500 {
+				key := fmt.Sprintf("key-%02d", i%50)
+				switch (n + i) % 3 {
+				case 0:
+					gc.Set(key, i)
+				case 1:
+					gc.Delete(key)
+				case 2:
+					gc.SetWithExpire(key, i, time.Millisecond)
+				}
+			}
+		})
+	}
+	wg.Wait()
+	time.Sleep(100 * time.Millisecond)
+	gc.DeleteExpired(t.Context())
+
+	indexed := idx.ascend(nil, "", true, 1000)
+	keys := gc.Keys(t.Context())
+	slices.Sort(keys)
+	if !slices.Equal(indexed, keys) {
+		t.Errorf("expected index %v to match keys %v", indexed, keys)
+	}
+
+	gc.Clear()
+	if indexed := idx.ascend(nil, "", true, 1000); len(indexed) != 0 {
+		t.Errorf("expected Clear to empty the index, got %v", indexed)
+	}
+}
@@ -0,0 +1,637 @@
+package gache
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"crypto/rand"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/kpango/fastime"
+)
+
+type (
+	// ReplicationOption configures [WithReplicationPrimary] and
+	// [WithReplicationReplica].
+	ReplicationOption func(*replicationConfig)
+
+	replicationConfig struct {
+		backlog   int
+		heartbeat time.Duration
+		retry     time.Duration
+		onError   func(err error)
+	}
+
+	replOp uint8
+
+	// replRecord is one mutation of the primary, identified by its offset
+	// in the mutation log. Snapshot records have offset 0.
+	replRecord[V any] struct {
+		Offset uint64
+		Op     replOp
+		Key    string
+		Value  V
+		Expire int64
+	}
+
+	// replHello is sent by a replica to resume after offset of the log id,
+	// or to request a full sync when id is unknown to the primary.
+	replHello struct {
+		LogID  string
+		Offset uint64
+	}
+
+	// replHeader answers a replHello. A full sync sends the snapshot
+	// followed by a replSynced record carrying the offset it reflects.
+	replHeader struct {
+		LogID string
+		Full  bool
+	}
+
+	// replLog is the bounded log of the most recent mutations of a primary.
+	// Records are spread by key over shards, each a ring buffer with a lock
+	// of its own, and numbered from a shared counter. A record reads the
+	// current state of its key and takes its offset under the lock of its
+	// shard, so the records of a key are numbered in the order of its
+	// writes even when the writes race; since merges the shards back into
+	// offset order.
+	replLog[V any] struct {
+		id     string
+		shards [replShards]replShard[V]
+		// last is the offset of the newest record; offsets start at 1.
+		last atomic.Uint64
+		// wake, when set by a reader waiting for records, is closed and
+		// cleared by the next append.
+		wake atomic.Pointer[chan struct{}]
+	}
+
+	replShard[V any] struct {
+		mu   sync.Mutex
+		buf  []replRecord[V]
+		head int
+		n    int
+		// dropped is the offset of the newest record overwritten.
+		dropped uint64
+		// Shards are locked by concurrent writers, so each one gets a
+		// cache line of its own.
+		_ [8]byte
+	}
+
+	// primary serves the mutation log of a cache to its replicas.
+	primary[V any] struct {
+		g      *gache[V]
+		log    *replLog[V]
+		cfg    replicationConfig
+		l      net.Listener
+		mu     sync.Mutex
+		conns  map[net.Conn]struct{}
+		done   chan struct{}
+		wg     sync.WaitGroup
+		closed bool
+	}
+
+	// replica follows a primary, applying its snapshot and mutations.
+	replica[V any] struct {
+		g      *gache[V]
+		addr   string
+		cfg    replicationConfig
+		logID  string
+		offset atomic.Uint64
+		ctx    context.Context
+		cancel context.CancelFunc
+		mu     sync.Mutex
+		conn   net.Conn
+		done   chan struct{}
+	}
+)
+
+const (
+	replSet replOp = iota + 1
+	replDelete
+	replClear
+	replSynced
+	replPing
+)
+
+const (
+	// replShards is the number of shards of a replLog.
+	replShards           = 64
+	defaultReplBacklog   = 1 << 16
+	defaultReplHeartbeat = time.Second
+	defaultReplRetry     = time.Second
+)
+
+var errReplProtocol = errors.New("gache: replication protocol error")
+
+// WithReplicationBacklog sets how many recent mutations a primary keeps so
+// that disconnected replicas can resume instead of resynchronizing from a
+// snapshot. The backlog is split evenly by key, so writes concentrated on
+// few keys fill it sooner. The default is 65536.
+func WithReplicationBacklog(n int) ReplicationOption {
+	return func(c *replicationConfig) {
+		if n > 0 {
+			c.backlog = n
+		}
+	}
+}
+
+// WithReplicationHeartbeat sets how often an idle primary signals that it is
+// alive. A replica that hears nothing for three heartbeats reconnects. Both
+// sides must use the same value; the default is one second.
+func WithReplicationHeartbeat(d time.Duration) ReplicationOption {
+	return func(c *replicationConfig) {
+		if d > 0 {
+			c.heartbeat = d
+		}
+	}
+}
+
+// WithReplicationRetry sets how long a replica waits before reconnecting to
+// its primary; the default is one second.
+func WithReplicationRetry(d time.Duration) ReplicationOption {
+	return func(c *replicationConfig) {
+		if d > 0 {
+			c.retry = d
+		}
+	}
+}
+
+// WithReplicationErrorHandler sets a function called with the errors that
+// end a replication connection.
+func WithReplicationErrorHandler(f func(err error)) ReplicationOption {
+	return func(c *replicationConfig) {
+		c.onError = f
+	}
+}
+
+func newReplicationConfig(opts []ReplicationOption) replicationConfig {
+	cfg := replicationConfig{
+		backlog:   defaultReplBacklog,
+		heartbeat: defaultReplHeartbeat,
+		retry:     defaultReplRetry,
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return cfg
+}
+
+// ErrNilListener is returned by [WithReplicationPrimary] for a nil listener.
+var ErrNilListener = errors.New("gache: replication listener must not be nil")
+
+// WithReplicationPrimary makes the cache a replication primary serving
+// replicas that connect to l. Every Set, conditional set, Compute, Txn,
+// SetMulti, delete, InvalidateTag and Clear is appended to a mutation log,
+// with absolute expirations so that replicas expire entries at the same time.
+// A replica connecting for the first time, or after falling behind the
+// backlog set by [WithReplicationBacklog], first receives a snapshot of the
+// cache.
+//
+// Changes to the expiration of an entry that are not writes, such as
+// GetRefresh, ExtendExpire and sliding expirations, are not replicated, and
+// snapshots leave out entries spilled to the disk tier. Evictions by
+// [WithMaxEntries] are not replicated either, since the evicted entry still
+// exists on the primary's disk tier, if any, and a replica bounds its own size
+// with its own WithMaxEntries.
+// [Gache.Close] closes l and disconnects the replicas. Values are encoded
+// with encoding/gob.
+//
+// Example:
+//
+//	l, err := net.Listen("tcp", ":7400")
+//	if err != nil {
+//	    return err
+//	}
+//	gc := gache.New[User](gache.WithReplicationPrimary[User](l))
+//	defer gc.Close()
+func WithReplicationPrimary[V any](l net.Listener, opts ...ReplicationOption) Option[V] {
+	return func(g *gache[V]) error {
+		if l == nil {
+			return ErrNilListener
+		}
+		cfg := newReplicationConfig(opts)
+		p := &primary[V]{
+			g:     g,
+			log:   newReplLog[V](cfg.backlog),
+			cfg:   cfg,
+			l:     l,
+			conns: make(map[net.Conn]struct{}),
+			done:  make(chan struct{}),
+		}
+		if g.primary != nil {
+			g.primary.close()
+		}
+		g.primary = p
+		p.wg.Go(p.accept)
+		return nil
+	}
+}
+
+// WithReplicationReplica makes the cache a replica of the primary listening
+// on addr. The replica loads a snapshot of the primary and then applies its
+// mutations as they happen, reconnecting and resuming where it left off when
+// the connection breaks. Replicated mutations are not written to the replica's
+// [Store] nor published on its invalidation bus. Writes made directly to a
+// replica are overwritten by the next snapshot but otherwise not reconciled.
+// [Gache.Close] stops replicating.
+//
+// Example:
+//
+//	gc := gache.New[User](gache.WithReplicationReplica[User]("primary:7400",
+//	    gache.WithReplicationErrorHandler(func(err error) {
+//	        log.Printf("replication: %v", err)
+//	    })))
+//	defer gc.Close()
+func WithReplicationReplica[V any](addr string, opts ...ReplicationOption) Option[V] {
+	return func(g *gache[V]) error {
+		r := &replica[V]{
+			g:    g,
+			addr: addr,
+			cfg:  newReplicationConfig(opts),
+			done: make(chan struct{}),
+		}
+		r.ctx, r.cancel = context.WithCancel(context.Background())
+		if g.replica != nil {
+			g.replica.close()
+		}
+		g.replica = r
+		go r.run()
+		return nil
+	}
+}
+
+// replicateKey appends the current state of key to the mutation log.
+func (g *gache[V]) replicateKey(key string) {
+	if g.primary != nil {
+		g.primary.log.appendKey(g, key)
+	}
+}
+
+// apply stores a replicated entry without propagating it to the Store, the
+// invalidation bus or a mutation log.
+func (g *gache[V]) apply(key string, val V, expire int64) {
+	shard := g.shards[getShardID(key, g.maxKeyLength)]
+	if expire > 0 && fastime.UnixNanoNow() > expire {
+		g.deleteFrom(shard, key)
+		g.dropSpilled(key)
+		return
+	}
+	if old, loaded := shard.SwapPointer(key, g.newValue(key, val, expire, 0, 0, nil)); loaded {
+		g.putValue(old)
+	}
+}
+
+func newReplLog[V any](backlog int) *replLog[V] {
+	var id [8]byte
+	rand.Read(id[:])
+	l := &replLog[V]{id: hex.EncodeToString(id[:])}
+	size := (backlog + replShards - 1) / replShards
+	for i := range l.shards {
+		l.shards[i].buf = make([]replRecord[V], size)
+	}
+	return l
+}
+
+// appendKey appends a record with the current value and expiration of key,
+// or a delete if key is missing or expired.
+func (l *replLog[V]) appendKey(g *gache[V], key string) {
+	rec := replRecord[V]{Op: replDelete, Key: key}
+	s := &l.shards[getShardID(key, g.maxKeyLength)%replShards]
+	s.mu.Lock()
+	if v, ok := g.shards[getShardID(key, g.maxKeyLength)].LoadPointer(key); ok {
+		v.mu.RLock()
+		if v.key == key {
+			expire := atomic.LoadInt64(&v.expire)
+			if expire <= 0 || fastime.UnixNanoNow() <= expire {
+				rec.Op, rec.Value, rec.Expire = replSet, v.val, expire
+			}
+		}
+		v.mu.RUnlock()
+	}
+	s.append(rec, &l.last)
+	s.mu.Unlock()
+	l.notify()
+}
+
+// lock holds every shard of the log, so that no record can be appended until
+// unlockClear.
+func (l *replLog[V]) lock() {
+	for i := range l.shards {
+		l.shards[i].mu.Lock()
+	}
+}
+
+// unlockClear appends a clear record and releases the shards held by lock.
+func (l *replLog[V]) unlockClear() {
+	l.shards[0].append(replRecord[V]{Op: replClear}, &l.last)
+	for i := range l.shards {
+		l.shards[len(l.shards)-1-i].mu.Unlock()
+	}
+	l.notify()
+}
+
+// append assigns rec the next offset counted by last and appends it,
+// overwriting the oldest record when the shard is full. The caller must hold
+// s.mu.
+func (s *replShard[V]) append(rec replRecord[V], last *atomic.Uint64) {
+	rec.Offset = last.Add(1)
+	if s.n < len(s.buf) {
+		s.buf[(s.head+s.n)%len(s.buf)] = rec
+		s.n++
+		return
+	}
+	s.dropped = s.buf[s.head].Offset
+	s.buf[s.head] = rec
+	s.head = (s.head + 1) % len(s.buf)
+}
+
+// notify wakes the readers waiting for records, if any.
+func (l *replLog[V]) notify() {
+	if l.wake.Load() == nil {
+		return
+	}
+	if wake := l.wake.Swap(nil); wake != nil {
+		close(*wake)
+	}
+}
+
+// since appends the records after offset to recs, stopping before the first
+// offset whose record is still being appended. It reports false if some of
+// them have already been overwritten; otherwise wake is closed when newer
+// records are appended.
+func (l *replLog[V]) since(offset uint64, recs []replRecord[V]) (_ []replRecord[V], wake <-chan struct{}, ok bool) {
+	// Taking wake before reading the shards makes sure that a record
+	// appended after they were read closes it.
+	for wake == nil {
+		if w := l.wake.Load(); w != nil {
+			wake = *w
+		} else if w := make(chan struct{}); l.wake.CompareAndSwap(nil, &w) {
+			wake = w
+		}
+	}
+	if offset > l.last.Load() {
+		return recs, nil, false
+	}
+	start := len(recs)
+	for i := range l.shards {
+		s := &l.shards[i]
+		s.mu.Lock()
+		if s.dropped > offset {
+			s.mu.Unlock()
+			return recs[:start], nil, false
+		}
+		first := sort.Search(s.n, func(j int) bool {
+			return s.buf[(s.head+j)%len(s.buf)].Offset > offset
+		})
+		for j := first; j < s.n; j++ {
+			recs = append(recs, s.buf[(s.head+j)%len(s.buf)])
+		}
+		s.mu.Unlock()
+	}
+	added := recs[start:]
+	slices.SortFunc(added, func(a, b replRecord[V]) int { return cmp.Compare(a.Offset, b.Offset) })
+	for i := range added {
+		if added[i].Offset != offset+uint64(i)+1 {
+			return recs[:start+i], wake, true
+		}
+	}
+	return recs, wake, true
+}
+
+func (p *primary[V]) accept() {
+	for {
+		conn, err := p.l.Accept()
+		if err != nil {
+			p.mu.Lock()
+			closed := p.closed
+			p.mu.Unlock()
+			if !closed && p.cfg.onError != nil {
+				p.cfg.onError(err)
+			}
+			return
+		}
+		p.mu.Lock()
+		if p.closed {
+			p.mu.Unlock()
+			conn.Close()
+			return
+		}
+		p.conns[conn] = struct{}{}
+		p.mu.Unlock()
+		p.wg.Go(func() {
+			err := p.serve(conn)
+			p.mu.Lock()
+			delete(p.conns, conn)
+			closed := p.closed
+			p.mu.Unlock()
+			conn.Close()
+			if err != nil && !closed && p.cfg.onError != nil {
+				p.cfg.onError(err)
+			}
+		})
+	}
+}
+
+// serve streams the mutation log to one replica, starting with a snapshot
+// unless the replica can resume from the backlog.
+func (p *primary[V]) serve(conn net.Conn) error {
+	conn.SetReadDeadline(time.Now().Add(3 * p.cfg.heartbeat))
+	var hello replHello
+	if err := gob.NewDecoder(conn).Decode(&hello); err != nil {
+		return err
+	}
+	w := bufio.NewWriter(conn)
+	enc := gob.NewEncoder(w)
+	offset := hello.Offset
+	recs, _, ok := p.log.since(offset, nil)
+	if hello.LogID != p.log.id || !ok {
+		if err := enc.Encode(replHeader{LogID: p.log.id, Full: true}); err != nil {
+			return err
+		}
+		var err error
+		if offset, err = p.snapshot(enc); err != nil {
+			return err
+		}
+		recs = recs[:0]
+	} else if err := enc.Encode(replHeader{LogID: p.log.id}); err != nil {
+		return err
+	}
+	tick := time.NewTicker(p.cfg.heartbeat)
+	defer tick.Stop()
+	for {
+		var wake <-chan struct{}
+		if recs, wake, ok = p.log.since(offset, recs[:0]); !ok {
+			return fmt.Errorf("gache: replica %s fell behind the replication backlog", conn.RemoteAddr())
+		}
+		for i := range recs {
+			if err := enc.Encode(&recs[i]); err != nil {
+				return err
+			}
+			offset = recs[i].Offset
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		if len(recs) > 0 {
+			continue
+		}
+		select {
+		case <-wake:
+		case <-tick.C:
+			if err := enc.Encode(replRecord[V]{Op: replPing, Offset: offset}); err != nil {
+				return err
+			}
+		case <-p.done:
+			return nil
+		}
+	}
+}
+
+// snapshot sends every non-expired entry followed by a replSynced record
+// and returns the log offset the snapshot is consistent with once the later
+// records are applied.
+func (p *primary[V]) snapshot(enc *gob.Encoder) (offset uint64, err error) {
+	// Every record numbered up to offset describes a write already in the
+	// shards, which the snapshot therefore reflects.
+	offset = p.log.last.Load()
+	now := fastime.UnixNanoNow()
+	for _, shard := range p.g.shards {
+		shard.RangePointer(func(k string, v *value[V]) bool {
+			v.mu.RLock()
+			rec := replRecord[V]{Op: replSet, Key: k, Value: v.val, Expire: atomic.LoadInt64(&v.expire)}
+			valid := v.key == k && (rec.Expire <= 0 || now <= rec.Expire)
+			v.mu.RUnlock()
+			if valid {
+				err = enc.Encode(&rec)
+			}
+			return err == nil
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+	return offset, enc.Encode(replRecord[V]{Op: replSynced, Offset: offset})
+}
+
+// close stops accepting replicas and disconnects the connected ones.
+func (p *primary[V]) close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	close(p.done)
+	err := p.l.Close()
+	for conn := range p.conns {
+		conn.Close()
+	}
+	p.mu.Unlock()
+	p.wg.Wait()
+	return err
+}
+
+// run keeps the replica connected until it is closed.
+func (r *replica[V]) run() {
+	defer close(r.done)
+	for {
+		err := r.follow()
+		if r.ctx.Err() != nil {
+			return
+		}
+		if err != nil && r.cfg.onError != nil {
+			r.cfg.onError(err)
+		}
+		select {
+		case <-r.ctx.Done():
+			return
+		case <-time.After(r.cfg.retry):
+		}
+	}
+}
+
+// follow connects to the primary and applies what it sends until the
+// connection fails.
+func (r *replica[V]) follow() error {
+	var d net.Dialer
+	conn, err := d.DialContext(r.ctx, "tcp", r.addr)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	r.conn = conn
+	r.mu.Unlock()
+	defer conn.Close()
+	if r.ctx.Err() != nil {
+		return nil
+	}
+
+	if err := gob.NewEncoder(conn).Encode(replHello{LogID: r.logID, Offset: r.offset.Load()}); err != nil {
+		return err
+	}
+	dec := gob.NewDecoder(bufio.NewReader(conn))
+	read := func(v any) error {
+		conn.SetReadDeadline(time.Now().Add(3 * r.cfg.heartbeat))
+		return dec.Decode(v)
+	}
+	var hdr replHeader
+	if err := read(&hdr); err != nil {
+		return err
+	}
+	if hdr.Full {
+		// Until the snapshot is complete the replica cannot resume.
+		r.logID = ""
+		r.g.clearLocal()
+	}
+	for {
+		var rec replRecord[V]
+		if err := read(&rec); err != nil {
+			return err
+		}
+		// Log records must follow each other without gaps.
+		if rec.Op != replSynced && rec.Op != replPing && rec.Offset != 0 &&
+			rec.Offset != r.offset.Load()+1 {
+			return errReplProtocol
+		}
+		switch rec.Op {
+		case replSet:
+			r.g.apply(rec.Key, rec.Value, rec.Expire)
+		case replDelete:
+			r.g.deleteFrom(r.g.shards[getShardID(rec.Key, r.g.maxKeyLength)], rec.Key)
+			r.g.dropSpilled(rec.Key)
+		case replClear:
+			r.g.clearLocal()
+		case replSynced:
+			r.logID = hdr.LogID
+			r.offset.Store(rec.Offset)
+			continue
+		case replPing:
+			continue
+		default:
+			return errReplProtocol
+		}
+		if rec.Offset != 0 {
+			r.offset.Store(rec.Offset)
+		}
+	}
+}
+
+// close stops replicating.
+func (r *replica[V]) close() {
+	r.cancel()
+	r.mu.Lock()
+	if r.conn != nil {
+		r.conn.Close()
+	}
+	r.mu.Unlock()
+	<-r.done
+}
@@ -0,0 +1,156 @@
+package gache
+
+import (
+	"net"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func newReplicationPair(t *testing.T, backlog int) (primary, replica *gache[string]) {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	opts := []ReplicationOption{
+		WithReplicationBacklog(backlog),
+		WithReplicationHeartbeat(50 * time.Millisecond),
+		WithReplicationRetry(20 * time.Millisecond),
+	}
+	p := New(WithReplicationPrimary[string](l, opts...)).(*gache[string])
+	t.Cleanup(func() { p.Close() })
+	p.SetWithExpire("before", "snapshot", NoTTL)
+	r := New(WithReplicationReplica[string](l.Addr().String(), opts...)).(*gache[string])
+	t.Cleanup(func() { r.Close() })
+	return p, r
+}
+
+// caughtUp waits until the replica has applied the whole log of the primary.
+func caughtUp(t *testing.T, p, r *gache[string]) {
+	t.Helper()
+	eventually(t, func() bool {
+		return r.replica.offset.Load() == p.primary.log.last.Load()
+	}, "expected the replica to catch up")
+}
+
+// TestGache_Replication verifies that a replica loads the snapshot of its
+// primary and then follows its sets, deletes, tag invalidations and clears,
+// with the same absolute expirations.
+func TestGache_Replication(t *testing.T) {
+	t.Helper()
+	p, r := newReplicationPair(t, 1024)
+	caughtUp(t, p, r)
+	if v, ok := r.Get("before"); !ok || v != "snapshot" {
+		t.Fatalf("expected the snapshot to be replicated, got %q, %v", v, ok)
+	}
+
+	p.SetWithExpire("ttl", "v", time.Hour)
+	p.Set("gone", "v")
+	p.Delete("gone")
+	p.Compute("computed", func(string, bool) (string, Op) { return "c", OpReplace })
+	p.SetWithTags("tagged", "v", NoTTL, "t")
+	p.InvalidateTag("t")
+	caughtUp(t, p, r)
+	_, pexp, _ := p.GetWithExpire("ttl")
+	if v, rexp, ok := r.GetWithExpire("ttl"); !ok || v != "v" || rexp != pexp {
+		t.Errorf("expected ttl with expiration %d, got %q, %d, %v", pexp, v, rexp, ok)
+	}
+	if _, ok := r.Get("gone"); ok {
+		t.Error("expected the delete to be replicated")
+	}
+	if v, _ := r.Get("computed"); v != "c" {
+		t.Errorf("expected the Compute to be replicated, got %q", v)
+	}
+	if _, ok := r.Get("tagged"); ok {
+		t.Error("expected InvalidateTag to be replicated")
+	}
+
+	p.Clear()
+	p.Set("after", "clear")
+	caughtUp(t, p, r)
+	if n := r.Len(); n != 1 {
+		t.Errorf("expected only the key written after Clear, got %d entries", n)
+	}
+}
+
+// TestGache_ReplicationResume verifies that a reconnecting replica resumes
+// from its offset while the backlog holds the missed mutations and
+// resynchronizes from a snapshot otherwise.
+func TestGache_ReplicationResume(t *testing.T) {
+	t.Helper()
+	p, r := newReplicationPair(t, 8)
+	caughtUp(t, p, r)
+
+	// A key written only to the replica survives a resume but not a
+	// snapshot, which starts by clearing the replica.
+	r.apply("local", "x", 0)
+	disconnect := func() {
+		r.replica.mu.Lock()
+		r.replica.conn.Close()
+		r.replica.mu.Unlock()
+	}
+
+	disconnect()
+	p.Set("k1", "v")
+	p.Set("k2", "v")
+	caughtUp(t, p, r)
+	if _, ok := r.Get("local"); !ok {
+		t.Fatal("expected the replica to resume without a snapshot")
+	}
+
+	disconnect()
+	for i := range 20 {
+		p.Set("bulk"+strconv.Itoa(i), "v")
+	}
+	caughtUp(t, p, r)
+	if _, ok := r.Get("local"); ok {
+		t.Error("expected the replica to resynchronize from a snapshot")
+	}
+	if r.Len() != p.Len() {
+		t.Errorf("expected %d entries, got %d", p.Len(), r.Len())
+	}
+}
+
+// TestReplLog verifies reading the sharded ring buffers of the mutation log.
+func TestReplLog(t *testing.T) {
+	t.Helper()
+	l := newReplLog[string](3 * replShards)
+	s := &l.shards[0]
+	for i := range 5 {
+		s.append(replRecord[string]{Key: strconv.Itoa(i)}, &l.last)
+	}
+	recs, _, ok := l.since(3, nil)
+	if !ok || len(recs) != 2 || recs[0].Offset != 4 || recs[1].Key != "4" {
+		t.Errorf("expected offsets 4 and 5, got %+v, %v", recs, ok)
+	}
+	if recs, _, ok = l.since(5, nil); !ok || len(recs) != 0 {
+		t.Errorf("expected no records after the newest, got %+v, %v", recs, ok)
+	}
+	if _, _, ok = l.since(1, nil); ok {
+		t.Error("expected overwritten records to be reported")
+	}
+	if _, _, ok = l.since(6, nil); ok {
+		t.Error("expected an offset from the future to be rejected")
+	}
+
+	// Offset 6 is taken but not appended yet: 7, in another shard, must
+	// wait for it.
+	l.last.Add(1)
+	l.shards[1].append(replRecord[string]{Key: "7"}, &l.last)
+	recs, wake, ok := l.since(5, nil)
+	if !ok || len(recs) != 0 {
+		t.Errorf("expected no records before the gap, got %+v, %v", recs, ok)
+	}
+	l.shards[2].buf[0] = replRecord[string]{Key: "6", Offset: 6}
+	l.shards[2].n = 1
+	l.notify()
+	select {
+	case <-wake:
+	default:
+		t.Error("expected the append to wake the reader")
+	}
+	if recs, _, ok = l.since(5, nil); !ok || len(recs) != 2 || recs[0].Key != "6" || recs[1].Key != "7" {
+		t.Errorf("expected offsets 6 and 7 in order, got %+v, %v", recs, ok)
+	}
+}
@@ -0,0 +1,176 @@
+package resp
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"slices"
+	"strconv"
+)
+
+const (
+	// maxArgs bounds the number of arguments of a single command.
+	maxArgs = 1 << 20
+	// maxBulk bounds the size of a single argument, like Redis'
+	// proto-max-bulk-len default of 512MB.
+	maxBulk = 512 << 20
+	// maxInline bounds the length of a line; it is also the size of the
+	// connection's read buffer.
+	maxInline = 64 << 10
+	// argsPrealloc and bulkPrealloc bound the memory reserved for a command
+	// from the counts in its headers before the data they announce arrives.
+	argsPrealloc = 64
+	bulkPrealloc = 64 << 10
+)
+
+// protocolError is a malformed request; the connection is closed after it
+// is reported to the client.
+type protocolError string
+
+func (e protocolError) Error() string { return string(e) }
+
+// readCommand reads one command, either a RESP array of bulk strings as sent
+// by client libraries or an inline command as typed into telnet. An empty
+// inline command yields no arguments.
+func readCommand(r *bufio.Reader) ([][]byte, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 || line[0] != '*' {
+		fields := bytes.Fields(line)
+		args := make([][]byte, len(fields))
+		for i, f := range fields {
+			args[i] = bytes.Clone(f)
+		}
+		return args, nil
+	}
+	n, err := strconv.Atoi(string(line[1:]))
+	if err != nil || n > maxArgs {
+		return nil, protocolError("invalid multibulk length")
+	}
+	if n <= 0 {
+		return nil, nil
+	}
+	args := make([][]byte, 0, min(n, argsPrealloc))
+	for range n {
+		line, err = readLine(r)
+		if err != nil {
+			return nil, err
+		}
+		if len(line) == 0 || line[0] != '$' {
+			return nil, protocolError("expected '$', got '" + string(line[:min(len(line), 1)]) + "'")
+		}
+		size, err := strconv.Atoi(string(line[1:]))
+		if err != nil || size < 0 || size > maxBulk {
+			return nil, protocolError("invalid bulk length")
+		}
+		buf, err := readBulk(r, size)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, buf)
+	}
+	return args, nil
+}
+
+// readBulk reads a bulk string of size bytes and its "\r\n" terminator. The
+// buffer starts at no more than bulkPrealloc bytes and doubles as data
+// arrives, so a length announced by a client costs memory only once the
+// client has actually sent it.
+func readBulk(r *bufio.Reader, size int) ([]byte, error) {
+	buf := make([]byte, min(size+2, bulkPrealloc))
+	read := 0
+	for {
+		n, err := io.ReadFull(r, buf[read:])
+		read += n
+		if err != nil {
+			return nil, err
+		}
+		if read == size+2 {
+			break
+		}
+		buf = slices.Grow(buf, min(size+2-read, read))
+		buf = buf[:min(cap(buf), size+2)]
+	}
+	if buf[size] != '\r' || buf[size+1] != '\n' {
+		return nil, protocolError("invalid bulk terminator")
+	}
+	return buf[:size:size], nil
+}
+
+// readLine reads a line terminated by "\r\n" or "\n" and returns it without
+// the terminator. The result is only valid until the next read.
+func readLine(r *bufio.Reader) ([]byte, error) {
+	line, err := r.ReadSlice('\n')
+	if err == bufio.ErrBufferFull {
+		return nil, protocolError("too big inline request")
+	}
+	if err != nil {
+		return nil, err
+	}
+	line = line[:len(line)-1]
+	if n := len(line); n > 0 && line[n-1] == '\r' {
+		line = line[:n-1]
+	}
+	return line, nil
+}
+
+// writer encodes RESP2 replies. Write errors are sticky in the underlying
+// bufio.Writer and surface on Flush.
+type writer struct {
+	w *bufio.Writer
+}
+
+func (w *writer) simple(s string) {
+	w.w.WriteByte('+')
+	w.w.WriteString(s)
+	w.w.WriteString("\r\n")
+}
+
+func (w *writer) error(s string) {
+	w.w.WriteByte('-')
+	w.w.WriteString(s)
+	w.w.WriteString("\r\n")
+}
+
+func (w *writer) integer(n int64) {
+	w.w.WriteByte(':')
+	w.w.WriteString(strconv.FormatInt(n, 10))
+	w.w.WriteString("\r\n")
+}
+
+func (w *writer) boolean(b bool) {
+	if b {
+		w.integer(1)
+		return
+	}
+	w.integer(0)
+}
+
+func (w *writer) bulk(b []byte) {
+	w.w.WriteByte('$')
+	w.w.WriteString(strconv.Itoa(len(b)))
+	w.w.WriteString("\r\n")
+	w.w.Write(b)
+	w.w.WriteString("\r\n")
+}
+
+func (w *writer) bulkString(s string) {
+	w.w.WriteByte('$')
+	w.w.WriteString(strconv.Itoa(len(s)))
+	w.w.WriteString("\r\n")
+	w.w.WriteString(s)
+	w.w.WriteString("\r\n")
+}
+
+// null writes the null bulk string Redis uses for missing values.
+func (w *writer) null() {
+	w.w.WriteString("$-1\r\n")
+}
+
+func (w *writer) array(n int) {
+	w.w.WriteByte('*')
+	w.w.WriteString(strconv.Itoa(n))
+	w.w.WriteString("\r\n")
+}
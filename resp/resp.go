@@ -0,0 +1,568 @@
+// Package resp serves a gache cache over a subset of the Redis protocol
+// (RESP2), so that existing Redis clients and tools can talk to an
+// in-process gache, for example as a lightweight stand-in for Redis in local
+// development and tests.
+//
+// Supported commands are GET, SET (with EX, PX, NX and XX), DEL, EXISTS,
+// EXPIRE, TTL, PERSIST, INCR, INCRBY, DECR, DECRBY, MGET, MSET, SCAN, KEYS,
+// FLUSHALL, FLUSHDB, DBSIZE and INFO, plus PING, ECHO, SELECT 0, COMMAND
+// and QUIT for client compatibility. Like Redis, keys written without EX or
+// PX never expire, regardless of the cache's default expiration.
+//
+// Example:
+//
+//	gc := gache.New[[]byte]().StartExpired(ctx, time.Second)
+//	srv := resp.New(gc)
+//	go srv.ListenAndServe("127.0.0.1:6379")
+//	defer srv.Close()
+package resp
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/kpango/gache/v2"
+)
+
+// ErrServerClosed is returned by [Server.Serve] after [Server.Close].
+var ErrServerClosed = errors.New("resp: server closed")
+
+// Server serves a [gache.Gache] to Redis clients.
+type Server struct {
+	gc        gache.Gache[[]byte]
+	start     time.Time
+	mu        sync.Mutex
+	listeners map[net.Listener]struct{}
+	conns     map[net.Conn]struct{}
+	wg        sync.WaitGroup
+	clients   atomic.Int64
+	commands  atomic.Uint64
+	closed    atomic.Bool
+}
+
+// New returns a Server for gc.
+func New(gc gache.Gache[[]byte]) *Server {
+	return &Server{
+		gc:        gc,
+		start:     time.Now(),
+		listeners: make(map[net.Listener]struct{}),
+		conns:     make(map[net.Conn]struct{}),
+	}
+}
+
+// ListenAndServe listens on the TCP address addr and calls [Server.Serve].
+func (s *Server) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
+
+// Serve accepts connections on l and serves each in its own goroutine until
+// l fails or the server is closed. It always returns a non-nil error.
+func (s *Server) Serve(l net.Listener) error {
+	if !s.track(l, nil) {
+		l.Close()
+		return ErrServerClosed
+	}
+	defer s.untrack(l, nil)
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if s.closed.Load() {
+				return ErrServerClosed
+			}
+			return err
+		}
+		if !s.track(nil, conn) {
+			conn.Close()
+			return ErrServerClosed
+		}
+		s.wg.Go(func() {
+			defer s.untrack(nil, conn)
+			s.serveConn(conn)
+		})
+	}
+}
+
+// Close closes all listeners and connections and waits for the connection
+// goroutines to return.
+func (s *Server) Close() error {
+	s.closed.Store(true)
+	s.mu.Lock()
+	for l := range s.listeners {
+		l.Close()
+	}
+	for c := range s.conns {
+		c.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	return nil
+}
+
+func (s *Server) track(l net.Listener, c net.Conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed.Load() {
+		return false
+	}
+	if l != nil {
+		s.listeners[l] = struct{}{}
+	}
+	if c != nil {
+		s.conns[c] = struct{}{}
+	}
+	return true
+}
+
+func (s *Server) untrack(l net.Listener, c net.Conn) {
+	s.mu.Lock()
+	delete(s.listeners, l)
+	delete(s.conns, c)
+	s.mu.Unlock()
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	s.clients.Add(1)
+	defer s.clients.Add(-1)
+	defer conn.Close()
+	r := bufio.NewReaderSize(conn, maxInline)
+	w := &writer{w: bufio.NewWriter(conn)}
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			var perr protocolError
+			if errors.As(err, &perr) {
+				w.error("ERR Protocol error: " + string(perr))
+				w.w.Flush()
+			}
+			return
+		}
+		if len(args) > 0 {
+			s.commands.Add(1)
+			if quit := s.exec(w, args); quit {
+				w.w.Flush()
+				return
+			}
+		}
+		// Flush once the pipelined commands received so far are answered.
+		if r.Buffered() == 0 {
+			if err := w.w.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// exec runs one command and reports whether the connection must be closed.
+func (s *Server) exec(w *writer, args [][]byte) (quit bool) {
+	name := strings.ToUpper(string(args[0]))
+	cmd, ok := commands[name]
+	if !ok {
+		w.error("ERR unknown command '" + string(args[0]) + "'")
+		return false
+	}
+	if len(args) < cmd.minArgs || (cmd.maxArgs > 0 && len(args) > cmd.maxArgs) ||
+		(cmd.pairs && len(args)%2 == 0) {
+		w.error("ERR wrong number of arguments for '" + strings.ToLower(name) + "' command")
+		return false
+	}
+	if name == "QUIT" {
+		w.simple("OK")
+		return true
+	}
+	cmd.run(s, w, args[1:])
+	return false
+}
+
+// command describes a command: its arity including the name, where
+// maxArgs 0 means unbounded and pairs requires key-value pairs after the
+// name, and its implementation.
+type command struct {
+	run     func(s *Server, w *writer, args [][]byte)
+	minArgs int
+	maxArgs int
+	pairs   bool
+}
+
+var commands map[string]command
+
+func init() {
+	commands = map[string]command{
+		"PING":     {run: (*Server).ping, minArgs: 1, maxArgs: 2},
+		"ECHO":     {run: (*Server).echo, minArgs: 2, maxArgs: 2},
+		"SELECT":   {run: (*Server).selectDB, minArgs: 2, maxArgs: 2},
+		"COMMAND":  {run: (*Server).command, minArgs: 1},
+		"QUIT":     {minArgs: 1, maxArgs: 1},
+		"GET":      {run: (*Server).get, minArgs: 2, maxArgs: 2},
+		"SET":      {run: (*Server).set, minArgs: 3},
+		"DEL":      {run: (*Server).del, minArgs: 2},
+		"EXISTS":   {run: (*Server).exists, minArgs: 2},
+		"EXPIRE":   {run: (*Server).expire, minArgs: 3, maxArgs: 3},
+		"TTL":      {run: (*Server).ttl, minArgs: 2, maxArgs: 2},
+		"PERSIST":  {run: (*Server).persist, minArgs: 2, maxArgs: 2},
+		"INCR":     {run: incrBy(1), minArgs: 2, maxArgs: 2},
+		"DECR":     {run: incrBy(-1), minArgs: 2, maxArgs: 2},
+		"INCRBY":   {run: incrByArg(1), minArgs: 3, maxArgs: 3},
+		"DECRBY":   {run: incrByArg(-1), minArgs: 3, maxArgs: 3},
+		"MGET":     {run: (*Server).mget, minArgs: 2},
+		"MSET":     {run: (*Server).mset, minArgs: 3, pairs: true},
+		"SCAN":     {run: (*Server).scan, minArgs: 2},
+		"KEYS":     {run: (*Server).keys, minArgs: 2, maxArgs: 2},
+		"FLUSHALL": {run: (*Server).flushall, minArgs: 1, maxArgs: 2},
+		"FLUSHDB":  {run: (*Server).flushall, minArgs: 1, maxArgs: 2},
+		"DBSIZE":   {run: (*Server).dbsize, minArgs: 1, maxArgs: 1},
+		"INFO":     {run: (*Server).info, minArgs: 1},
+	}
+}
+
+const (
+	errSyntax     = "ERR syntax error"
+	errNotInteger = "ERR value is not an integer or out of range"
+)
+
+func (s *Server) ping(w *writer, args [][]byte) {
+	if len(args) == 1 {
+		w.bulk(args[0])
+		return
+	}
+	w.simple("PONG")
+}
+
+func (s *Server) echo(w *writer, args [][]byte) {
+	w.bulk(args[0])
+}
+
+func (s *Server) selectDB(w *writer, args [][]byte) {
+	if string(args[0]) != "0" {
+		w.error("ERR DB index is out of range")
+		return
+	}
+	w.simple("OK")
+}
+
+func (s *Server) command(w *writer, _ [][]byte) {
+	w.array(0)
+}
+
+func (s *Server) get(w *writer, args [][]byte) {
+	if v, ok := s.gc.Get(string(args[0])); ok {
+		w.bulk(v)
+		return
+	}
+	w.null()
+}
+
+func (s *Server) set(w *writer, args [][]byte) {
+	key, val := string(args[0]), args[1]
+	ttl := gache.NoTTL
+	var nx, xx, hasTTL bool
+	for i := 2; i < len(args); i++ {
+		switch opt := strings.ToUpper(string(args[i])); opt {
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		case "EX", "PX":
+			if hasTTL || i+1 == len(args) {
+				w.error(errSyntax)
+				return
+			}
+			i++
+			n, err := strconv.ParseInt(string(args[i]), 10, 64)
+			if err != nil {
+				w.error(errNotInteger)
+				return
+			}
+			unit := time.Second
+			if opt == "PX" {
+				unit = time.Millisecond
+			}
+			if n <= 0 || n > int64(1<<62)/int64(unit) {
+				w.error("ERR invalid expire time in 'set' command")
+				return
+			}
+			ttl, hasTTL = time.Duration(n)*unit, true
+		default:
+			w.error(errSyntax)
+			return
+		}
+	}
+	stored := true
+	switch {
+	case nx && xx:
+		w.error(errSyntax)
+		return
+	case nx:
+		stored = s.gc.SetWithExpireIfNotExists(key, val, ttl)
+	case xx:
+		stored = s.gc.SetWithExpireIfExists(key, val, ttl)
+	default:
+		s.gc.SetWithExpire(key, val, ttl)
+	}
+	if !stored {
+		w.null()
+		return
+	}
+	w.simple("OK")
+}
+
+func (s *Server) del(w *writer, args [][]byte) {
+	var n int64
+	for _, key := range args {
+		if _, ok := s.gc.Delete(string(key)); ok {
+			n++
+		}
+	}
+	w.integer(n)
+}
+
+func (s *Server) exists(w *writer, args [][]byte) {
+	var n int64
+	for _, key := range args {
+		if _, ok := s.gc.Get(string(key)); ok {
+			n++
+		}
+	}
+	w.integer(n)
+}
+
+func (s *Server) expire(w *writer, args [][]byte) {
+	key := string(args[0])
+	sec, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		w.error(errNotInteger)
+		return
+	}
+	if sec <= 0 {
+		// Like Redis, a non-positive timeout deletes the key.
+		_, ok := s.gc.Delete(key)
+		w.boolean(ok)
+		return
+	}
+	if sec > int64(1<<62)/int64(time.Second) {
+		w.error("ERR invalid expire time in 'expire' command")
+		return
+	}
+	_, ok := s.gc.GetRefreshWithDur(key, time.Duration(sec)*time.Second)
+	w.boolean(ok)
+}
+
+func (s *Server) ttl(w *writer, args [][]byte) {
+	_, expire, ok := s.gc.GetWithExpire(string(args[0]))
+	switch {
+	case !ok:
+		w.integer(-2)
+	case expire <= 0:
+		w.integer(-1)
+	default:
+		w.integer((time.Until(time.Unix(0, expire)).Milliseconds() + 500) / 1000)
+	}
+}
+
+func (s *Server) persist(w *writer, args [][]byte) {
+	key := string(args[0])
+	for {
+		v, version, ok := s.gc.GetVersioned(key)
+		if !ok {
+			w.integer(0)
+			return
+		}
+		if _, expire, ok := s.gc.GetWithExpire(key); !ok || expire <= 0 {
+			w.integer(0)
+			return
+		}
+		if s.gc.SetWithExpireIfVersion(key, v, gache.NoTTL, version) {
+			w.integer(1)
+			return
+		}
+	}
+}
+
+func incrBy(sign int64) func(*Server, *writer, [][]byte) {
+	return func(s *Server, w *writer, args [][]byte) {
+		s.incr(w, string(args[0]), sign)
+	}
+}
+
+func incrByArg(sign int64) func(*Server, *writer, [][]byte) {
+	return func(s *Server, w *writer, args [][]byte) {
+		n, err := strconv.ParseInt(string(args[1]), 10, 64)
+		if err != nil || (sign < 0 && n == -1<<63) {
+			w.error(errNotInteger)
+			return
+		}
+		s.incr(w, string(args[0]), sign*n)
+	}
+}
+
+func (s *Server) incr(w *writer, key string, delta int64) {
+	var (
+		result int64
+		errMsg string
+	)
+	s.gc.ComputeWithExpire(key, func(old []byte, exists bool) ([]byte, gache.Op) {
+		var cur int64
+		if exists {
+			n, err := strconv.ParseInt(string(old), 10, 64)
+			if err != nil {
+				errMsg = errNotInteger
+				return old, gache.OpKeep
+			}
+			cur = n
+		}
+		if (delta > 0 && cur > (1<<63-1)-delta) || (delta < 0 && cur < -1<<63-delta) {
+			errMsg = "ERR increment or decrement would overflow"
+			return old, gache.OpKeep
+		}
+		errMsg = ""
+		result = cur + delta
+		return strconv.AppendInt(nil, result, 10), gache.OpReplace
+	}, gache.NoTTL)
+	if errMsg != "" {
+		w.error(errMsg)
+		return
+	}
+	w.integer(result)
+}
+
+func (s *Server) mget(w *writer, args [][]byte) {
+	keys := make([]string, len(args))
+	for i, key := range args {
+		keys[i] = string(key)
+	}
+	found, _ := s.gc.GetMulti(keys...)
+	w.array(len(keys))
+	for _, key := range keys {
+		if v, ok := found[key]; ok {
+			w.bulk(v)
+		} else {
+			w.null()
+		}
+	}
+}
+
+func (s *Server) mset(w *writer, args [][]byte) {
+	entries := make([]gache.Entry[[]byte], 0, len(args)/2)
+	for i := 0; i < len(args); i += 2 {
+		entries = append(entries, gache.Entry[[]byte]{Key: string(args[i]), Value: args[i+1], Expire: gache.NoTTL})
+	}
+	s.gc.SetMultiWithExpire(entries...)
+	w.simple("OK")
+}
+
+func (s *Server) scan(w *writer, args [][]byte) {
+	cursor, err := strconv.ParseUint(string(args[0]), 10, 64)
+	if err != nil {
+		w.error("ERR invalid cursor")
+		return
+	}
+	var (
+		match string
+		count int
+		none  bool
+	)
+	for i := 1; i < len(args); i += 2 {
+		if i+1 == len(args) {
+			w.error(errSyntax)
+			return
+		}
+		switch strings.ToUpper(string(args[i])) {
+		case "MATCH":
+			match = string(args[i+1])
+		case "COUNT":
+			if count, err = strconv.Atoi(string(args[i+1])); err != nil || count < 1 {
+				w.error(errNotInteger)
+				return
+			}
+		case "TYPE":
+			// Every key holds a string, so no key has another type.
+			none = !strings.EqualFold(string(args[i+1]), "string")
+		default:
+			w.error(errSyntax)
+			return
+		}
+	}
+	if match == "*" {
+		match = ""
+	}
+	var (
+		keys []string
+		next uint64
+	)
+	if !none {
+		keys, next = s.gc.Scan(cursor, count, match)
+	}
+	w.array(2)
+	w.bulk(strconv.AppendUint(nil, next, 10))
+	w.array(len(keys))
+	for _, key := range keys {
+		w.bulkString(key)
+	}
+}
+
+func (s *Server) keys(w *writer, args [][]byte) {
+	match := string(args[0])
+	if match == "*" {
+		match = ""
+	}
+	var (
+		keys   []string
+		cursor uint64
+	)
+	for {
+		var batch []string
+		batch, cursor = s.gc.Scan(cursor, 1024, match)
+		keys = append(keys, batch...)
+		if cursor == 0 {
+			break
+		}
+	}
+	w.array(len(keys))
+	for _, key := range keys {
+		w.bulkString(key)
+	}
+}
+
+func (s *Server) flushall(w *writer, args [][]byte) {
+	if len(args) == 1 {
+		if mode := strings.ToUpper(string(args[0])); mode != "SYNC" && mode != "ASYNC" {
+			w.error(errSyntax)
+			return
+		}
+	}
+	s.gc.Clear()
+	w.simple("OK")
+}
+
+func (s *Server) dbsize(w *writer, _ [][]byte) {
+	w.integer(int64(s.gc.Len()))
+}
+
+func (s *Server) info(w *writer, _ [][]byte) {
+	var b strings.Builder
+	b.WriteString("# Server\r\n")
+	b.WriteString("redis_version:7.0.0\r\n")
+	b.WriteString("redis_mode:standalone\r\n")
+	b.WriteString("gache_server:resp\r\n")
+	b.WriteString("uptime_in_seconds:" + strconv.FormatInt(int64(time.Since(s.start).Seconds()), 10) + "\r\n")
+	b.WriteString("\r\n# Clients\r\n")
+	b.WriteString("connected_clients:" + strconv.FormatInt(s.clients.Load(), 10) + "\r\n")
+	b.WriteString("\r\n# Memory\r\n")
+	b.WriteString("used_memory:" + strconv.FormatUint(uint64(s.gc.Size()), 10) + "\r\n")
+	b.WriteString("\r\n# Stats\r\n")
+	b.WriteString("total_commands_processed:" + strconv.FormatUint(s.commands.Load(), 10) + "\r\n")
+	b.WriteString("\r\n# Keyspace\r\n")
+	if n := s.gc.Len(); n > 0 {
+		b.WriteString("db0:keys=" + strconv.Itoa(n) + ",expires=0,avg_ttl=0\r\n")
+	}
+	w.bulkString(b.String())
+}
@@ -0,0 +1,326 @@
+package resp
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"reflect"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kpango/gache/v2"
+)
+
+// client is a minimal RESP2 client for the tests.
+type client struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+type respError string
+
+func newTestServer(t *testing.T) (gache.Gache[[]byte], *client) {
+	t.Helper()
+	gc := gache.New[[]byte]()
+	srv := New(gc)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- srv.Serve(l) }()
+	t.Cleanup(func() {
+		srv.Close()
+		if err := <-done; !errors.Is(err, ErrServerClosed) {
+			t.Errorf("expected ErrServerClosed, got %v", err)
+		}
+	})
+	return gc, dial(t, l.Addr().String())
+}
+
+func dial(t *testing.T, addr string) *client {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	return &client{t: t, conn: conn, r: bufio.NewReader(conn)}
+}
+
+func (c *client) send(args ...string) {
+	c.t.Helper()
+	b := []byte("*" + strconv.Itoa(len(args)) + "\r\n")
+	for _, a := range args {
+		b = fmt.Appendf(b, "$%d\r\n%s\r\n", len(a), a)
+	}
+	if _, err := c.conn.Write(b); err != nil {
+		c.t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+// do sends a command and returns its reply: a string for simple strings, a
+// respError, an int64, a string or nil for bulk strings, or a []any.
+func (c *client) do(args ...string) any {
+	c.t.Helper()
+	c.send(args...)
+	return c.read()
+}
+
+func (c *client) read() any {
+	c.t.Helper()
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		c.t.Fatalf("unexpected error: %v", err)
+	}
+	line = line[:len(line)-2]
+	switch line[0] {
+	case '+':
+		return line[1:]
+	case '-':
+		return respError(line[1:])
+	case ':':
+		n, _ := strconv.ParseInt(line[1:], 10, 64)
+		return n
+	case '$':
+		n, _ := strconv.Atoi(line[1:])
+		if n < 0 {
+			return nil
+		}
+		b := make([]byte, n+2)
+		if _, err := io.ReadFull(c.r, b); err != nil {
+			c.t.Fatalf("unexpected error: %v", err)
+		}
+		return string(b[:n])
+	case '*':
+		n, _ := strconv.Atoi(line[1:])
+		arr := make([]any, n)
+		for i := range arr {
+			arr[i] = c.read()
+		}
+		return arr
+	}
+	c.t.Fatalf("unexpected reply %q", line)
+	return nil
+}
+
+func expect(t *testing.T, got, want any) {
+	t.Helper()
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %#v, got %#v", want, got)
+	}
+}
+
+// TestServer_GetSet verifies GET, SET with its options, DEL and EXISTS.
+func TestServer_GetSet(t *testing.T) {
+	t.Helper()
+	gc, c := newTestServer(t)
+
+	expect(t, c.do("GET", "k"), nil)
+	expect(t, c.do("SET", "k", "v1"), "OK")
+	expect(t, c.do("GET", "k"), "v1")
+	if _, expire, _ := gc.GetWithExpire("k"); expire > 0 {
+		t.Errorf("expected SET without EX to store without expiration, got %d", expire)
+	}
+
+	expect(t, c.do("SET", "k", "v2", "NX"), nil)
+	expect(t, c.do("SET", "n", "v", "nx"), "OK")
+	expect(t, c.do("SET", "missing", "v", "XX"), nil)
+	expect(t, c.do("SET", "k", "v2", "XX"), "OK")
+	expect(t, c.do("GET", "k"), "v2")
+	expect(t, c.do("SET", "k", "v", "NX", "XX"), respError("ERR syntax error"))
+	expect(t, c.do("SET", "k", "v", "EX", "zero"), respError(errNotInteger))
+	expect(t, c.do("SET", "k", "v", "EX", "0"), respError("ERR invalid expire time in 'set' command"))
+	expect(t, c.do("SET", "k"), respError("ERR wrong number of arguments for 'set' command"))
+
+	expect(t, c.do("EXISTS", "k", "n", "k", "missing"), int64(3))
+	expect(t, c.do("DEL", "k", "n", "missing"), int64(2))
+	expect(t, c.do("EXISTS", "k"), int64(0))
+	expect(t, c.do("NOPE"), respError("ERR unknown command 'NOPE'"))
+}
+
+// TestServer_Expire verifies SET EX/PX, EXPIRE, TTL and PERSIST.
+func TestServer_Expire(t *testing.T) {
+	t.Helper()
+	_, c := newTestServer(t)
+
+	expect(t, c.do("TTL", "k"), int64(-2))
+	c.do("SET", "k", "v")
+	expect(t, c.do("TTL", "k"), int64(-1))
+	expect(t, c.do("EXPIRE", "k", "100"), int64(1))
+	expect(t, c.do("TTL", "k"), int64(100))
+	expect(t, c.do("EXPIRE", "missing", "100"), int64(0))
+	expect(t, c.do("PERSIST", "k"), int64(1))
+	expect(t, c.do("PERSIST", "k"), int64(0))
+	expect(t, c.do("TTL", "k"), int64(-1))
+	expect(t, c.do("GET", "k"), "v")
+
+	expect(t, c.do("SET", "e", "v", "EX", "60"), "OK")
+	expect(t, c.do("TTL", "e"), int64(60))
+	expect(t, c.do("SET", "p", "v", "PX", "50"), "OK")
+	time.Sleep(150 * time.Millisecond)
+	expect(t, c.do("GET", "p"), nil)
+	expect(t, c.do("TTL", "p"), int64(-2))
+
+	expect(t, c.do("EXPIRE", "k", "0"), int64(1))
+	expect(t, c.do("EXISTS", "k"), int64(0))
+}
+
+// TestServer_Incr verifies INCR, DECR, INCRBY and DECRBY, including errors.
+func TestServer_Incr(t *testing.T) {
+	t.Helper()
+	_, c := newTestServer(t)
+
+	expect(t, c.do("INCR", "n"), int64(1))
+	expect(t, c.do("INCR", "n"), int64(2))
+	expect(t, c.do("INCRBY", "n", "10"), int64(12))
+	expect(t, c.do("DECR", "n"), int64(11))
+	expect(t, c.do("DECRBY", "n", "20"), int64(-9))
+	expect(t, c.do("GET", "n"), "-9")
+
+	c.do("SET", "s", "abc")
+	expect(t, c.do("INCR", "s"), respError(errNotInteger))
+	expect(t, c.do("GET", "s"), "abc")
+	c.do("SET", "max", strconv.FormatInt(1<<63-1, 10))
+	expect(t, c.do("INCR", "max"), respError("ERR increment or decrement would overflow"))
+
+	c.do("SET", "ttl", "1", "EX", "100")
+	c.do("INCR", "ttl")
+	expect(t, c.do("TTL", "ttl"), int64(100))
+}
+
+// TestServer_Multi verifies MGET and MSET.
+func TestServer_Multi(t *testing.T) {
+	t.Helper()
+	_, c := newTestServer(t)
+
+	expect(t, c.do("MSET", "a", "1", "b", "2"), "OK")
+	expect(t, c.do("MGET", "a", "missing", "b"), []any{"1", nil, "2"})
+	expect(t, c.do("MSET", "a", "1", "b"), respError("ERR wrong number of arguments for 'mset' command"))
+}
+
+// TestServer_Keyspace verifies SCAN, KEYS, DBSIZE, FLUSHALL and INFO.
+func TestServer_Keyspace(t *testing.T) {
+	t.Helper()
+	_, c := newTestServer(t)
+
+	for i := range 50 {
+		c.do("SET", "user:"+strconv.Itoa(i), "v")
+	}
+	c.do("SET", "other", "v")
+	expect(t, c.do("DBSIZE"), int64(51))
+
+	keys := c.do("KEYS", "user:*").([]any)
+	if len(keys) != 50 {
+		t.Fatalf("expected 50 keys, got %d", len(keys))
+	}
+	expect(t, len(c.do("KEYS", "*").([]any)), 51)
+
+	var scanned []string
+	cursor := "0"
+	for {
+		res := c.do("SCAN", cursor, "MATCH", "user:*", "COUNT", "5").([]any)
+		for _, k := range res[1].([]any) {
+			scanned = append(scanned, k.(string))
+		}
+		if cursor = res[0].(string); cursor == "0" {
+			break
+		}
+	}
+	slices.Sort(scanned)
+	if len(slices.Compact(scanned)) != 50 {
+		t.Fatalf("expected 50 distinct keys, got %d", len(scanned))
+	}
+	expect(t, c.do("SCAN", "0", "TYPE", "hash"), []any{"0", []any{}})
+	expect(t, c.do("SCAN", "x"), respError("ERR invalid cursor"))
+
+	info := c.do("INFO").(string)
+	for _, want := range []string{"redis_version:", "connected_clients:1", "db0:keys=51"} {
+		if !strings.Contains(info, want) {
+			t.Errorf("expected INFO to contain %q, got %q", want, info)
+		}
+	}
+
+	expect(t, c.do("FLUSHALL"), "OK")
+	expect(t, c.do("DBSIZE"), int64(0))
+}
+
+// TestServer_Protocol verifies inline commands, pipelining, the connection
+// commands and protocol errors.
+func TestServer_Protocol(t *testing.T) {
+	t.Helper()
+	_, c := newTestServer(t)
+
+	if _, err := c.conn.Write([]byte("PING\r\nSET a hello\r\nGET a\r\n")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expect(t, c.read(), "PONG")
+	expect(t, c.read(), "OK")
+	expect(t, c.read(), "hello")
+
+	c.send("SET", "bin", "a\r\nb")
+	c.send("GET", "bin")
+	c.send("ECHO", "hi")
+	expect(t, c.read(), "OK")
+	expect(t, c.read(), "a\r\nb")
+	expect(t, c.read(), "hi")
+
+	expect(t, c.do("SELECT", "0"), "OK")
+	expect(t, c.do("SELECT", "1"), respError("ERR DB index is out of range"))
+	expect(t, c.do("QUIT"), "OK")
+	if _, err := c.r.ReadByte(); err != io.EOF {
+		t.Fatalf("expected the connection to be closed, got %v", err)
+	}
+
+	c = dial(t, c.conn.RemoteAddr().String())
+	if _, err := c.conn.Write([]byte("*1\r\n+PING\r\n")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expect(t, c.read(), respError("ERR Protocol error: expected '$', got '+'"))
+}
+
+// TestReadCommand_Bounded verifies that the counts announced by a command's
+// headers do not reserve memory before the data arrives, and that arguments
+// larger than the initial buffer are still read whole.
+func TestReadCommand_Bounded(t *testing.T) {
+	t.Helper()
+	big := strings.Repeat("x", 3*bulkPrealloc+5)
+	args, err := readCommand(bufio.NewReader(strings.NewReader(
+		"*2\r\n$3\r\nSET\r\n$" + strconv.Itoa(len(big)) + "\r\n" + big + "\r\n")))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(args) != 2 || string(args[0]) != "SET" || string(args[1]) != big {
+		t.Fatalf("unexpected args of lengths %d", len(args))
+	}
+
+	tests := []struct {
+		name string
+		in   string
+	}{
+		{name: "args", in: "*" + strconv.Itoa(maxArgs) + "\r\n$1\r\na\r\n"},
+		{name: "bulk", in: "*1\r\n$" + strconv.Itoa(maxBulk) + "\r\nabc"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var before, after runtime.MemStats
+			runtime.ReadMemStats(&before)
+			if _, err := readCommand(bufio.NewReader(strings.NewReader(tt.in))); !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+				t.Fatalf("expected EOF, got %v", err)
+			}
+			runtime.ReadMemStats(&after)
+			allocs := after.TotalAlloc - before.TotalAlloc
+			if allocs > 1<<20 {
+				t.Fatalf("reading a truncated command allocated %d bytes", allocs)
+			}
+		})
+	}
+}
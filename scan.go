@@ -0,0 +1,152 @@
+package gache
+
+import (
+	"strings"
+	"sync/atomic"
+
+	"github.com/kpango/fastime"
+)
+
+// defaultScanCount is the number of keys Scan aims to return per call when
+// count is not positive, matching Redis' SCAN default.
+const defaultScanCount = 10
+
+// Scan incrementally iterates over the keys of non-expired entries, like the
+// Redis SCAN command. Start with cursor 0 and pass the returned next cursor
+// to the following call until it returns 0. Each call walks whole shards
+// until at least count keys have been collected, so the number of returned
+// keys is a hint rather than an exact bound; a count <= 0 defaults to 10.
+// A non-empty match restricts the result to keys matching the glob pattern,
+// which supports '*', '?', character classes such as "[a-c]" and '\' escapes.
+//
+// A key that exists for the whole iteration is returned exactly once; keys
+// added or removed during the iteration may or may not be returned.
+//
+// Example:
+//
+//	var cursor uint64
+//	for {
+//	    var keys []string
+//	    keys, cursor = gc.Scan(cursor, 1000, "user:*")
+//	    process(keys)
+//	    if cursor == 0 {
+//	        break
+//	    }
+//	}
+func (g *gache[V]) Scan(cursor uint64, count int, match string) (keys []string, next uint64) {
+	if count <= 0 {
+		count = defaultScanCount
+	}
+	now := fastime.UnixNanoNow()
+	for id := cursor; id < slen; id++ {
+		for k, e := range g.shards[id].readMap() {
+			v, ok := e.loadPointer()
+			if !ok {
+				continue
+			}
+			v.mu.RLock()
+			valid := v.key == k
+			expire := atomic.LoadInt64(&v.expire)
+			v.mu.RUnlock()
+			if !valid || (expire > 0 && now > expire) {
+				continue
+			}
+			if match == "" || globMatch(match, k) {
+				keys = append(keys, k)
+			}
+		}
+		if len(keys) >= count {
+			if id+1 < slen {
+				return keys, id + 1
+			}
+			return keys, 0
+		}
+	}
+	return keys, 0
+}
+
+// globMatch reports whether s matches the Redis-style glob pattern.
+func globMatch(pattern, s string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for len(pattern) > 1 && pattern[1] == '*' {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 1 {
+				return true
+			}
+			for i := range len(s) + 1 {
+				if globMatch(pattern[1:], s[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(s) == 0 {
+				return false
+			}
+			s = s[1:]
+			pattern = pattern[1:]
+		case '[':
+			if len(s) == 0 {
+				return false
+			}
+			end := 1
+			negate := end < len(pattern) && pattern[end] == '^'
+			if negate {
+				end++
+			}
+			matched := false
+			for ; end < len(pattern) && pattern[end] != ']'; end++ {
+				switch {
+				case pattern[end] == '\\' && end+1 < len(pattern):
+					end++
+					matched = matched || pattern[end] == s[0]
+				case end+2 < len(pattern) && pattern[end+1] == '-' && pattern[end+2] != ']':
+					lo, hi := pattern[end], pattern[end+2]
+					if lo > hi {
+						lo, hi = hi, lo
+					}
+					matched = matched || (lo <= s[0] && s[0] <= hi)
+					end += 2
+				default:
+					matched = matched || pattern[end] == s[0]
+				}
+			}
+			if matched == negate {
+				return false
+			}
+			if end < len(pattern) {
+				end++
+			}
+			s = s[1:]
+			pattern = pattern[end:]
+		case '\\':
+			if len(pattern) > 1 {
+				pattern = pattern[1:]
+			}
+			fallthrough
+		default:
+			if len(s) == 0 || s[0] != pattern[0] {
+				return false
+			}
+			s = s[1:]
+			pattern = pattern[1:]
+		}
+	}
+	return len(s) == 0
+}
+
+// globQuote escapes the glob metacharacters of s so that it matches itself.
+func globQuote(s string) string {
+	var b strings.Builder
+	for i := range len(s) {
+		switch s[i] {
+		case '*', '?', '[', ']', '\\':
+			b.WriteByte('\\')
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
@@ -0,0 +1,74 @@
+package gache
+
+import (
+	"fmt"
+	"testing"
+)
+
+// TestGache_Scan verifies that a full cursor iteration returns every live key exactly once and honours the match pattern.
+func TestGache_Scan(t *testing.T) {
+	t.Helper()
+	gc := New[int]()
+	for i := range 10000 {
+		gc.Set(fmt.Sprintf("user:%d", i), i)
+		gc.Set(fmt.Sprintf("group:%d", i), i)
+	}
+
+	seen := make(map[string]int)
+	var (
+		cursor uint64
+		calls  int
+	)
+	for {
+		var keys []string
+		keys, cursor = gc.Scan(cursor, 100, "user:*")
+		calls++
+		for _, k := range keys {
+			seen[k]++
+		}
+		if cursor == 0 {
+			break
+		}
+	}
+	if len(seen) != 10000 {
+		t.Fatalf("expected 10000 distinct keys, got %d", len(seen))
+	}
+	for k, n := range seen {
+		if n != 1 {
+			t.Errorf("expected %s once, got %d", k, n)
+		}
+	}
+	if calls < 2 {
+		t.Errorf("expected the scan to be split across calls, got %d", calls)
+	}
+}
+
+// TestGache_GlobMatch verifies the Redis-style glob patterns accepted by Scan.
+func TestGache_GlobMatch(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		pattern, s string
+		want       bool
+	}{
+		{"*", "anything", true},
+		{"user:*", "user:42", true},
+		{"user:*", "group:42", false},
+		{"/products/*", "/products/1/reviews", true},
+		{"h?llo", "hello", true},
+		{"h?llo", "hllo", false},
+		{"h[ae]llo", "hallo", true},
+		{"h[^e]llo", "hello", false},
+		{"h[a-c]llo", "hbllo", true},
+		{"h[a-c]llo", "hdllo", false},
+		{`a\*b`, "a*b", true},
+		{`a\*b`, "axb", false},
+		{"*:*:end", "a:b:end", true},
+		{"", "", true},
+		{"", "x", false},
+	}
+	for _, tt := range tests {
+		if got := globMatch(tt.pattern, tt.s); got != tt.want {
+			t.Errorf("globMatch(%q, %q) = %t, want %t", tt.pattern, tt.s, got, tt.want)
+		}
+	}
+}
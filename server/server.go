@@ -0,0 +1,236 @@
+// Package server exposes a gache cache over HTTP with JSON encoded values, so
+// that programs written in other languages can share a warm cache.
+//
+// Endpoints:
+//
+//	GET    /keys/{key}   value of key as JSON; 404 if missing
+//	PUT    /keys/{key}   store the JSON request body under key
+//	DELETE /keys/{key}   remove key; 404 if missing
+//	GET    /keys         sorted keys, filtered by ?prefix= and capped by ?limit=
+//	GET    /stats        number of entries and approximate size in bytes
+//	GET    /snapshot     download the cache as written by Gache.Write
+//	PUT    /snapshot     load a snapshot with Gache.Read
+//	GET    /healthz      liveness check
+//
+// The TTL of an entry is sent and received in the X-Gache-TTL header as a
+// non-zero number of seconds; a negative value means the entry never
+// expires. PUT without the header uses the cache's default expiration. GET
+// responses also carry the absolute expiration in X-Gache-Expire as an
+// RFC 3339 timestamp.
+//
+// GET /keys walks the keys in order with [gache.Gache.ScanRange]. Without
+// [gache.WithOrderedKeys] that lists and sorts every key of the cache on
+// each request, whatever the prefix and limit; serve caches with many keys
+// with the ordered index enabled, which stops after limit keys.
+//
+// Example:
+//
+//	gc := gache.New[json.RawMessage]().StartExpired(ctx, time.Minute)
+//	log.Fatal(http.ListenAndServe(":8080", server.New(gc)))
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/kpango/gache/v2"
+)
+
+const (
+	// TTLHeader carries the time to live of an entry in seconds.
+	TTLHeader = "X-Gache-TTL"
+	// ExpireHeader carries the absolute expiration of an entry.
+	ExpireHeader = "X-Gache-Expire"
+
+	// maxValueSize bounds the request body of PUT /keys/{key}.
+	maxValueSize = 32 << 20
+	// DefaultMaxSnapshotSize bounds the request body of PUT /snapshot unless
+	// changed with [WithMaxSnapshotSize].
+	DefaultMaxSnapshotSize = 1 << 30
+)
+
+var errInvalidTTL = errors.New("invalid " + TTLHeader + " header")
+
+type (
+	// Option configures a [Server].
+	Option[V any] func(*Server[V])
+
+	// Server is an [http.Handler] serving a [gache.Gache].
+	Server[V any] struct {
+		gc          gache.Gache[V]
+		mux         *http.ServeMux
+		maxSnapshot int64
+	}
+)
+
+// WithMaxSnapshotSize sets the largest snapshot, in bytes, accepted by PUT
+// /snapshot; larger uploads are rejected with 413 Request Entity Too Large.
+// The default is [DefaultMaxSnapshotSize].
+func WithMaxSnapshotSize[V any](n int64) Option[V] {
+	return func(s *Server[V]) {
+		if n > 0 {
+			s.maxSnapshot = n
+		}
+	}
+}
+
+// New returns a Server for gc.
+func New[V any](gc gache.Gache[V], opts ...Option[V]) *Server[V] {
+	s := &Server[V]{gc: gc, mux: http.NewServeMux(), maxSnapshot: DefaultMaxSnapshotSize}
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.mux.HandleFunc("GET /keys/{key...}", s.get)
+	s.mux.HandleFunc("PUT /keys/{key...}", s.put)
+	s.mux.HandleFunc("DELETE /keys/{key...}", s.delete)
+	s.mux.HandleFunc("GET /keys", s.keys)
+	s.mux.HandleFunc("GET /stats", s.stats)
+	s.mux.HandleFunc("GET /snapshot", s.snapshot)
+	s.mux.HandleFunc("PUT /snapshot", s.restore)
+	s.mux.HandleFunc("GET /healthz", s.health)
+	return s
+}
+
+// ServeHTTP implements [http.Handler].
+func (s *Server[V]) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+func (s *Server[V]) get(w http.ResponseWriter, r *http.Request) {
+	v, expire, ok := s.gc.GetWithExpire(r.PathValue("key"))
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	if expire > 0 {
+		ttl := time.Until(time.Unix(0, expire))
+		w.Header().Set(TTLHeader, strconv.FormatFloat(max(ttl.Seconds(), 0), 'f', -1, 64))
+		w.Header().Set(ExpireHeader, time.Unix(0, expire).UTC().Format(time.RFC3339Nano))
+	} else {
+		w.Header().Set(TTLHeader, "-1")
+	}
+	writeJSON(w, http.StatusOK, v)
+}
+
+func (s *Server[V]) put(w http.ResponseWriter, r *http.Request) {
+	ttl, hasTTL, err := parseTTL(r.Header.Get(TTLHeader))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var v V
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxValueSize)).Decode(&v); err != nil {
+		http.Error(w, "invalid JSON value: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if key := r.PathValue("key"); hasTTL {
+		s.gc.SetWithExpire(key, v, ttl)
+	} else {
+		s.gc.Set(key, v)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server[V]) delete(w http.ResponseWriter, r *http.Request) {
+	if _, ok := s.gc.Delete(r.PathValue("key")); !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server[V]) keys(w http.ResponseWriter, r *http.Request) {
+	limit := 0
+	if l := r.URL.Query().Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n < 0 {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+	prefix := r.URL.Query().Get("prefix")
+	keys := s.gc.ScanRange(r.Context(), prefix, prefixEnd(prefix), limit)
+	if keys == nil {
+		keys = []string{}
+	}
+	writeJSON(w, http.StatusOK, keys)
+}
+
+// Stats is the body of GET /stats.
+type Stats struct {
+	Len  int     `json:"len"`
+	Size uintptr `json:"size"`
+}
+
+func (s *Server[V]) stats(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, Stats{Len: s.gc.Len(), Size: s.gc.Size()})
+}
+
+func (s *Server[V]) snapshot(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", `attachment; filename="gache.snapshot"`)
+	if err := s.gc.Write(r.Context(), w); err != nil {
+		// The status line may already be sent; this is best effort.
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func (s *Server[V]) restore(w http.ResponseWriter, r *http.Request) {
+	if err := s.gc.Read(http.MaxBytesReader(w, r.Body, s.maxSnapshot)); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, "snapshot too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "invalid snapshot: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server[V]) health(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// parseTTL parses a TTL header in seconds. It reports false for an empty
+// header; negative values mean no expiration, while zero and values that
+// round down to less than a nanosecond are rejected.
+func parseTTL(h string) (time.Duration, bool, error) {
+	if h == "" {
+		return 0, false, nil
+	}
+	sec, err := strconv.ParseFloat(h, 64)
+	if err != nil || math.IsNaN(sec) || math.IsInf(sec, 0) || sec > math.MaxInt64/float64(time.Second) {
+		return 0, false, errInvalidTTL
+	}
+	if sec < 0 {
+		return gache.NoTTL, true, nil
+	}
+	d := time.Duration(sec * float64(time.Second))
+	if d <= 0 {
+		return 0, false, errInvalidTTL
+	}
+	return d, true, nil
+}
+
+// prefixEnd returns the smallest key greater than every key starting with
+// prefix, or "" when there is none.
+func prefixEnd(prefix string) string {
+	for i := len(prefix) - 1; i >= 0; i-- {
+		if prefix[i] != 0xff {
+			return prefix[:i] + string([]byte{prefix[i] + 1})
+		}
+	}
+	return ""
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
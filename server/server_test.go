@@ -0,0 +1,240 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kpango/gache/v2"
+)
+
+func newTestServer(t *testing.T) (gache.Gache[json.RawMessage], *httptest.Server) {
+	t.Helper()
+	gc := gache.New[json.RawMessage]()
+	ts := httptest.NewServer(New(gc))
+	t.Cleanup(ts.Close)
+	return gc, ts
+}
+
+func do(t *testing.T, method, url, body string, header http.Header) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	t.Cleanup(func() { res.Body.Close() })
+	return res
+}
+
+func readBody(t *testing.T, res *http.Response) string {
+	t.Helper()
+	b, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return strings.TrimSpace(string(b))
+}
+
+// TestServer_Keys verifies the PUT, GET and DELETE round trip of a key, including TTL headers.
+func TestServer_Keys(t *testing.T) {
+	t.Helper()
+	_, ts := newTestServer(t)
+
+	res := do(t, http.MethodPut, ts.URL+"/keys/user/1", `{"name":"alice"}`, http.Header{TTLHeader: {"60"}})
+	if res.StatusCode != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", res.StatusCode)
+	}
+	res = do(t, http.MethodGet, ts.URL+"/keys/user/1", "", nil)
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", res.StatusCode)
+	}
+	if body := readBody(t, res); body != `{"name":"alice"}` {
+		t.Errorf("unexpected body %s", body)
+	}
+	ttl, err := strconv.ParseFloat(res.Header.Get(TTLHeader), 64)
+	if err != nil || ttl <= 50 || ttl > 60 {
+		t.Errorf("expected a TTL of about 60 seconds, got %q", res.Header.Get(TTLHeader))
+	}
+	if _, err := time.Parse(time.RFC3339Nano, res.Header.Get(ExpireHeader)); err != nil {
+		t.Errorf("expected an RFC 3339 expiration, got %q", res.Header.Get(ExpireHeader))
+	}
+
+	do(t, http.MethodPut, ts.URL+"/keys/forever", `1`, http.Header{TTLHeader: {"-1"}})
+	if res := do(t, http.MethodGet, ts.URL+"/keys/forever", "", nil); res.Header.Get(TTLHeader) != "-1" {
+		t.Errorf("expected no TTL, got %q", res.Header.Get(TTLHeader))
+	}
+
+	if res := do(t, http.MethodDelete, ts.URL+"/keys/user/1", "", nil); res.StatusCode != http.StatusNoContent {
+		t.Errorf("expected 204, got %d", res.StatusCode)
+	}
+	if res := do(t, http.MethodGet, ts.URL+"/keys/user/1", "", nil); res.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404, got %d", res.StatusCode)
+	}
+	if res := do(t, http.MethodDelete, ts.URL+"/keys/user/1", "", nil); res.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404, got %d", res.StatusCode)
+	}
+}
+
+// TestServer_BadRequests verifies that invalid values and TTL headers are rejected.
+func TestServer_BadRequests(t *testing.T) {
+	t.Helper()
+	_, ts := newTestServer(t)
+	for _, tc := range []struct {
+		body string
+		ttl  string
+	}{
+		{body: `{"unterminated"`},
+		{body: `1`, ttl: "soon"},
+		{body: `1`, ttl: "0"},
+		{body: `1`, ttl: "1e-10"},
+		{body: `1`, ttl: "NaN"},
+	} {
+		h := http.Header{}
+		if tc.ttl != "" {
+			h.Set(TTLHeader, tc.ttl)
+		}
+		if res := do(t, http.MethodPut, ts.URL+"/keys/k", tc.body, h); res.StatusCode != http.StatusBadRequest {
+			t.Errorf("expected 400 for body %q ttl %q, got %d", tc.body, tc.ttl, res.StatusCode)
+		}
+	}
+	if res := do(t, http.MethodGet, ts.URL+"/keys?limit=-1", "", nil); res.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 for a negative limit, got %d", res.StatusCode)
+	}
+}
+
+// TestServer_ListStatsHealth verifies key listing, stats and the health check.
+func TestServer_ListStatsHealth(t *testing.T) {
+	t.Helper()
+	gc, ts := newTestServer(t)
+	for _, k := range []string{"user:2", "user:1", "item:1"} {
+		gc.Set(k, json.RawMessage(`true`))
+	}
+
+	var keys []string
+	if err := json.Unmarshal([]byte(readBody(t, do(t, http.MethodGet, ts.URL+"/keys?prefix=user:", "", nil))), &keys); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Join(keys, ",") != "user:1,user:2" {
+		t.Errorf("unexpected keys %v", keys)
+	}
+	if body := readBody(t, do(t, http.MethodGet, ts.URL+"/keys?limit=1", "", nil)); body != `["item:1"]` {
+		t.Errorf("unexpected limited keys %s", body)
+	}
+	if body := readBody(t, do(t, http.MethodGet, ts.URL+"/keys?prefix=none", "", nil)); body != `[]` {
+		t.Errorf("expected an empty array, got %s", body)
+	}
+
+	var stats Stats
+	if err := json.Unmarshal([]byte(readBody(t, do(t, http.MethodGet, ts.URL+"/stats", "", nil))), &stats); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if stats.Len != 3 || stats.Size == 0 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+
+	if res := do(t, http.MethodGet, ts.URL+"/healthz", "", nil); res.StatusCode != http.StatusOK {
+		t.Errorf("expected 200, got %d", res.StatusCode)
+	}
+}
+
+// TestServer_Snapshot verifies that a downloaded snapshot can be uploaded to another server.
+func TestServer_Snapshot(t *testing.T) {
+	t.Helper()
+	src, ts := newTestServer(t)
+	src.Set("a", json.RawMessage(`"alpha"`))
+	src.Set("b", json.RawMessage(`2`))
+
+	res := do(t, http.MethodGet, ts.URL+"/snapshot", "", nil)
+	snap, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	dst, ts2 := newTestServer(t)
+	if res := do(t, http.MethodPut, ts2.URL+"/snapshot", string(snap), nil); res.StatusCode != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", res.StatusCode)
+	}
+	m := dst.ToRawMap(context.Background())
+	if len(m) != 2 || !bytes.Equal(m["a"], []byte(`"alpha"`)) || !bytes.Equal(m["b"], []byte(`2`)) {
+		t.Errorf("unexpected restored entries %v", m)
+	}
+	if res := do(t, http.MethodPut, ts2.URL+"/snapshot", "garbage", nil); res.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 for an invalid snapshot, got %d", res.StatusCode)
+	}
+
+	ts3 := httptest.NewServer(New(gache.New[json.RawMessage](), WithMaxSnapshotSize[json.RawMessage](int64(len(snap)-1))))
+	t.Cleanup(ts3.Close)
+	if res := do(t, http.MethodPut, ts3.URL+"/snapshot", string(snap), nil); res.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected 413 for a snapshot over the limit, got %d", res.StatusCode)
+	}
+}
+
+// TestServer_KeysOrdered verifies that key listing honours prefix and limit
+// together when the cache keeps an ordered index.
+func TestServer_KeysOrdered(t *testing.T) {
+	t.Helper()
+	gc := gache.New[json.RawMessage](gache.WithOrderedKeys[json.RawMessage]())
+	ts := httptest.NewServer(New(gc))
+	t.Cleanup(ts.Close)
+	for _, k := range []string{"user:3", "user:1", "user:2", "users", "item:1"} {
+		gc.Set(k, json.RawMessage(`true`))
+	}
+
+	tests := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{name: "prefix and limit", query: "?prefix=user:&limit=2", want: "user:1,user:2"},
+		{name: "prefix", query: "?prefix=user", want: "user:1,user:2,user:3,users"},
+		{name: "limit", query: "?limit=1", want: "item:1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var keys []string
+			if err := json.Unmarshal([]byte(readBody(t, do(t, http.MethodGet, ts.URL+"/keys"+tt.query, "", nil))), &keys); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := strings.Join(keys, ","); got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+// TestPrefixEnd verifies the upper bound of the keys sharing a prefix.
+func TestPrefixEnd(t *testing.T) {
+	t.Helper()
+	tests := []struct {
+		name   string
+		prefix string
+		want   string
+	}{
+		{name: "empty", prefix: "", want: ""},
+		{name: "ascii", prefix: "user:", want: "user;"},
+		{name: "high byte", prefix: "a\x80", want: "a\x81"},
+		{name: "trailing 0xff", prefix: "a\xff\xff", want: "b"},
+		{name: "all 0xff", prefix: "\xff\xff", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := prefixEnd(tt.prefix); got != tt.want {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,463 @@
+package gache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+type (
+	// Store is a backing data store behind the cache, such as a database.
+	// With [WithStore], writes and deletes made through the cache are
+	// propagated to it and lookups that miss in the cache are loaded from it.
+	// Implementations must be safe for concurrent use.
+	Store[V any] interface {
+		// Load returns the value stored for key and whether it exists.
+		Load(ctx context.Context, key string) (V, bool, error)
+		// LoadMany returns the values of the keys that exist.
+		LoadMany(ctx context.Context, keys []string) (map[string]V, error)
+		// Store writes the value for key.
+		Store(ctx context.Context, key string, val V) error
+		// Delete removes key; removing a missing key is not an error.
+		Delete(ctx context.Context, key string) error
+	}
+
+	// StoreOption configures how [WithStore] propagates writes.
+	StoreOption func(*storeConfig)
+
+	storeConfig struct {
+		// interval and batchSize enable write-behind when interval > 0.
+		interval  time.Duration
+		batchSize int
+		attempts  int
+		backoff   time.Duration
+		onError   func(op, key string, err error)
+	}
+
+	// backing connects a cache to its Store. In write-behind mode mutations
+	// are coalesced per key in pending and applied by a background goroutine.
+	backing[V any] struct {
+		s       Store[V]
+		cfg     storeConfig
+		loads   singleflight.Group
+		mu      sync.Mutex
+		pending map[string]storeOp[V]
+		seq     uint64
+		kick    chan struct{}
+		done    chan struct{}
+		closed  chan struct{}
+		once    sync.Once
+		// order holds a lock per shard that orders the Store writes of its
+		// keys; see lockKey.
+		order [slen]sync.Mutex
+	}
+
+	storeOp[V any] struct {
+		val V
+		del bool
+		// seq orders the mutations queued for write-behind.
+		seq uint64
+	}
+)
+
+const (
+	defaultStoreAttempts = 3
+	defaultStoreBackoff  = 10 * time.Millisecond
+	defaultStoreBatch    = 128
+)
+
+// ErrNilStore is returned by [WithStore] for a nil Store.
+var ErrNilStore = errors.New("gache: store must not be nil")
+
+// WithStore backs the cache with s. Every Set, conditional set, Compute,
+// Txn and SetMulti writes the new value to s, and Delete, Pop, DeleteMulti,
+// CompareAndDelete, DeleteIfVersion, DeleteIf and DeletePrefix delete from
+// it; expiration, eviction, InvalidateTag and Clear only drop the cached
+// copy. Get, GetWithExpire and GetMulti load missing keys from s, with
+// concurrent loads of the same key collapsed into one, and cache them with
+// the default expiration. So do the operations that read a value before
+// writing one, namely Compute and its variants, the counters such as [Incr],
+// SetIfExists, GetVersioned and the reads of a Txn, which therefore act on
+// the stored value rather than on an empty cache. Load errors are reported as
+// misses.
+//
+// Writes are applied synchronously (write-through) unless
+// [WithWriteBehind] is given. The Store receives the mutations of a key in
+// the order they were applied to the cache; to that end a write-through
+// mutation waits for the Store writes of the keys of its shard in progress. Failed writes are retried as configured by
+// [WithStoreRetry] and then reported to the handler set by
+// [WithStoreErrorHandler]. [Gache.Close] flushes pending writes.
+//
+// Example:
+//
+//	gc := gache.New[User](
+//	    gache.WithStore[User](userStore,
+//	        gache.WithWriteBehind(100*time.Millisecond, 500),
+//	        gache.WithStoreErrorHandler(func(op, key string, err error) {
+//	            log.Printf("store %s %s: %v", op, key, err)
+//	        })),
+//	)
+//	defer gc.Close()
+func WithStore[V any](s Store[V], opts ...StoreOption) Option[V] {
+	return func(g *gache[V]) error {
+		if s == nil {
+			return ErrNilStore
+		}
+		b := &backing[V]{
+			s: s,
+			cfg: storeConfig{
+				attempts: defaultStoreAttempts,
+				backoff:  defaultStoreBackoff,
+			},
+		}
+		for _, opt := range opts {
+			opt(&b.cfg)
+		}
+		if g.backing != nil {
+			g.backing.close()
+		}
+		g.backing = b
+		if b.cfg.interval > 0 {
+			b.pending = make(map[string]storeOp[V])
+			b.kick = make(chan struct{}, 1)
+			b.done = make(chan struct{})
+			b.closed = make(chan struct{})
+			go b.run()
+		}
+		return nil
+	}
+}
+
+// WithWriteBehind makes the cache write to its Store asynchronously. Writes
+// are queued, with later writes to a key replacing earlier ones, and applied
+// every interval or as soon as batchSize keys are pending. A batchSize <= 0
+// uses a default of 128.
+func WithWriteBehind(interval time.Duration, batchSize int) StoreOption {
+	return func(c *storeConfig) {
+		c.interval = interval
+		c.batchSize = batchSize
+		if c.batchSize <= 0 {
+			c.batchSize = defaultStoreBatch
+		}
+	}
+}
+
+// WithStoreRetry sets how many times a failed Store write is attempted and
+// the initial delay between attempts, which doubles after each failure. The
+// default is 3 attempts starting at 10ms.
+func WithStoreRetry(attempts int, backoff time.Duration) StoreOption {
+	return func(c *storeConfig) {
+		c.attempts = max(attempts, 1)
+		c.backoff = backoff
+	}
+}
+
+// WithStoreErrorHandler sets the function called with the operation
+// ("store" or "delete"), the key and the error when a Store write still
+// fails after retrying.
+func WithStoreErrorHandler(f func(op, key string, err error)) StoreOption {
+	return func(c *storeConfig) {
+		c.onError = f
+	}
+}
+
+// lockKey takes the lock ordering the Store writes of key if the cache has a
+// Store, and returns it for unlockKey. Every mutation that reaches the Store
+// holds it from its shard operation to its storeSet or storeDelete, so that
+// the Store applies the mutations of a key in the order the shard did.
+// Nothing that calls user code, such as the expired hook or the function of
+// Compute, may run while it is held.
+func (g *gache[V]) lockKey(key string) *sync.Mutex {
+	if g.backing == nil {
+		return nil
+	}
+	mu := &g.backing.order[getShardID(key, g.maxKeyLength)]
+	mu.Lock()
+	return mu
+}
+
+// unlockKey releases the lock returned by lockKey.
+func unlockKey(mu *sync.Mutex) {
+	if mu != nil {
+		mu.Unlock()
+	}
+}
+
+// storeSet propagates a write of key to the backing store, the invalidation
+// bus and the replication log, if any.
+func (g *gache[V]) storeSet(key string, val V) {
+	if g.backing != nil {
+		g.backing.apply(key, storeOp[V]{val: val})
+	}
+	if g.invalidator != nil {
+		g.invalidator.publish(key)
+	}
+	g.replicateKey(key)
+}
+
+// storeDelete propagates a delete of key to the backing store and the
+// invalidation bus, if any. Callers append the delete to the replication log
+// with replicateKey once key is gone from the shard, which may be after
+// storeDelete so that a concurrent miss cannot reload key from the store.
+func (g *gache[V]) storeDelete(key string) {
+	if g.backing != nil {
+		g.backing.apply(key, storeOp[V]{del: true})
+	}
+	if g.invalidator != nil {
+		g.invalidator.publish(key)
+	}
+}
+
+// load reads key from the backing store after a miss in the cache.
+func (g *gache[V]) load(shard *Map[string, value[V]], key string) (v V, expire int64, ok bool) {
+	if g.backing == nil {
+		return v, 0, false
+	}
+	v, ok = g.backing.load(key)
+	if !ok {
+		return v, 0, false
+	}
+	return g.fill(shard, key, v)
+}
+
+// fault brings key into shard from the disk tier or the backing store after
+// a miss in memory, so that read-modify-write operations act on the value Get
+// would return. It reports whether a value was brought in.
+func (g *gache[V]) fault(shard *Map[string, value[V]], key string) bool {
+	if _, _, ok := g.promote(shard, key); ok {
+		return true
+	}
+	_, _, ok := g.load(shard, key)
+	return ok
+}
+
+// fill caches v, loaded from a lower tier for key, with the default
+// expiration, unless a concurrent write stored key first, in which case that
+// value is returned.
+func (g *gache[V]) fill(shard *Map[string, value[V]], key string, v V) (V, int64, bool) {
+	expire := g.absExpire(atomic.LoadInt64(&g.expire))
+	newVal := g.newValue(key, v, expire, 0, 0, nil)
+	if _, loaded := g.loadOrStorePointer(shard, key, newVal); loaded {
+		g.putValue(newVal)
+		return g.lookup(shard, key)
+	}
+	return v, expire, true
+}
+
+func (b *backing[V]) apply(key string, op storeOp[V]) {
+	if b.pending == nil {
+		b.write(key, op)
+		return
+	}
+	b.mu.Lock()
+	b.seq++
+	op.seq = b.seq
+	b.pending[key] = op
+	full := len(b.pending) >= b.cfg.batchSize
+	b.mu.Unlock()
+	if full {
+		select {
+		case b.kick <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// write applies op to the store, retrying with exponential backoff.
+func (b *backing[V]) write(key string, op storeOp[V]) {
+	name := "store"
+	if op.del {
+		name = "delete"
+	}
+	var err error
+	backoff := b.cfg.backoff
+	for attempt := range b.cfg.attempts {
+		if attempt > 0 {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+		if op.del {
+			err = b.s.Delete(context.Background(), key)
+		} else {
+			err = b.s.Store(context.Background(), key, op.val)
+		}
+		if err == nil {
+			return
+		}
+	}
+	if b.cfg.onError != nil {
+		b.cfg.onError(name, key, err)
+	}
+}
+
+// load returns the value of key, preferring a pending write-behind
+// mutation over the store.
+func (b *backing[V]) load(key string) (v V, ok bool) {
+	if op, pending := b.pendingOp(key); pending {
+		return op.val, !op.del
+	}
+	res, err, _ := b.loads.Do(key, func() (any, error) {
+		v, ok, err := b.s.Load(context.Background(), key)
+		return storeOp[V]{val: v, del: !ok}, err
+	})
+	if err != nil {
+		return v, false
+	}
+	op := res.(storeOp[V])
+	return op.val, !op.del
+}
+
+// loadMany is load for several keys.
+func (b *backing[V]) loadMany(keys []string) map[string]V {
+	found := make(map[string]V, len(keys))
+	rest := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if op, pending := b.pendingOp(key); pending {
+			if !op.del {
+				found[key] = op.val
+			}
+			continue
+		}
+		rest = append(rest, key)
+	}
+	if len(rest) == 0 {
+		return found
+	}
+	loaded, err := b.s.LoadMany(context.Background(), rest)
+	if err != nil {
+		return found
+	}
+	for k, v := range loaded {
+		found[k] = v
+	}
+	return found
+}
+
+func (b *backing[V]) pendingOp(key string) (op storeOp[V], ok bool) {
+	if b.pending == nil {
+		return op, false
+	}
+	b.mu.Lock()
+	op, ok = b.pending[key]
+	b.mu.Unlock()
+	return op, ok
+}
+
+// run flushes the write-behind queue every interval, when a batch fills up
+// and a last time when the backing is closed.
+func (b *backing[V]) run() {
+	defer close(b.done)
+	tick := time.NewTicker(b.cfg.interval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-b.closed:
+			b.flush()
+			return
+		case <-tick.C:
+		case <-b.kick:
+		}
+		b.flush()
+	}
+}
+
+// flush applies every pending mutation. A mutation queued for a key while
+// it is being written stays pending for the next flush.
+func (b *backing[V]) flush() {
+	for {
+		b.mu.Lock()
+		if len(b.pending) == 0 {
+			b.mu.Unlock()
+			return
+		}
+		batch := make(map[string]storeOp[V], min(len(b.pending), b.cfg.batchSize))
+		for k, op := range b.pending {
+			batch[k] = op
+			if len(batch) == b.cfg.batchSize {
+				break
+			}
+		}
+		b.mu.Unlock()
+		for k, op := range batch {
+			b.write(k, op)
+		}
+		b.mu.Lock()
+		for k, op := range batch {
+			if cur, ok := b.pending[k]; ok && cur.seq == op.seq {
+				delete(b.pending, k)
+			}
+		}
+		b.mu.Unlock()
+	}
+}
+
+// close flushes the pending writes and stops the write-behind goroutine.
+func (b *backing[V]) close() {
+	if b.closed == nil {
+		return
+	}
+	b.once.Do(func() {
+		close(b.closed)
+		<-b.done
+	})
+}
+
+// MemoryStore is a [Store] that keeps its data in a map. It is meant as a
+// reference implementation and for tests.
+type MemoryStore[V any] struct {
+	mu   sync.RWMutex
+	data map[string]V
+}
+
+// NewMemoryStore returns an empty [MemoryStore].
+func NewMemoryStore[V any]() *MemoryStore[V] {
+	return &MemoryStore[V]{data: make(map[string]V)}
+}
+
+// Load implements [Store].
+func (m *MemoryStore[V]) Load(_ context.Context, key string) (v V, ok bool, err error) {
+	m.mu.RLock()
+	v, ok = m.data[key]
+	m.mu.RUnlock()
+	return v, ok, nil
+}
+
+// LoadMany implements [Store].
+func (m *MemoryStore[V]) LoadMany(_ context.Context, keys []string) (map[string]V, error) {
+	found := make(map[string]V, len(keys))
+	m.mu.RLock()
+	for _, key := range keys {
+		if v, ok := m.data[key]; ok {
+			found[key] = v
+		}
+	}
+	m.mu.RUnlock()
+	return found, nil
+}
+
+// Store implements [Store].
+func (m *MemoryStore[V]) Store(_ context.Context, key string, val V) error {
+	m.mu.Lock()
+	m.data[key] = val
+	m.mu.Unlock()
+	return nil
+}
+
+// Delete implements [Store].
+func (m *MemoryStore[V]) Delete(_ context.Context, key string) error {
+	m.mu.Lock()
+	delete(m.data, key)
+	m.mu.Unlock()
+	return nil
+}
+
+// Len returns the number of keys in the store.
+func (m *MemoryStore[V]) Len() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.data)
+}
@@ -0,0 +1,299 @@
+package gache
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingStore wraps a MemoryStore, counting calls and optionally failing writes.
+type countingStore struct {
+	*MemoryStore[int]
+	loads, loadManys, stores atomic.Int64
+	failures                 atomic.Int64
+	delay                    time.Duration
+}
+
+func (s *countingStore) Load(ctx context.Context, key string) (int, bool, error) {
+	s.loads.Add(1)
+	time.Sleep(s.delay)
+	return s.MemoryStore.Load(ctx, key)
+}
+
+func (s *countingStore) LoadMany(ctx context.Context, keys []string) (map[string]int, error) {
+	s.loadManys.Add(1)
+	return s.MemoryStore.LoadMany(ctx, keys)
+}
+
+func (s *countingStore) Store(ctx context.Context, key string, val int) error {
+	s.stores.Add(1)
+	if s.failures.Add(-1) >= 0 {
+		return errors.New("unavailable")
+	}
+	return s.MemoryStore.Store(ctx, key, val)
+}
+
+func newCountingStore() *countingStore {
+	return &countingStore{MemoryStore: NewMemoryStore[int]()}
+}
+
+// TestGache_StoreWriteThrough verifies that writes and deletes reach the store synchronously and expiration does not.
+func TestGache_StoreWriteThrough(t *testing.T) {
+	t.Helper()
+	ctx := context.Background()
+	s := newCountingStore()
+	gc := New[int](WithStore[int](s))
+	defer gc.Close()
+
+	gc.SetWithExpire("a", 1, 50*time.Millisecond)
+	gc.Compute("b", func(int, bool) (int, Op) { return 2, OpReplace })
+	if v, ok, _ := s.MemoryStore.Load(ctx, "a"); !ok || v != 1 {
+		t.Errorf("expected a=1 in the store, got %d (ok: %t)", v, ok)
+	}
+	if v, ok, _ := s.MemoryStore.Load(ctx, "b"); !ok || v != 2 {
+		t.Errorf("expected b=2 in the store, got %d (ok: %t)", v, ok)
+	}
+
+	time.Sleep(150 * time.Millisecond)
+	gc.DeleteExpired(ctx)
+	if _, ok, _ := s.MemoryStore.Load(ctx, "a"); !ok {
+		t.Error("expected expiration to keep the stored value")
+	}
+	if v, ok := gc.Get("a"); !ok || v != 1 {
+		t.Errorf("expected a to be reloaded from the store, got %d (ok: %t)", v, ok)
+	}
+
+	gc.Delete("a")
+	if _, ok, _ := s.MemoryStore.Load(ctx, "a"); ok {
+		t.Error("expected Delete to remove the stored value")
+	}
+}
+
+// TestGache_StoreLoadOnMiss verifies that misses are loaded once, including concurrent ones, and cached.
+func TestGache_StoreLoadOnMiss(t *testing.T) {
+	t.Helper()
+	s := newCountingStore()
+	s.delay = 50 * time.Millisecond
+	s.MemoryStore.Store(context.Background(), "k", 42)
+	gc := New[int](WithStore[int](s))
+	defer gc.Close()
+
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Go(func() {
+			if v, ok := gc.Get("k"); !ok || v != 42 {
+				t.Errorf("expected 42, got %d (ok: %t)", v, ok)
+			}
+		})
+	}
+	wg.Wait()
+	if v, ok := gc.Get("k"); !ok || v != 42 {
+		t.Errorf("expected the loaded value to be cached, got %d (ok: %t)", v, ok)
+	}
+	if n := s.loads.Load(); n != 1 {
+		t.Errorf("expected a single Load, got %d", n)
+	}
+	if _, ok := gc.Get("missing"); ok {
+		t.Error("expected a miss for a key absent from the store")
+	}
+}
+
+// TestGache_StoreGetMulti verifies that GetMulti loads all misses with one LoadMany.
+func TestGache_StoreGetMulti(t *testing.T) {
+	t.Helper()
+	s := newCountingStore()
+	s.MemoryStore.Store(context.Background(), "b", 2)
+	s.MemoryStore.Store(context.Background(), "c", 3)
+	gc := New[int](WithStore[int](s))
+	defer gc.Close()
+	gc.Set("a", 1)
+
+	found, missing := gc.GetMulti("a", "b", "c", "d")
+	if len(found) != 3 || found["b"] != 2 || found["c"] != 3 || len(missing) != 1 || missing[0] != "d" {
+		t.Errorf("unexpected result %v missing %v", found, missing)
+	}
+	if n, m := s.loadManys.Load(), s.loads.Load(); n != 1 || m != 0 {
+		t.Errorf("expected one LoadMany and no Load, got %d and %d", n, m)
+	}
+}
+
+// slowStore is a MemoryStore whose writes take a random time, so that
+// concurrent writes of a key reach it in any order unless they are ordered.
+type slowStore struct {
+	*MemoryStore[int]
+}
+
+func (s slowStore) Store(ctx context.Context, key string, val int) error {
+	time.Sleep(time.Duration(rand.IntN(100)) * time.Microsecond)
+	return s.MemoryStore.Store(ctx, key, val)
+}
+
+func (s slowStore) Delete(ctx context.Context, key string) error {
+	time.Sleep(time.Duration(rand.IntN(100)) * time.Microsecond)
+	return s.MemoryStore.Delete(ctx, key)
+}
+
+// TestGache_StoreOrder verifies that the store ends up with the value of the
+// cache after concurrent writes and deletes of the same keys.
+func TestGache_StoreOrder(t *testing.T) {
+	t.Helper()
+	tests := []struct {
+		name string
+		opts []StoreOption
+	}{
+		{name: "write-through"},
+		{name: "write-behind", opts: []StoreOption{WithWriteBehind(time.Millisecond, 4)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := slowStore{NewMemoryStore[int]()}
+			gc := New[int](WithStore[int](s, tt.opts...))
+			keys := []string{"a", "b", "c"}
+			var wg sync.WaitGroup
+			for w := range 8 {
+				wg.Go(func() {
+					for i := range 100 {
+						key := keys[(w+i)%len(keys)]
+						switch i % 5 {
+						case 0:
+							gc.Delete(key)
+						case 1:
+							gc.Compute(key, func(old int, _ bool) (int, Op) { return old + 1, OpReplace })
+						default:
+							gc.Set(key, w*1000+i)
+						}
+					}
+				})
+			}
+			wg.Wait()
+			if err := gc.Close(); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			g := gc.(*gache[int])
+			for _, key := range keys {
+				want, cached := 0, false
+				if val, ok := g.shards[getShardID(key, g.maxKeyLength)].LoadPointer(key); ok {
+					want, cached = val.val, true
+				}
+				if v, ok, _ := s.Load(t.Context(), key); ok != cached || v != want {
+					t.Errorf("expected the store to hold %d (ok: %t) for %s, got %d (ok: %t)", want, cached, key, v, ok)
+				}
+			}
+		})
+	}
+}
+
+// TestGache_StoreWriteBehind verifies coalescing, read-your-writes and flush on Close.
+func TestGache_StoreWriteBehind(t *testing.T) {
+	t.Helper()
+	ctx := context.Background()
+	s := newCountingStore()
+	s.MemoryStore.Store(ctx, "gone", 1)
+	gc := New[int](WithStore[int](s, WithWriteBehind(time.Hour, 1000)))
+
+	for i := range 100 {
+		gc.Set("k", i)
+	}
+	gc.Delete("gone")
+	if _, ok := gc.Get("gone"); ok {
+		t.Error("expected the pending delete to hide the stored value")
+	}
+	if n := s.stores.Load(); n != 0 {
+		t.Errorf("expected no writes before the flush, got %d", n)
+	}
+
+	if err := gc.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n := s.stores.Load(); n != 1 {
+		t.Errorf("expected the writes to be coalesced into 1, got %d", n)
+	}
+	if v, ok, _ := s.MemoryStore.Load(ctx, "k"); !ok || v != 99 {
+		t.Errorf("expected k=99 after Close, got %d (ok: %t)", v, ok)
+	}
+	if _, ok, _ := s.MemoryStore.Load(ctx, "gone"); ok {
+		t.Error("expected the delete to be flushed")
+	}
+}
+
+// TestGache_StoreWriteBehindBatch verifies that a full batch is flushed before the interval.
+func TestGache_StoreWriteBehindBatch(t *testing.T) {
+	t.Helper()
+	s := newCountingStore()
+	gc := New[int](WithStore[int](s, WithWriteBehind(time.Hour, 10)))
+	defer gc.Close()
+
+	for i := range 10 {
+		gc.Set(string(rune('a'+i)), i)
+	}
+	deadline := time.Now().Add(time.Second)
+	for s.Len() < 10 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if l := s.Len(); l != 10 {
+		t.Errorf("expected the full batch to be flushed, got %d keys", l)
+	}
+}
+
+// TestGache_StoreRetry verifies that failed writes are retried and reported once retries are exhausted.
+func TestGache_StoreRetry(t *testing.T) {
+	t.Helper()
+	s := newCountingStore()
+	var reported []string
+	gc := New[int](WithStore[int](s,
+		WithStoreRetry(3, time.Millisecond),
+		WithStoreErrorHandler(func(op, key string, err error) {
+			reported = append(reported, op+":"+key)
+		})))
+	defer gc.Close()
+
+	s.failures.Store(2)
+	gc.Set("k", 1)
+	if _, ok, _ := s.MemoryStore.Load(context.Background(), "k"); !ok {
+		t.Error("expected the write to succeed on the third attempt")
+	}
+
+	s.failures.Store(3)
+	gc.Set("j", 1)
+	if len(reported) != 1 || reported[0] != "store:j" {
+		t.Errorf("expected the failure to be reported, got %v", reported)
+	}
+}
+
+// TestGache_StoreReadModifyWrite verifies that operations reading a value
+// before writing one start from the value in the store on a miss.
+func TestGache_StoreReadModifyWrite(t *testing.T) {
+	t.Helper()
+	ctx := context.Background()
+	s := newCountingStore()
+	for _, k := range []string{"ctr", "replace", "versioned", "computed"} {
+		s.MemoryStore.Store(ctx, k, 41)
+	}
+	gc := New[int](WithStore[int](s))
+	defer gc.Close()
+
+	if v := Incr(gc, "ctr"); v != 42 {
+		t.Errorf("expected Incr to continue from the stored 41, got %d", v)
+	}
+	if v, _, _ := s.MemoryStore.Load(ctx, "ctr"); v != 42 {
+		t.Errorf("expected 42 to be written back, got %d", v)
+	}
+	if !gc.SetIfExists("replace", 1) {
+		t.Error("expected SetIfExists to find the stored key")
+	}
+	v, ver, ok := gc.GetVersioned("versioned")
+	if !ok || v != 41 || !gc.SetIfVersion("versioned", v+1, ver) {
+		t.Errorf("expected a versioned stored key, got %d, %d (ok: %t)", v, ver, ok)
+	}
+	if v, _ := gc.ComputeIfPresent("computed", func(old int) (int, Op) { return old * 2, OpReplace }); v != 82 {
+		t.Errorf("expected ComputeIfPresent to see the stored value, got %d", v)
+	}
+	if gc.SetIfExists("missing", 1) {
+		t.Error("expected SetIfExists to fail for a key the store does not hold")
+	}
+}
@@ -0,0 +1,88 @@
+package gache
+
+import (
+	"context"
+	"slices"
+	"sync/atomic"
+	"time"
+
+	"github.com/kpango/fastime"
+)
+
+// tags returns the tag index, creating and registering it on first use.
+func (g *gache[V]) tags() *keyIndex[V] {
+	g.tagOnce.Do(func() {
+		idx := newKeyIndex(func(_ V, tags []string) []string { return tags })
+		g.addObserver(idx)
+		g.tagIndex.Store(idx)
+	})
+	return g.tagIndex.Load()
+}
+
+// SetWithTags stores the key-value pair with the expiration duration d and
+// attaches tags to it. Every entry carrying a tag can later be removed at once
+// with [Gache.InvalidateTag]. Tags belong to the stored value: overwriting the
+// key with a plain Set drops them.
+//
+// Example:
+//
+//	gc := gache.New[[]byte]()
+//	gc.SetWithTags("/products/123", page, time.Hour, "product:123", "category:7")
+//
+//	// Product 123 changed: drop every page that rendered it.
+//	gc.InvalidateTag("product:123")
+func (g *gache[V]) SetWithTags(key string, val V, d time.Duration, tags ...string) {
+	if len(tags) == 0 {
+		g.set(key, val, int64(d))
+		return
+	}
+	g.tags()
+	g.store(key, val, g.absExpire(int64(d)), 0, 0, slices.Clone(tags))
+}
+
+// InvalidateTag removes every non-expired entry carrying tag and returns the
+// number of entries removed. Expired entries carrying the tag are removed as
+// expired, firing the expired hook if enabled.
+func (g *gache[V]) InvalidateTag(tag string) (n uint64) {
+	idx := g.tagIndex.Load()
+	if idx == nil {
+		return 0
+	}
+	for _, key := range idx.keysOf(tag) {
+		shard := g.shards[getShardID(key, g.maxKeyLength)]
+		for {
+			cur, ok := g.loadPointer(shard, key)
+			if !ok {
+				break
+			}
+			cur.mu.RLock()
+			if cur.key != key {
+				cur.mu.RUnlock()
+				continue
+			}
+			tagged := slices.Contains(cur.tags(), tag)
+			v := cur.val
+			expire := atomic.LoadInt64(&cur.expire)
+			cur.mu.RUnlock()
+			if !tagged {
+				break
+			}
+			if expire > 0 && fastime.UnixNanoNow() > expire {
+				g.expiration(key)
+				break
+			}
+			if g.compareAndDeletePointer(shard, key, cur) {
+				g.putValue(cur)
+				g.dropSpilled(key)
+				g.replicateKey(key)
+				if g.invalidator != nil {
+					g.invalidator.publish(key)
+				}
+				g.removal(context.Background(), key, v)
+				n++
+				break
+			}
+		}
+	}
+	return n
+}
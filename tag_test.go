@@ -0,0 +1,97 @@
+package gache
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestGache_InvalidateTag verifies that invalidating a tag removes exactly the entries carrying it.
+func TestGache_InvalidateTag(t *testing.T) {
+	t.Helper()
+	gc := New[string]()
+	gc.SetWithTags("/p/1", "page1", time.Minute, "product:123", "category:7")
+	gc.SetWithTags("/p/2", "page2", time.Minute, "product:123")
+	gc.SetWithTags("/p/3", "page3", time.Minute, "category:7")
+	gc.Set("/p/4", "page4")
+
+	if n := gc.InvalidateTag("product:123"); n != 2 {
+		t.Errorf("expected 2 invalidated entries, got %d", n)
+	}
+	for _, key := range []string{"/p/1", "/p/2"} {
+		if _, ok := gc.Get(key); ok {
+			t.Errorf("expected %s to be invalidated", key)
+		}
+	}
+	for _, key := range []string{"/p/3", "/p/4"} {
+		if _, ok := gc.Get(key); !ok {
+			t.Errorf("expected %s to remain", key)
+		}
+	}
+	if n := gc.InvalidateTag("product:123"); n != 0 {
+		t.Errorf("expected no entries left for the tag, got %d", n)
+	}
+	if n := gc.InvalidateTag("unknown"); n != 0 {
+		t.Errorf("expected 0 for an unknown tag, got %d", n)
+	}
+}
+
+// TestGache_TagIndexConsistency verifies that the tag index follows overwrites, deletes, expiration and Clear.
+func TestGache_TagIndexConsistency(t *testing.T) {
+	t.Helper()
+	gc := New[string]()
+	idx := gc.(*gache[string]).tags()
+
+	gc.SetWithTags("overwritten", "v", time.Minute, "t")
+	gc.Set("overwritten", "v")
+	gc.SetWithTags("deleted", "v", time.Minute, "t")
+	gc.Delete("deleted")
+	gc.SetWithTags("expired", "v", 50*time.Millisecond, "t")
+	gc.SetWithTags("extended", "v", time.Minute, "t")
+	gc.ExtendExpire("extended", time.Minute)
+	time.Sleep(150 * time.Millisecond)
+	gc.DeleteExpired(t.Context())
+
+	if keys := idx.keysOf("t"); len(keys) != 1 || keys[0] != "extended" {
+		t.Errorf("expected only 'extended' to carry the tag, got %v", keys)
+	}
+
+	gc.Clear()
+	if keys := idx.keysOf("t"); len(keys) != 0 {
+		t.Errorf("expected Clear to empty the tag index, got %v", keys)
+	}
+}
+
+// TestGache_TagConcurrent verifies that concurrent tagged writes and invalidations leave no tagged entry behind.
+func TestGache_TagConcurrent(t *testing.T) {
+	gc := New[int]()
+	var wg sync.WaitGroup
+	for n := range 20 {
+		wg.Go(func() {
+			for i := range 500 {
+				key := fmt.Sprintf("key-%d", i%50)
+				switch (n + i) % 4 {
+				case 0:
+					gc.SetWithTags(key, i, time.Minute, "a", "b")
+				case 1:
+					gc.Set(key, i)
+				case 2:
+					gc.Delete(key)
+				case 3:
+					gc.InvalidateTag("a")
+				}
+			}
+		})
+	}
+	wg.Wait()
+
+	gc.InvalidateTag("a")
+	idx := gc.(*gache[int]).tags()
+	if keys := idx.keysOf("a"); len(keys) != 0 {
+		t.Errorf("expected no keys left for tag a, got %v", keys)
+	}
+	if keys := idx.keysOf("b"); len(keys) != 0 {
+		t.Errorf("expected tag b to be released with tag a, got %v", keys)
+	}
+}
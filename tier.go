@@ -0,0 +1,279 @@
+package gache
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"errors"
+	"sync"
+)
+
+type (
+	// diskObserver keeps the disk tier consistent with the memory tier: a
+	// key written to memory supersedes any spilled copy.
+	diskObserver[V any] struct {
+		d *diskStore
+	}
+
+	// spillWriter encodes and writes the entries leaving memory to the disk
+	// tier on a goroutine of its own, so that the writes and reads that
+	// evict or expire them never wait for the file.
+	spillWriter[V any] struct {
+		d    *diskStore
+		ch   chan diskSpill[V]
+		stop chan struct{}
+		done chan struct{}
+		once sync.Once
+	}
+
+	// diskSpill is a queued spill of key written under ticket, or a flush
+	// marker when flushed is set.
+	diskSpill[V any] struct {
+		key     string
+		val     V
+		ticket  uint64
+		flushed chan struct{}
+	}
+)
+
+// spillQueueSize is the number of spills that may wait for the writer before
+// further ones are dropped.
+const spillQueueSize = 4096
+
+// WithDiskTier adds a disk-backed second tier stored in the file at path.
+// Entries evicted by [WithMaxEntries] or expiring from memory are encoded
+// with encoding/gob and appended to the file instead of being lost, and Get,
+// GetWithExpire and GetMulti transparently promote them back into memory,
+// with the cache's default expiration, when they miss in memory. The disk
+// tier has its own capacity and TTL, set with [WithDiskCapacity] and
+// [WithDiskTTL]; the TTL alone decides how long a spilled entry lives, so
+// without one expired entries stay available on disk until they are evicted
+// by capacity, promoted or deleted.
+//
+// Spills are written by a background goroutine, so an entry becomes
+// visible to promotion shortly after it leaves memory; while the writer is
+// behind, further spills are dropped. The file is truncated when the cache
+// is created and removed by [Gache.Close]; it is a spill area, not
+// persistent storage. Entries on disk are not visible to Len, iteration or
+// Write, but every delete, including DeleteIf, DeletePrefix and
+// CompareAndDelete, reaches them. Entries with tags are not spilled, since
+// their tags are not written to disk. Errors writing the file drop the
+// entry.
+//
+// Example:
+//
+//	gc := gache.New[[]byte](
+//	    gache.WithMaxEntries[[]byte](100_000),
+//	    gache.WithDiskTier[[]byte]("/var/cache/app/l2.log",
+//	        gache.WithDiskCapacity(10_000_000),
+//	        gache.WithDiskTTL(24*time.Hour)),
+//	)
+//	defer gc.Close()
+func WithDiskTier[V any](path string, opts ...DiskTierOption) Option[V] {
+	return func(g *gache[V]) error {
+		d, err := openDiskStore(path, opts...)
+		if err != nil {
+			return err
+		}
+		if g.l2 != nil {
+			g.spills.close()
+			g.l2.close()
+		}
+		g.l2 = d
+		g.spills = &spillWriter[V]{
+			d:    d,
+			ch:   make(chan diskSpill[V], spillQueueSize),
+			stop: make(chan struct{}),
+			done: make(chan struct{}),
+		}
+		go g.spills.run()
+		g.addObserver(&diskObserver[V]{d: d})
+		return nil
+	}
+}
+
+func (o *diskObserver[V]) insert(key string, _ V, _ []string) {
+	o.d.drop(key)
+}
+
+func (o *diskObserver[V]) release(string, V, []string) {}
+
+// spill queues an entry that left memory to be written to the disk tier if
+// enabled, dropping it if the writer is behind.
+func (g *gache[V]) spill(key string, v V) {
+	if g.l2 == nil {
+		return
+	}
+	ticket := g.l2.reserve(key)
+	select {
+	case g.spills.ch <- diskSpill[V]{key: key, val: v, ticket: ticket}:
+	default:
+		g.l2.unreserve(key, ticket)
+	}
+}
+
+func (w *spillWriter[V]) run() {
+	defer close(w.done)
+	var buf bytes.Buffer
+	for {
+		select {
+		case <-w.stop:
+			return
+		case s := <-w.ch:
+			if s.flushed != nil {
+				close(s.flushed)
+				continue
+			}
+			buf.Reset()
+			if err := gob.NewEncoder(&buf).Encode(&s.val); err != nil {
+				w.d.unreserve(s.key, s.ticket)
+				continue
+			}
+			_ = w.d.put(s.key, buf.Bytes(), s.ticket)
+		}
+	}
+}
+
+// flush waits until the spills queued so far have been written.
+func (w *spillWriter[V]) flush() {
+	flushed := make(chan struct{})
+	select {
+	case w.ch <- diskSpill[V]{flushed: flushed}:
+	case <-w.done:
+		return
+	}
+	select {
+	case <-flushed:
+	case <-w.done:
+	}
+}
+
+// close stops the writer, discarding the spills still queued.
+func (w *spillWriter[V]) close() {
+	w.once.Do(func() {
+		close(w.stop)
+		<-w.done
+	})
+}
+
+// unspill removes key from the disk tier and returns its value.
+func (g *gache[V]) unspill(key string) (v V, ok bool) {
+	if g.l2 == nil {
+		return v, false
+	}
+	data, ok := g.l2.take(key)
+	if !ok {
+		return v, false
+	}
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&v); err != nil {
+		return v, false
+	}
+	return v, true
+}
+
+// peek returns the spilled value of key, the absolute time the disk TTL
+// drops it and the seq of its record, without removing it.
+func (g *gache[V]) peek(key string) (v V, expire int64, seq uint64, ok bool) {
+	if g.l2 == nil {
+		return v, 0, 0, false
+	}
+	data, expire, seq, ok := g.l2.get(key)
+	if !ok {
+		return v, 0, 0, false
+	}
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&v); err != nil {
+		return v, 0, 0, false
+	}
+	return v, expire, seq, true
+}
+
+// dropSpilled removes the spilled copy of a key deleted from memory, which an
+// eviction racing with an earlier write of the key may have left behind.
+func (g *gache[V]) dropSpilled(key string) {
+	if g.l2 != nil {
+		g.l2.drop(key)
+	}
+}
+
+// unspillIf removes the spilled entries for which f, called with the key,
+// value and disk expiration of each, returns true and returns how many it
+// removed.
+func (g *gache[V]) unspillIf(ctx context.Context, f func(string, V, int64) bool) (n uint64) {
+	if g.l2 == nil {
+		return 0
+	}
+	for _, key := range g.l2.keys() {
+		if ctx.Err() != nil {
+			return n
+		}
+		v, expire, seq, ok := g.peek(key)
+		if !ok || !f(key, v, expire) || !g.dropSpilledSeq(key, seq) {
+			continue
+		}
+		g.removal(ctx, key, v)
+		n++
+	}
+	return n
+}
+
+// compareAndUnspill removes the spilled entry for key if eq reports that its
+// value equals expected.
+func (g *gache[V]) compareAndUnspill(key string, expected V, eq func(a, b V) bool) bool {
+	v, _, seq, ok := g.peek(key)
+	if !ok || !eq(v, expected) || !g.dropSpilledSeq(key, seq) {
+		return false
+	}
+	g.removal(context.Background(), key, v)
+	return true
+}
+
+// dropSpilledSeq deletes key, held only on disk, if its record is still the
+// one numbered seq, and reports whether it did.
+func (g *gache[V]) dropSpilledSeq(key string, seq uint64) bool {
+	defer unlockKey(g.lockKey(key))
+	if !g.l2.dropSeq(key, seq) {
+		return false
+	}
+	g.storeDelete(key)
+	g.replicateKey(key)
+	return true
+}
+
+// promote moves key from the disk tier into shard after a miss in memory.
+func (g *gache[V]) promote(shard *Map[string, value[V]], key string) (v V, expire int64, ok bool) {
+	v, ok = g.unspill(key)
+	if !ok {
+		return v, 0, false
+	}
+	return g.fill(shard, key, v)
+}
+
+// Close stops the expiration daemon and releases the resources held by the
+// cache, removing the file of the disk tier. The cache must not be used
+// after Close.
+//
+// Example:
+//
+//	gc := gache.New[string](gache.WithDiskTier[string]("l2.log"))
+//	defer gc.Close()
+func (g *gache[V]) Close() error {
+	g.Stop()
+	if g.replica != nil {
+		g.replica.close()
+	}
+	var err error
+	if g.primary != nil {
+		err = g.primary.close()
+	}
+	if g.invalidator != nil {
+		g.invalidator.close()
+	}
+	if g.backing != nil {
+		g.backing.close()
+	}
+	if g.l2 != nil {
+		g.spills.close()
+		return errors.Join(err, g.l2.close())
+	}
+	return err
+}
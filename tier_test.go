@@ -0,0 +1,265 @@
+package gache
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// flushSpills waits until the entries gc spilled so far are on disk.
+func flushSpills[V any](gc Gache[V]) {
+	gc.(*gache[V]).spills.flush()
+}
+
+// TestGache_DiskTierExpired verifies that entries expiring from memory are
+// spilled, promoted back with the default expiration and dropped by the disk
+// TTL alone.
+func TestGache_DiskTierExpired(t *testing.T) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "l2.log")
+	gc := New[string](
+		WithDefaultExpiration[string](time.Hour),
+		WithDiskTier[string](path, WithDiskTTL(200*time.Millisecond)),
+	)
+	defer gc.Close()
+
+	gc.SetWithExpire("tok", "secret", 10*time.Millisecond)
+	gc.SetWithExpire("old", "v", 10*time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+	if n := gc.DeleteExpired(t.Context()); n != 2 {
+		t.Fatalf("expected 2 expired entries, got %d", n)
+	}
+	flushSpills(gc)
+	v, expire, ok := gc.GetWithExpire("tok")
+	if !ok || v != "secret" {
+		t.Fatalf("expected the expired entry to be promoted, got %q (ok: %t)", v, ok)
+	}
+	if d := time.Until(time.Unix(0, expire)); d < 30*time.Minute {
+		t.Errorf("expected the promoted entry to get the default expiration, got %v", d)
+	}
+
+	time.Sleep(300 * time.Millisecond)
+	if v, ok := gc.Get("old"); ok {
+		t.Errorf("expected the disk TTL to drop the spilled entry, got %q", v)
+	}
+}
+
+// TestGache_DiskTierEviction verifies that entries evicted by the memory capacity spill to disk.
+func TestGache_DiskTierEviction(t *testing.T) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "l2.log")
+	gc := New[int](WithMaxEntries[int](5), WithDiskTier[int](path))
+	defer gc.Close()
+
+	for i := range 50 {
+		gc.Set(strconv.Itoa(i), i)
+	}
+	if l := gc.Len(); l != 5 {
+		t.Errorf("expected 5 entries in memory, got %d", l)
+	}
+	flushSpills(gc)
+	found, missing := gc.GetMulti("0", "1", "2")
+	if len(missing) != 0 || found["0"] != 0 || found["2"] != 2 {
+		t.Errorf("expected all keys to be promoted, got %v missing %v", found, missing)
+	}
+	for i := range 50 {
+		// Each promotion evicts another entry, which is spilled in the
+		// background.
+		flushSpills(gc)
+		if v, ok := gc.Get(strconv.Itoa(i)); !ok || v != i {
+			t.Errorf("expected %d, got %d (ok: %t)", i, v, ok)
+		}
+	}
+
+	// Deleting a key held only on disk must not let it come back.
+	gc.Set("50", 50)
+	flushSpills(gc)
+	if _, ok := gc.Delete("0"); !ok {
+		t.Error("expected Delete to remove the spilled entry")
+	}
+	if _, ok := gc.Get("0"); ok {
+		t.Error("expected deleted entry to stay deleted")
+	}
+
+	gc.Clear()
+	if _, ok := gc.Get("1"); ok {
+		t.Error("expected Clear to empty the disk tier")
+	}
+}
+
+// TestGache_DiskTierDelete verifies that every kind of delete removes entries
+// spilled to disk and that tagged entries are not spilled.
+func TestGache_DiskTierDelete(t *testing.T) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "l2.log")
+	gc := New[string](WithMaxEntries[string](1), WithDiskTier[string](path))
+	defer gc.Close()
+	// spilled writes key and then pushes it to disk with another write.
+	spilled := func(key, val string) {
+		t.Helper()
+		gc.SetWithExpire(key, val, NoTTL)
+		gc.SetWithExpire("filler", "", NoTTL)
+		if _, ok := gc.GetWithIgnoredExpire(key); ok {
+			t.Fatalf("expected %s to be evicted", key)
+		}
+		flushSpills(gc)
+	}
+
+	spilled("tenant:1:a", "A")
+	if n := gc.DeletePrefix(t.Context(), "tenant:1:"); n != 1 {
+		t.Errorf("expected DeletePrefix to remove 1 entry, got %d", n)
+	}
+	spilled("neg", "-")
+	if n := gc.DeleteIf(t.Context(), func(_, v string, _ int64) bool { return v == "-" }); n != 1 {
+		t.Errorf("expected DeleteIf to remove 1 entry, got %d", n)
+	}
+	spilled("lock", "owner")
+	if gc.CompareAndDelete("lock", "other", nil) {
+		t.Error("expected CompareAndDelete to compare the spilled value")
+	}
+	if !gc.CompareAndDelete("lock", "owner", nil) {
+		t.Error("expected CompareAndDelete to remove the spilled entry")
+	}
+	spilled("computed", "v")
+	gc.Compute("computed", func(string, bool) (string, Op) { return "", OpDelete })
+	for _, key := range []string{"tenant:1:a", "neg", "lock", "computed"} {
+		if v, ok := gc.Get(key); ok {
+			t.Errorf("expected %s to stay deleted, got %q", key, v)
+		}
+	}
+
+	gc.SetWithTags("tagged", "v", NoTTL, "t")
+	gc.SetWithExpire("filler", "", NoTTL)
+	flushSpills(gc)
+	if v, ok := gc.Get("tagged"); ok {
+		t.Errorf("expected the evicted tagged entry not to be spilled, got %q", v)
+	}
+}
+
+// TestGache_DiskTierOverwrite verifies that a newer write supersedes the spilled copy.
+func TestGache_DiskTierOverwrite(t *testing.T) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "l2.log")
+	gc := New[string](WithMaxEntries[string](1), WithDiskTier[string](path))
+	defer gc.Close()
+
+	gc.Set("k", "old")
+	gc.Set("other", "v")
+	flushSpills(gc)
+	gc.Set("k", "new")
+	gc.Delete("k")
+	flushSpills(gc)
+	if v, ok := gc.Get("k"); ok {
+		t.Errorf("expected the spilled copy to be superseded, got %q", v)
+	}
+}
+
+// TestGache_DiskTierTTL verifies that spilled entries expire after the disk TTL.
+func TestGache_DiskTierTTL(t *testing.T) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "l2.log")
+	gc := New[string](WithMaxEntries[string](1), WithDiskTier[string](path, WithDiskTTL(50*time.Millisecond)))
+	defer gc.Close()
+
+	gc.SetWithExpire("k", "v", NoTTL)
+	gc.SetWithExpire("other", "v", NoTTL)
+	flushSpills(gc)
+	time.Sleep(150 * time.Millisecond)
+	if _, ok := gc.Get("k"); ok {
+		t.Error("expected the entry to expire from disk")
+	}
+}
+
+// TestGache_DiskTierClose verifies that Close removes the spill file.
+func TestGache_DiskTierClose(t *testing.T) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "l2.log")
+	gc := New[string](WithDiskTier[string](path))
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("expected the spill file to exist: %v", err)
+	}
+	if err := gc.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("expected the spill file to be removed, got %v", err)
+	}
+}
+
+// TestDiskStore_CapacityAndCompact verifies capacity eviction and compaction of the log.
+func TestDiskStore_CapacityAndCompact(t *testing.T) {
+	t.Helper()
+	d, err := openDiskStore(filepath.Join(t.TempDir(), "l2.log"), WithDiskCapacity(2))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer d.close()
+
+	for _, k := range []string{"a", "b", "c"} {
+		if err := d.put(k, []byte("value-"+k), d.reserve(k)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if _, ok := d.take("a"); ok {
+		t.Error("expected the oldest entry to be evicted")
+	}
+	for i := range 10 {
+		d.put("b", []byte(strconv.Itoa(i)), d.reserve("b"))
+	}
+
+	d.mu.Lock()
+	before := d.end
+	err = d.compact()
+	after := d.end
+	d.mu.Unlock()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if after >= before {
+		t.Errorf("expected compaction to shrink the log, got %d -> %d", before, after)
+	}
+	if v, ok := d.take("b"); !ok || string(v) != "9" {
+		t.Errorf("expected latest b, got %q (ok: %t)", v, ok)
+	}
+	if v, ok := d.take("c"); !ok || string(v) != "value-c" {
+		t.Errorf("expected c, got %q (ok: %t)", v, ok)
+	}
+}
+
+// TestDiskStore_Reserve verifies that dropping a key or clearing the store
+// cancels the spills reserved before it.
+func TestDiskStore_Reserve(t *testing.T) {
+	t.Helper()
+	d, err := openDiskStore(filepath.Join(t.TempDir(), "l2.log"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer d.close()
+
+	tests := []struct {
+		name   string
+		cancel func(key string)
+		want   bool
+	}{
+		{name: "written", cancel: func(string) {}, want: true},
+		{name: "dropped", cancel: d.drop, want: false},
+		{name: "cleared", cancel: func(string) { d.clear() }, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ticket := d.reserve(tt.name)
+			tt.cancel(tt.name)
+			if err := d.put(tt.name, []byte("v"), ticket); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if _, ok := d.take(tt.name); ok != tt.want {
+				t.Errorf("expected stored %t, got %t", tt.want, ok)
+			}
+		})
+	}
+	if n := d.reserved.Load(); n != 0 {
+		t.Errorf("expected every reservation to be settled, got %d", n)
+	}
+}
@@ -0,0 +1,388 @@
+package gache
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
+
+	"github.com/kpango/fastime"
+)
+
+// Tx is the view of the cache passed to the function given to [Gache.Txn].
+// Reads see the transaction's own staged writes; writes are buffered and only
+// applied to the cache when the transaction commits.
+type Tx[V any] interface {
+	Get(string) (V, bool)
+	Set(string, V)
+	SetWithExpire(string, V, time.Duration)
+	Delete(string)
+}
+
+// ErrTxConflict is returned by [Gache.Txn] when the transaction could not be
+// committed because the keys it read kept changing concurrently.
+var ErrTxConflict = errors.New("gache: transaction conflict")
+
+// maxTxRetries is the number of times Txn re-runs a transaction whose reads
+// were invalidated before giving up with ErrTxConflict.
+const maxTxRetries = 16
+
+type (
+	tx[V any] struct {
+		g      *gache[V]
+		reads  map[string]uint64
+		writes map[string]txWrite[V]
+	}
+
+	txWrite[V any] struct {
+		val    V
+		expire int64
+		del    bool
+	}
+
+	// shardGate serialises the commits of transactions on a shard and, with
+	// WithTxnIsolation, orders the plain operations on it around them.
+	// Operations run without locking while no commit is pending on the
+	// shard and are counted in active; a commit raises pending, takes mu and
+	// waits for active to drain, after which new operations queue on
+	// mu.RLock until the commit has applied all its writes.
+	shardGate struct {
+		mu      sync.RWMutex
+		pending atomic.Int32
+		active  atomic.Int32
+		// Gates are polled by every plain operation of an isolated cache,
+		// so each one gets a cache line of its own.
+		_ [64 - unsafe.Sizeof(sync.RWMutex{}) - 8]byte
+	}
+)
+
+// WithTxnIsolation makes plain single-key reads and writes of the shards held
+// by a committing transaction wait until the commit has applied all its
+// writes, so that they cannot observe a partially applied transaction or land
+// between its validation and its writes. Every plain operation then pays for
+// passing the gate of its shard, even while no transaction runs, so enable it
+// only when plain operations race with [Gache.Txn] on the same keys.
+//
+// Example:
+//
+//	gc := gache.New[int](gache.WithTxnIsolation[int]())
+func WithTxnIsolation[V any]() Option[V] {
+	return func(g *gache[V]) error {
+		g.isolated = true
+		g.txGates()
+		return nil
+	}
+}
+
+// Txn runs f as a transaction over multiple keys. f reads keys and stages
+// writes and deletes through tx; if f returns an error nothing is applied and
+// the error is returned. Otherwise Txn locks the shards of every key the
+// transaction touched in ascending shard order, checks that none of the keys
+// read by f changed in the meantime and applies all staged mutations. If a read
+// key did change, f is run again, up to a limit, after which [ErrTxConflict]
+// is returned. f must therefore be free of side effects.
+//
+// Transactions are serialisable with respect to each other. Plain operations
+// are not ordered with commits unless the cache is created with
+// [WithTxnIsolation]: a plain read may see some of the writes of a commit in
+// progress, and a plain write racing with a commit may land between its
+// validation and its writes. The Store, replicas and invalidation bus are
+// updated after the shards have been released.
+//
+// Example:
+//
+//	err := gc.Txn(func(tx gache.Tx[User]) error {
+//	    u, ok := tx.Get("user:1")
+//	    if !ok {
+//	        return errNotFound
+//	    }
+//	    tx.Delete("email:" + u.Email)
+//	    u.Email = newEmail
+//	    tx.Set("user:1", u)
+//	    tx.Set("email:"+u.Email, u)
+//	    return nil
+//	})
+func (g *gache[V]) Txn(f func(tx Tx[V]) error) error {
+	for range maxTxRetries {
+		t := &tx[V]{
+			g:      g,
+			reads:  make(map[string]uint64),
+			writes: make(map[string]txWrite[V]),
+		}
+		if err := f(t); err != nil {
+			return err
+		}
+		if t.commit() {
+			return nil
+		}
+	}
+	return ErrTxConflict
+}
+
+// Get returns the value staged by this transaction for key, or the value
+// currently stored in the cache.
+func (t *tx[V]) Get(key string) (v V, ok bool) {
+	if w, staged := t.writes[key]; staged {
+		if w.del {
+			return v, false
+		}
+		return w.val, true
+	}
+	v, version, ok := t.g.GetVersioned(key)
+	if _, read := t.reads[key]; !read {
+		t.reads[key] = version
+	}
+	return v, ok
+}
+
+// Set stages key-value with the cache's default expiration.
+func (t *tx[V]) Set(key string, val V) {
+	t.writes[key] = txWrite[V]{val: val, expire: atomic.LoadInt64(&t.g.expire)}
+}
+
+// SetWithExpire stages key-value with the expiration duration d.
+func (t *tx[V]) SetWithExpire(key string, val V, d time.Duration) {
+	t.writes[key] = txWrite[V]{val: val, expire: int64(d)}
+}
+
+// Delete stages the removal of key.
+func (t *tx[V]) Delete(key string) {
+	t.writes[key] = txWrite[V]{del: true}
+}
+
+// commit validates the read set and applies the staged writes while holding
+// the gates of every involved shard. It reports false if a read key changed
+// since it was read. Values are created before and released after the gates
+// are held, so observers and the disk tier are not called under them.
+func (t *tx[V]) commit() bool {
+	g := t.g
+	ids := make([]uint64, 0, len(t.reads)+len(t.writes))
+	for key := range t.reads {
+		ids = append(ids, getShardID(key, g.maxKeyLength))
+	}
+	for key := range t.writes {
+		ids = append(ids, getShardID(key, g.maxKeyLength))
+	}
+	slices.Sort(ids)
+	ids = slices.Compact(ids)
+
+	// The removal hook runs once the locks below are released.
+	var removed []kv[V]
+	defer func() {
+		for _, r := range removed {
+			g.removal(context.Background(), r.key, r.value)
+		}
+	}()
+
+	vals := make(map[string]*value[V], len(t.writes))
+	for key, w := range t.writes {
+		if !w.del {
+			vals[key] = g.newValue(key, w.val, g.absExpire(w.expire), 0, 0, nil)
+		}
+	}
+	if g.backing != nil {
+		// The Store writes below must be ordered with those of plain
+		// operations, as lockKey does for them.
+		for _, id := range ids {
+			g.backing.order[id].Lock()
+		}
+		defer func() {
+			for _, id := range slices.Backward(ids) {
+				g.backing.order[id].Unlock()
+			}
+		}()
+	}
+	gates := g.txGates()
+	for _, id := range ids {
+		gates[id].lock()
+	}
+	unlock := func() {
+		for _, id := range slices.Backward(ids) {
+			gates[id].unlock()
+		}
+	}
+
+	for key, version := range t.reads {
+		if g.currentVersion(key) != version {
+			unlock()
+			for _, val := range vals {
+				g.putValue(val)
+			}
+			return false
+		}
+	}
+	// The shards are held, so the writes go to them directly instead of
+	// through the gated helpers used by plain operations.
+	olds := make(map[string]*value[V], len(t.writes))
+	for key, w := range t.writes {
+		shard := g.shards[getShardID(key, g.maxKeyLength)]
+		var old *value[V]
+		var loaded bool
+		if w.del {
+			old, loaded = shard.LoadAndDeletePointer(key)
+		} else {
+			old, loaded = shard.SwapPointer(key, vals[key])
+		}
+		if loaded {
+			olds[key] = old
+		}
+	}
+	unlock()
+
+	for key, w := range t.writes {
+		if old, ok := olds[key]; ok {
+			if w.del {
+				if v, ok := g.release(key, old); ok {
+					removed = append(removed, kv[V]{key: key, value: v})
+				}
+			} else {
+				g.putValue(old)
+			}
+		}
+		if w.del {
+			g.dropSpilled(key)
+			g.storeDelete(key)
+			g.replicateKey(key)
+			continue
+		}
+		g.storeSet(key, w.val)
+	}
+	return true
+}
+
+// txGates returns the gates of the shards, allocating them on first use.
+func (g *gache[V]) txGates() *[slen]shardGate {
+	if gates := g.gates.Load(); gates != nil {
+		return gates
+	}
+	g.gates.CompareAndSwap(nil, new([slen]shardGate))
+	return g.gates.Load()
+}
+
+// currentVersion returns the version of the live entry for key, or 0 if
+// there is none, without going through the gate of its shard.
+func (g *gache[V]) currentVersion(key string) uint64 {
+	val, ok := g.shards[getShardID(key, g.maxKeyLength)].LoadPointer(key)
+	if !ok {
+		return 0
+	}
+	val.mu.RLock()
+	defer val.mu.RUnlock()
+	if val.key != key {
+		return 0
+	}
+	if expire := atomic.LoadInt64(&val.expire); expire > 0 && fastime.UnixNanoNow() > expire {
+		return 0
+	}
+	return val.version
+}
+
+// enter lets a plain operation on the shard of key pass the gate of an
+// isolated cache. The returned gate must be left with exit once the shard
+// operation is done; nothing that may enter another gate can run in between.
+func (g *gache[V]) enter(key string) (gate *shardGate, locked bool) {
+	gate = &g.gates.Load()[getShardID(key, g.maxKeyLength)]
+	return gate, gate.enter()
+}
+
+// enter reports whether the operation had to take the read lock because a
+// commit is pending.
+func (s *shardGate) enter() (locked bool) {
+	s.active.Add(1)
+	if s.pending.Load() == 0 {
+		return false
+	}
+	s.active.Add(-1)
+	s.mu.RLock()
+	return true
+}
+
+func (s *shardGate) exit(locked bool) {
+	if locked {
+		s.mu.RUnlock()
+		return
+	}
+	s.active.Add(-1)
+}
+
+// lock holds the shard for a commit once the operations that passed the gate
+// before it have finished.
+func (s *shardGate) lock() {
+	s.pending.Add(1)
+	s.mu.Lock()
+	for s.active.Load() != 0 {
+		runtime.Gosched()
+	}
+}
+
+func (s *shardGate) unlock() {
+	s.mu.Unlock()
+	s.pending.Add(-1)
+}
+
+// The methods below are the shard operations used by plain reads and writes,
+// each passing the gate of the shard of key if the cache is isolated.
+
+func (g *gache[V]) loadPointer(shard *Map[string, value[V]], key string) (*value[V], bool) {
+	if !g.isolated {
+		return shard.LoadPointer(key)
+	}
+	gate, locked := g.enter(key)
+	val, ok := shard.LoadPointer(key)
+	gate.exit(locked)
+	return val, ok
+}
+
+func (g *gache[V]) swapPointer(shard *Map[string, value[V]], key string, val *value[V]) (*value[V], bool) {
+	if !g.isolated {
+		return shard.SwapPointer(key, val)
+	}
+	gate, locked := g.enter(key)
+	old, loaded := shard.SwapPointer(key, val)
+	gate.exit(locked)
+	return old, loaded
+}
+
+func (g *gache[V]) loadOrStorePointer(shard *Map[string, value[V]], key string, val *value[V]) (*value[V], bool) {
+	if !g.isolated {
+		return shard.LoadOrStorePointer(key, val)
+	}
+	gate, locked := g.enter(key)
+	actual, loaded := shard.LoadOrStorePointer(key, val)
+	gate.exit(locked)
+	return actual, loaded
+}
+
+func (g *gache[V]) loadAndDeletePointer(shard *Map[string, value[V]], key string) (*value[V], bool) {
+	if !g.isolated {
+		return shard.LoadAndDeletePointer(key)
+	}
+	gate, locked := g.enter(key)
+	val, loaded := shard.LoadAndDeletePointer(key)
+	gate.exit(locked)
+	return val, loaded
+}
+
+func (g *gache[V]) compareAndSwapPointer(shard *Map[string, value[V]], key string, old, val *value[V]) bool {
+	if !g.isolated {
+		return shard.CompareAndSwapPointer(key, old, val)
+	}
+	gate, locked := g.enter(key)
+	swapped := shard.CompareAndSwapPointer(key, old, val)
+	gate.exit(locked)
+	return swapped
+}
+
+func (g *gache[V]) compareAndDeletePointer(shard *Map[string, value[V]], key string, old *value[V]) bool {
+	if !g.isolated {
+		return shard.CompareAndDeletePointer(key, old)
+	}
+	gate, locked := g.enter(key)
+	deleted := shard.CompareAndDeletePointer(key, old)
+	gate.exit(locked)
+	return deleted
+}
@@ -0,0 +1,184 @@
+package gache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestGache_Txn verifies that a committed transaction applies all staged writes and deletes and reads its own writes.
+func TestGache_Txn(t *testing.T) {
+	t.Helper()
+	gc := New[string]()
+	gc.Set("user:1", "a@example.com")
+	gc.Set("email:a@example.com", "user:1")
+
+	err := gc.Txn(func(tx Tx[string]) error {
+		email, ok := tx.Get("user:1")
+		if !ok {
+			return errors.New("user not found")
+		}
+		tx.Delete("email:" + email)
+		tx.Set("user:1", "b@example.com")
+		tx.Set("email:b@example.com", "user:1")
+		if v, ok := tx.Get("user:1"); !ok || v != "b@example.com" {
+			t.Errorf("expected staged write to be visible, got %q (ok: %t)", v, ok)
+		}
+		if _, ok := tx.Get("email:" + email); ok {
+			t.Error("expected staged delete to be visible")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v, ok := gc.Get("user:1"); !ok || v != "b@example.com" {
+		t.Errorf("expected b@example.com, got %q (ok: %t)", v, ok)
+	}
+	if _, ok := gc.Get("email:a@example.com"); ok {
+		t.Error("expected old index key to be deleted")
+	}
+	if v, ok := gc.Get("email:b@example.com"); !ok || v != "user:1" {
+		t.Errorf("expected new index key, got %q (ok: %t)", v, ok)
+	}
+}
+
+// TestGache_TxnError verifies that nothing is applied when the transaction function returns an error.
+func TestGache_TxnError(t *testing.T) {
+	t.Helper()
+	gc := New[int]()
+	gc.Set("a", 1)
+	errAbort := errors.New("abort")
+
+	err := gc.Txn(func(tx Tx[int]) error {
+		tx.Set("a", 2)
+		tx.Set("b", 3)
+		return errAbort
+	})
+	if !errors.Is(err, errAbort) {
+		t.Fatalf("expected errAbort, got %v", err)
+	}
+	if v, _ := gc.Get("a"); v != 1 {
+		t.Errorf("expected a to remain 1, got %d", v)
+	}
+	if _, ok := gc.Get("b"); ok {
+		t.Error("expected b not to be written")
+	}
+}
+
+// TestGache_TxnConcurrent verifies that concurrent transfers between keys preserve the total, proving transactions are serialisable.
+func TestGache_TxnConcurrent(t *testing.T) {
+	gc := New[int]()
+	const (
+		numAccounts   = 10
+		numGoroutines = 20
+		iterations    = 200
+		initial       = 1000
+	)
+	for i := range numAccounts {
+		gc.Set(fmt.Sprintf("acct-%d", i), initial)
+	}
+
+	var wg sync.WaitGroup
+	for n := range numGoroutines {
+		wg.Go(func() {
+			for i := range iterations {
+				from := fmt.Sprintf("acct-%d", (n+i)%numAccounts)
+				to := fmt.Sprintf("acct-%d", (n+i+1)%numAccounts)
+				err := gc.Txn(func(tx Tx[int]) error {
+					a, _ := tx.Get(from)
+					b, _ := tx.Get(to)
+					tx.Set(from, a-1)
+					tx.Set(to, b+1)
+					return nil
+				})
+				if err != nil && !errors.Is(err, ErrTxConflict) {
+					t.Error(err)
+				}
+			}
+		})
+	}
+	wg.Wait()
+
+	var total int
+	for i := range numAccounts {
+		v, _ := gc.Get(fmt.Sprintf("acct-%d", i))
+		total += v
+	}
+	if total != numAccounts*initial {
+		t.Fatalf("expected total %d, got %d", numAccounts*initial, total)
+	}
+}
+
+// TestGache_TxnPlainOps verifies that with WithTxnIsolation plain reads and
+// writes of the shards held by a commit wait until it releases them, and that
+// they do not wait without it.
+func TestGache_TxnPlainOps(t *testing.T) {
+	t.Helper()
+	for _, isolated := range []bool{true, false} {
+		var opts []Option[int]
+		if isolated {
+			opts = append(opts, WithTxnIsolation[int]())
+		}
+		gc := New(opts...).(*gache[int])
+		gc.Set("x", 0)
+		// Hold the shard as a commit does while it applies its writes.
+		gate := &gc.txGates()[getShardID("x", gc.maxKeyLength)]
+		gate.lock()
+
+		read, written := make(chan int, 1), make(chan struct{})
+		go func() {
+			x, _ := gc.Get("x")
+			read <- x
+		}()
+		go func() {
+			gc.Set("x", 1)
+			close(written)
+		}()
+		waited := true
+		select {
+		case <-read:
+			waited = false
+		case <-written:
+			waited = false
+		case <-time.After(50 * time.Millisecond):
+		}
+		gate.unlock()
+		if waited != isolated {
+			t.Errorf("expected plain operations to wait for the commit: %t, got %t", isolated, waited)
+		}
+		<-written
+		if v, _ := gc.Get("x"); v != 1 {
+			t.Errorf("expected the plain write to be applied, got %d", v)
+		}
+	}
+}
+
+// TestGache_TxnStore verifies that a transaction reads keys that are only in
+// the backing store.
+func TestGache_TxnStore(t *testing.T) {
+	t.Helper()
+	s := NewMemoryStore[int]()
+	s.Store(context.Background(), "n", 41)
+	gc := New(WithStore[int](s))
+	defer gc.Close()
+
+	err := gc.Txn(func(tx Tx[int]) error {
+		n, ok := tx.Get("n")
+		if !ok {
+			return errors.New("n not found")
+		}
+		tx.Set("n", n+1)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, ok, _ := s.Load(context.Background(), "n"); !ok || v != 42 {
+		t.Errorf("expected 42 in the store, got %d (ok: %t)", v, ok)
+	}
+}
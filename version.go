@@ -0,0 +1,180 @@
+package gache
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/kpango/fastime"
+)
+
+// GetVersioned retrieves the value for key together with its version. The
+// version changes every time the value is written and can be passed to
+// [Gache.SetIfVersion] or [Gache.DeleteIfVersion] to update the entry only if
+// nobody else has modified it in the meantime, like memcached's cas. Reading
+// or extending the expiration of an entry does not change its version. Like
+// Get, it brings missing keys in from the disk tier or the backing store,
+// which gives them a new version.
+//
+// Example:
+//
+//	gc := gache.New[int]()
+//	gc.Set("stock", 10)
+//
+//	for {
+//	    v, ver, _ := gc.GetVersioned("stock")
+//	    if gc.SetIfVersion("stock", v-1, ver) {
+//	        break
+//	    }
+//	}
+func (g *gache[V]) GetVersioned(key string) (v V, version uint64, ok bool) {
+	shard := g.shards[getShardID(key, g.maxKeyLength)]
+	for faulted := false; ; faulted = true {
+		val, ok := g.loadPointer(shard, key)
+		if ok {
+			val.mu.RLock()
+			if val.key != key {
+				val.mu.RUnlock()
+				return v, 0, false
+			}
+			v = val.val
+			version = val.version
+			expire := atomic.LoadInt64(&val.expire)
+			val.mu.RUnlock()
+
+			if expire <= 0 || fastime.UnixNanoNow() <= expire {
+				return v, version, true
+			}
+			g.expiration(key)
+		}
+		if faulted || !g.fault(shard, key) {
+			var zero V
+			return zero, 0, false
+		}
+	}
+}
+
+// SetIfVersion stores the key-value pair with the default expiration only if
+// the entry for key still exists and has the given version. It reports
+// whether the value was stored.
+func (g *gache[V]) SetIfVersion(key string, val V, version uint64) bool {
+	return g.setIfVersion(key, val, atomic.LoadInt64(&g.expire), version)
+}
+
+// SetWithExpireIfVersion is like [Gache.SetIfVersion] but the stored entry
+// expires after d.
+func (g *gache[V]) SetWithExpireIfVersion(key string, val V, d time.Duration, version uint64) bool {
+	return g.setIfVersion(key, val, int64(d), version)
+}
+
+func (g *gache[V]) setIfVersion(key string, val V, expire int64, version uint64) bool {
+	shard := g.shards[getShardID(key, g.maxKeyLength)]
+	var newVal *value[V]
+	for {
+		cur, ok := g.loadVersion(key, version)
+		if !ok {
+			if newVal != nil {
+				g.putValue(newVal)
+			}
+			return false
+		}
+		if newVal == nil {
+			exp := expire
+			if exp > 0 {
+				exp = fastime.UnixNanoNow() + g.jitter(exp)
+			}
+			newVal = g.newValue(key, val, exp, 0, 0, nil)
+		}
+		mu := g.lockKey(key)
+		if !g.compareAndSwapPointer(shard, key, cur, newVal) {
+			unlockKey(mu)
+			continue
+		}
+		if !hasVersion(cur, key, version) {
+			// cur was released and reused for a newer entry after
+			// loadVersion checked it: put it back unless it has been
+			// overwritten already.
+			restored := g.compareAndSwapPointer(shard, key, newVal, cur)
+			unlockKey(mu)
+			if restored {
+				g.putValue(newVal)
+			} else {
+				g.putValue(cur)
+			}
+			return false
+		}
+		g.storeSet(key, val)
+		unlockKey(mu)
+		g.putValue(cur)
+		return true
+	}
+}
+
+// DeleteIfVersion removes the entry for key only if it still exists and has
+// the given version. It reports whether the entry was deleted.
+func (g *gache[V]) DeleteIfVersion(key string, version uint64) bool {
+	shard := g.shards[getShardID(key, g.maxKeyLength)]
+	for {
+		cur, ok := g.loadVersion(key, version)
+		if !ok {
+			return false
+		}
+		mu := g.lockKey(key)
+		if !g.compareAndDeletePointer(shard, key, cur) {
+			unlockKey(mu)
+			continue
+		}
+		if !hasVersion(cur, key, version) {
+			_, loaded := g.loadOrStorePointer(shard, key, cur)
+			unlockKey(mu)
+			if loaded {
+				g.putValue(cur)
+			}
+			return false
+		}
+		cur.mu.RLock()
+		v := cur.val
+		cur.mu.RUnlock()
+		g.dropSpilled(key)
+		g.storeDelete(key)
+		g.replicateKey(key)
+		unlockKey(mu)
+		g.putValue(cur)
+		g.removal(context.Background(), key, v)
+		return true
+	}
+}
+
+// loadVersion returns the live value stored for key if its version matches.
+// Since values are pooled, the value may be released and reused for a newer
+// entry of key before the caller swaps it out, so the caller must check it
+// again with hasVersion once it has removed it from the shard.
+func (g *gache[V]) loadVersion(key string, version uint64) (*value[V], bool) {
+	if version == 0 {
+		return nil, false
+	}
+	for {
+		cur, ok := g.loadPointer(g.shards[getShardID(key, g.maxKeyLength)], key)
+		if !ok {
+			return nil, false
+		}
+		cur.mu.RLock()
+		if cur.key != key {
+			cur.mu.RUnlock()
+			continue
+		}
+		current := cur.version
+		expire := atomic.LoadInt64(&cur.expire)
+		cur.mu.RUnlock()
+		valid := expire <= 0 || fastime.UnixNanoNow() <= expire
+		return cur, valid && current == version
+	}
+}
+
+// hasVersion reports whether val holds the entry for key with the given
+// version.
+func hasVersion[V any](val *value[V], key string, version uint64) bool {
+	val.mu.RLock()
+	defer val.mu.RUnlock()
+	return val.key == key && val.version == version
+}
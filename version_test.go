@@ -0,0 +1,112 @@
+package gache
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestGache_Versioned verifies that versions change on every write and that conditional writes only succeed against the current version.
+func TestGache_Versioned(t *testing.T) {
+	t.Helper()
+	gc := New[string]()
+	if _, _, ok := gc.GetVersioned("key"); ok {
+		t.Fatal("expected absent key to have no version")
+	}
+	if gc.SetIfVersion("key", "value", 0) {
+		t.Error("expected SetIfVersion to fail for an absent key")
+	}
+
+	gc.Set("key", "v1")
+	v, ver1, ok := gc.GetVersioned("key")
+	if !ok || v != "v1" || ver1 == 0 {
+		t.Fatalf("expected v1 with a version, got %q version %d (ok: %t)", v, ver1, ok)
+	}
+
+	gc.ExtendExpire("key", time.Minute)
+	if _, ver, _ := gc.GetVersioned("key"); ver != ver1 {
+		t.Errorf("expected ExtendExpire to keep version %d, got %d", ver1, ver)
+	}
+
+	if !gc.SetIfVersion("key", "v2", ver1) {
+		t.Fatal("expected SetIfVersion to succeed with the current version")
+	}
+	v, ver2, _ := gc.GetVersioned("key")
+	if v != "v2" || ver2 <= ver1 {
+		t.Errorf("expected v2 with a version above %d, got %q version %d", ver1, v, ver2)
+	}
+	if gc.SetIfVersion("key", "v3", ver1) {
+		t.Error("expected SetIfVersion to fail with a stale version")
+	}
+	if gc.DeleteIfVersion("key", ver1) {
+		t.Error("expected DeleteIfVersion to fail with a stale version")
+	}
+	if !gc.DeleteIfVersion("key", ver2) {
+		t.Error("expected DeleteIfVersion to succeed with the current version")
+	}
+	if _, ok := gc.Get("key"); ok {
+		t.Error("expected key to be deleted")
+	}
+}
+
+// TestGache_VersionedConcurrent verifies that optimistic read-modify-write loops built on versions never lose updates.
+func TestGache_VersionedConcurrent(t *testing.T) {
+	gc := New[int]()
+	gc.Set("counter", 0)
+	const (
+		numGoroutines = 20
+		iterations    = 500
+	)
+
+	var wg sync.WaitGroup
+	for range numGoroutines {
+		wg.Go(func() {
+			for range iterations {
+				for {
+					v, ver, _ := gc.GetVersioned("counter")
+					if gc.SetIfVersion("counter", v+1, ver) {
+						break
+					}
+				}
+			}
+		})
+	}
+	wg.Wait()
+
+	if v, ok := gc.Get("counter"); !ok || v != numGoroutines*iterations {
+		t.Fatalf("expected %d, got %d (ok: %t)", numGoroutines*iterations, v, ok)
+	}
+}
+
+// TestGache_VersionedReuse verifies that SetIfVersion fails when the value it
+// checked is released and reused for a newer entry before it is swapped out.
+func TestGache_VersionedReuse(t *testing.T) {
+	t.Helper()
+	gc := New[string]().(*gache[string])
+	gc.Set("key", "v1")
+	_, ver, _ := gc.GetVersioned("key")
+	cur, _ := gc.shards[getShardID("key", gc.maxKeyLength)].LoadPointer("key")
+
+	// The index runs between the version check and the swap, where it
+	// rewrites the checked value as the pool would when reusing it.
+	var reuse sync.Once
+	if err := gc.AddIndex("reuse", func(v string) []string {
+		if v == "stale" {
+			reuse.Do(func() {
+				cur.mu.Lock()
+				cur.val = "v2"
+				cur.version = gc.version.Add(1)
+				cur.mu.Unlock()
+			})
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if gc.SetIfVersion("key", "stale", ver) {
+		t.Error("expected SetIfVersion to fail against a reused value")
+	}
+	if v, _ := gc.Get("key"); v != "v2" {
+		t.Errorf("expected the newer entry v2 to remain, got %q", v)
+	}
+}